@@ -5,6 +5,7 @@ import (
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"os"
+	"time"
 )
 
 const confPath = "config/parameters.yaml"
@@ -17,9 +18,46 @@ type DBConfig struct {
 	DBName   string `yaml:"db_name"`
 }
 
+type WSConfig struct {
+	SendBuffer   int           `yaml:"ws_send_buffer"`
+	WriteTimeout time.Duration `yaml:"ws_write_timeout"`
+	PingPeriod   time.Duration `yaml:"ws_ping_period"`
+}
+
+// TimeoutConfig - ограничения времени обработки HTTP-запросов, 0 - без ограничения
+type TimeoutConfig struct {
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	// таймауты отдельных методов, ключ - путь метода, например /messages/get
+	EndpointTimeouts map[string]time.Duration `yaml:"endpoint_timeouts"`
+}
+
+// AuthConfig - время жизни токенов сессий, созданных входом по паролю
+type AuthConfig struct {
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+}
+
+// MessageConfig - окно, в течение которого автор может редактировать сообщение после отправки, 0 - без ограничения.
+// Текст удаленных сообщений и их правки стираются через DeletedRetention после удаления, 0 - хранятся всегда
+type MessageConfig struct {
+	EditWindow       time.Duration `yaml:"message_edit_window"`
+	DeletedRetention time.Duration `yaml:"deleted_message_retention"`
+	PurgeInterval    time.Duration `yaml:"message_purge_interval"`
+}
+
 type ApplicationConfig struct {
 	DB DBConfig `yaml:",inline"`
+	WS WSConfig `yaml:",inline"`
+	Timeouts TimeoutConfig `yaml:",inline"`
+	Auth AuthConfig `yaml:",inline"`
+	Messages MessageConfig `yaml:",inline"`
 	HTTPPort uint16 `yaml:"http_port"`
+	// postgres, sqlite или memory - хранилище в памяти без внешних зависимостей, данные не сохраняются
+	StorageDriver string `yaml:"storage_driver"`
+	SQLitePath string `yaml:"sqlite_path"`
+	// local - события доставляются только клиентам своего экземпляра,
+	// postgres - рассылка между экземплярами через LISTEN/NOTIFY
+	EventBus string `yaml:"event_bus"`
 }
 
 func ParseConfig() (*ApplicationConfig, error) {
@@ -1,10 +1,10 @@
 package db
 
 import (
-	"../config"
+	"avito/config"
 	"context"
 	"fmt"
-	"github.com/jackc/pgx/pgxpool"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"log"
 )
 
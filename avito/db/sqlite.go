@@ -0,0 +1,25 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	_ "modernc.org/sqlite"
+)
+
+// NewConnectToSQLite открывает файл базы SQLite. Используется одно соединение:
+// SQLite допускает только одного писателя, а pragma действуют на соединение
+func NewConnectToSQLite(path string) *sql.DB {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		log.Fatalf("Cannot open sqlite database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	for _, pragma := range []string{"pragma foreign_keys = on", "pragma journal_mode = wal", "pragma busy_timeout = 5000"} {
+		if _, err := db.Exec(pragma); err != nil {
+			log.Fatalf("Cannot set sqlite %s: %v", pragma, err)
+		}
+	}
+
+	return db
+}
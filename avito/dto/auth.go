@@ -0,0 +1,64 @@
+package dto
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+)
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// String не выводит пароль, чтобы он не попадал в логи
+func (r LoginRequest) String() string {
+	return fmt.Sprintf("{username: %s}", r.Username)
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (r RefreshRequest) String() string {
+	return "{refreshToken: ***}"
+}
+
+// AuthResponse - пара токенов сессии. ExpiresIn - время жизни access-токена в секундах
+type AuthResponse struct {
+	SessionID    uuid.UUID `json:"session_id"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresIn    int       `json:"expires_in"`
+}
+
+func (r AuthResponse) String() string {
+	return fmt.Sprintf("{sessionID: %s, expiresIn: %d}", r.SessionID, r.ExpiresIn)
+}
+
+// Session - сессия пользователя, Current - сессия, токеном которой выполнен запрос
+type Session struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt float64   `json:"created_at"`
+	ExpiresAt float64   `json:"expires_at"`
+	Current   bool      `json:"current"`
+}
+
+func (r Session) String() string {
+	return fmt.Sprintf("{sessionID: %s, createdAt: %f, expiresAt: %f, current: %t}", r.ID, r.CreatedAt, r.ExpiresAt, r.Current)
+}
+
+type SessionListResponse struct {
+	Sessions []Session `json:"sessions"`
+}
+
+func (r SessionListResponse) String() string {
+	return fmt.Sprintf("{sessions: %s}", r.Sessions)
+}
+
+type RevokeSessionRequest struct {
+	SessionID uuid.UUID `json:"session_id"`
+}
+
+func (r RevokeSessionRequest) String() string {
+	return fmt.Sprintf("{sessionID: %s}", r.SessionID)
+}
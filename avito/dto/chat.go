@@ -5,15 +5,45 @@ import (
 	"github.com/google/uuid"
 )
 
+// роли участников чата по убыванию прав: owner - создатель чата, readonly - только чтение
+const (
+	RoleOwner    = "owner"
+	RoleAdmin    = "admin"
+	RoleMember   = "member"
+	RoleReadOnly = "readonly"
+)
+
+// типы чатов: group - именованный чат с ролями, direct - личный чат двух пользователей без имени
+const (
+	ChatGroup  = "group"
+	ChatDirect = "direct"
+)
+
+type ChatMember struct {
+	User uuid.UUID `json:"user"`
+	Role string    `json:"role"`
+}
+
+// LastMessageAt равно 0, а LastMessage - nil, если в чате еще нет сообщений.
+// Members с ролями заполняется только при запросе одного чата, UnreadCount и
+// LastReadMessageID - только в списке чатов пользователя
 type Chat struct {
-	ID        uuid.UUID
-	Name      string
-	Users     []uuid.UUID
-	CreatedAt float64
+	ID                uuid.UUID
+	Name              string
+	Type              string `json:"type"`
+	Users             []uuid.UUID
+	UsersCount        int `json:"users_count"`
+	CreatedAt         float64
+	LastMessageAt     float64      `json:"last_message_at"`
+	LastMessage       *Message     `json:"last_message"`
+	Members           []ChatMember `json:"members,omitempty"`
+	UnreadCount       int          `json:"unread_count"`
+	LastReadMessageID *uuid.UUID   `json:"last_read_message_id"`
 }
 
 func (r Chat) String() string {
-	return fmt.Sprintf("chatID: %s, chatName: %s, users: %s, createdAt: %f", r.ID, r.Name, r.Users, r.CreatedAt)
+	return fmt.Sprintf("chatID: %s, chatName: %s, type: %s, users: %s, usersCount: %d, createdAt: %f, lastMessageAt: %f",
+		r.ID, r.Name, r.Type, r.Users, r.UsersCount, r.CreatedAt, r.LastMessageAt)
 }
 
 type CreateChatRequest struct {
@@ -33,18 +63,160 @@ func (r CreateChatResponse) String() string {
 	return fmt.Sprintf("{chatID: %s}", r.ID)
 }
 
+// DirectChatRequest - собеседник, личный чат с которым нужно найти или создать
+type DirectChatRequest struct {
+	User uuid.UUID `json:"user"`
+}
+
+func (r DirectChatRequest) String() string {
+	return fmt.Sprintf("{user: %s}", r.User)
+}
+
+type ChatRequest struct {
+	Chat uuid.UUID `json:"chat"`
+}
+
+func (r ChatRequest) String() string {
+	return fmt.Sprintf("{chat: %s}", r.Chat)
+}
+
+// Role - роль новых участников, по умолчанию member
+type ChatMembersRequest struct {
+	Chat  uuid.UUID   `json:"chat"`
+	Users []uuid.UUID `json:"users"`
+	Role  string      `json:"role"`
+}
+
+func (r ChatMembersRequest) String() string {
+	return fmt.Sprintf("{chat: %s, users: %s, role: %s}", r.Chat, r.Users, r.Role)
+}
+
+type RemoveChatMemberRequest struct {
+	Chat uuid.UUID `json:"chat"`
+	User uuid.UUID `json:"user"`
+}
+
+func (r RemoveChatMemberRequest) String() string {
+	return fmt.Sprintf("{chat: %s, user: %s}", r.Chat, r.User)
+}
+
+// роль owner передает владение чатом, прежний владелец становится admin
+type SetMemberRoleRequest struct {
+	Chat uuid.UUID `json:"chat"`
+	User uuid.UUID `json:"user"`
+	Role string    `json:"role"`
+}
+
+func (r SetMemberRoleRequest) String() string {
+	return fmt.Sprintf("{chat: %s, user: %s, role: %s}", r.Chat, r.User, r.Role)
+}
+
+type RenameChatRequest struct {
+	Chat uuid.UUID `json:"chat"`
+	Name string    `json:"name"`
+}
+
+func (r RenameChatRequest) String() string {
+	return fmt.Sprintf("{chat: %s, name: %s}", r.Chat, r.Name)
+}
+
+// ChatRename - запись истории переименований, она же payload события chat.renamed
+type ChatRename struct {
+	Chat      uuid.UUID `json:"chat"`
+	OldName   string    `json:"old_name"`
+	NewName   string    `json:"new_name"`
+	RenamedBy uuid.UUID `json:"renamed_by"`
+	CreatedAt float64   `json:"created_at"`
+}
+
+func (r ChatRename) String() string {
+	return fmt.Sprintf("{chat: %s, oldName: %s, newName: %s, renamedBy: %s, createdAt: %f}", r.Chat, r.OldName, r.NewName, r.RenamedBy, r.CreatedAt)
+}
+
+// ChatRenamesResponse - история переименований чата от ранних к поздним
+type ChatRenamesResponse struct {
+	Renames []ChatRename `json:"renames"`
+}
+
+func (r ChatRenamesResponse) String() string {
+	return fmt.Sprintf("{renames: %d}", len(r.Renames))
+}
+
+// ChatMembersResponse - участники, которые действительно добавлены (уже состоявшие пропускаются)
+type ChatMembersResponse struct {
+	Added []uuid.UUID `json:"added"`
+}
+
+func (r ChatMembersResponse) String() string {
+	return fmt.Sprintf("{added: %s}", r.Added)
+}
+
+// ChatMembersChanged - payload события chat.members_changed
+type ChatMembersChanged struct {
+	Chat    uuid.UUID   `json:"chat"`
+	Added   []uuid.UUID `json:"added"`
+	Removed []uuid.UUID `json:"removed"`
+	Users   []uuid.UUID `json:"users"`
+}
+
+func (r ChatMembersChanged) String() string {
+	return fmt.Sprintf("{chat: %s, added: %s, removed: %s, users: %d}", r.Chat, r.Added, r.Removed, len(r.Users))
+}
+
+// ChatRolesChanged - payload события chat.roles_changed
+type ChatRolesChanged struct {
+	Chat    uuid.UUID    `json:"chat"`
+	Members []ChatMember `json:"members"`
+}
+
+func (r ChatRolesChanged) String() string {
+	return fmt.Sprintf("{chat: %s, members: %v}", r.Chat, r.Members)
+}
+
+// MarkChatReadRequest - сообщение чата, до которого включительно пользователь прочитал чат
+type MarkChatReadRequest struct {
+	Chat    uuid.UUID `json:"chat"`
+	Message uuid.UUID `json:"message"`
+}
+
+func (r MarkChatReadRequest) String() string {
+	return fmt.Sprintf("{chat: %s, message: %s}", r.Chat, r.Message)
+}
+
+// ChatRead - payload события chat.read
+type ChatRead struct {
+	Chat    uuid.UUID `json:"chat"`
+	User    uuid.UUID `json:"user"`
+	Message uuid.UUID `json:"message"`
+}
+
+func (r ChatRead) String() string {
+	return fmt.Sprintf("{chat: %s, user: %s, message: %s}", r.Chat, r.User, r.Message)
+}
+
+// UsersLimit ограничивает количество участников в каждом чате (0 - все),
+// OmitUsers убирает список участников, оставляя только их количество
 type ChatListRequest struct {
-	User uuid.UUID `json: "user"`
+	User       uuid.UUID `json: "user"`
+	Limit      int       `json:"limit"`
+	Cursor     string    `json:"cursor"`
+	NamePrefix string    `json:"name_prefix"`
+	UsersLimit int       `json:"users_limit"`
+	OmitUsers  bool      `json:"omit_users"`
 }
 
 func (r ChatListRequest) String() string {
-	return fmt.Sprintf("{user: %s}", r.User)
+	return fmt.Sprintf("{user: %s, limit: %d, cursor: %s, namePrefix: %s, usersLimit: %d, omitUsers: %t}",
+		r.User, r.Limit, r.Cursor, r.NamePrefix, r.UsersLimit, r.OmitUsers)
 }
 
+// NextCursor передается в следующий запрос для загрузки чатов с более ранней активностью,
+// пустой курсор - чатов больше нет
 type ChatListResponse struct {
-	ChatList []Chat
+	ChatList   []Chat
+	NextCursor string `json:"next_cursor"`
 }
 
 func (r ChatListResponse) String() string {
-	return fmt.Sprintf("{chats: %v}", r.ChatList)
+	return fmt.Sprintf("{chats: %v, next: %s}", r.ChatList, r.NextCursor)
 }
\ No newline at end of file
@@ -1,5 +1,14 @@
 package dto
 
 type ErrorResponse struct {
-	Message string `json: "message"`
-}
\ No newline at end of file
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// FieldError описывает ошибку валидации конкретного поля запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
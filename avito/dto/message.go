@@ -5,26 +5,179 @@ import (
 	"github.com/google/uuid"
 )
 
+// виды сообщений: обычное сообщение пользователя и системные сообщения об изменении участников
+const (
+	MessageText        = "text"
+	MessageUserAdded   = "user_added"
+	MessageUserRemoved = "user_removed"
+	MessageUserLeft    = "user_left"
+	MessageChatRenamed = "chat_renamed"
+)
+
+// у системных сообщений Author - пользователь, выполнивший действие, Target - участник,
+// которого оно касается. Text пустой, кроме chat_renamed, где это новое имя чата.
+// EditedAt равно 0, если сообщение не редактировалось. У удаленного для всех сообщения
+// DeletedAt отлично от 0, а Text пустой. У ответа в треде Parent - корневое сообщение,
+// у корня ReplyCount и LastReplyAt - число ответов и время последнего из них.
+// Reactions заполняются в списках сообщений для пользователя, который их запросил
 type Message struct {
-	ID        uuid.UUID
-	Chat      uuid.UUID
-	Author    uuid.UUID
-	Text      string
-	CreatedAt float64
+	ID          uuid.UUID
+	Chat        uuid.UUID
+	Author      uuid.UUID
+	Text        string
+	CreatedAt   float64
+	Type        string     `json:"type"`
+	Target      *uuid.UUID `json:"target,omitempty"`
+	EditedAt    float64    `json:"edited_at"`
+	DeletedAt   float64    `json:"deleted_at"`
+	DeletedBy   *uuid.UUID `json:"deleted_by,omitempty"`
+	Parent      *uuid.UUID `json:"parent,omitempty"`
+	ReplyCount  int        `json:"reply_count"`
+	LastReplyAt float64    `json:"last_reply_at"`
+	Reactions   []Reaction `json:"reactions,omitempty"`
 }
 
 func (r Message) String() string {
-	return fmt.Sprintf("messageID: %s, chatID: %s, authorID: %s, text: %s, createdAt: %f", r.ID, r.Chat, r.Author, r.Text, r.CreatedAt)
+	return fmt.Sprintf("messageID: %s, chatID: %s, authorID: %s, type: %s, text: %s, createdAt: %f, editedAt: %f, deletedAt: %f, replies: %d",
+		r.ID, r.Chat, r.Author, r.Type, r.Text, r.CreatedAt, r.EditedAt, r.DeletedAt, r.ReplyCount)
+}
+
+// Reaction - сколько пользователей поставили Emoji, Me - есть ли среди них текущий пользователь
+type Reaction struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+	Me    bool   `json:"me"`
+}
+
+func (r Reaction) String() string {
+	return fmt.Sprintf("{emoji: %s, count: %d, me: %t}", r.Emoji, r.Count, r.Me)
+}
+
+type ReactionRequest struct {
+	Message uuid.UUID `json:"message"`
+	Emoji   string    `json:"emoji"`
+}
+
+func (r ReactionRequest) String() string {
+	return fmt.Sprintf("{messageID: %s, emoji: %s}", r.Message, r.Emoji)
+}
+
+// ReactionEvent - payload событий message.reaction_added и message.reaction_removed
+type ReactionEvent struct {
+	Message uuid.UUID `json:"message"`
+	User    uuid.UUID `json:"user"`
+	Emoji   string    `json:"emoji"`
+}
+
+func (r ReactionEvent) String() string {
+	return fmt.Sprintf("{messageID: %s, userID: %s, emoji: %s}", r.Message, r.User, r.Emoji)
+}
+
+// PinnedMessage - закрепленное сообщение, кто и когда его закрепил
+type PinnedMessage struct {
+	Message  Message   `json:"message"`
+	PinnedBy uuid.UUID `json:"pinned_by"`
+	PinnedAt float64   `json:"pinned_at"`
+}
+
+func (r PinnedMessage) String() string {
+	return fmt.Sprintf("{message: %s, pinnedBy: %s, pinnedAt: %f}", r.Message, r.PinnedBy, r.PinnedAt)
+}
+
+// PinnedMessagesResponse - закрепленные сообщения чата от последних закрепленных к ранним
+type PinnedMessagesResponse struct {
+	Pins []PinnedMessage `json:"pins"`
+}
+
+func (r PinnedMessagesResponse) String() string {
+	return fmt.Sprintf("{pins: %d}", len(r.Pins))
+}
+
+// PinEvent - payload событий message.pinned и message.unpinned
+type PinEvent struct {
+	Message uuid.UUID `json:"message"`
+	User    uuid.UUID `json:"user"`
+}
+
+func (r PinEvent) String() string {
+	return fmt.Sprintf("{messageID: %s, userID: %s}", r.Message, r.User)
+}
+
+type EditMessageRequest struct {
+	Message uuid.UUID `json:"message"`
+	Text    string    `json:"text"`
+}
+
+func (r EditMessageRequest) String() string {
+	return fmt.Sprintf("{messageID: %s, text: %s}", r.Message, r.Text)
+}
+
+// ForEveryone - удалить сообщение у всех участников, иначе оно скрывается только у текущего пользователя
+type DeleteMessageRequest struct {
+	Message     uuid.UUID `json:"message"`
+	ForEveryone bool      `json:"for_everyone"`
+}
+
+func (r DeleteMessageRequest) String() string {
+	return fmt.Sprintf("{messageID: %s, forEveryone: %t}", r.Message, r.ForEveryone)
+}
+
+type MessageRequest struct {
+	Message uuid.UUID `json:"message"`
+}
+
+func (r MessageRequest) String() string {
+	return fmt.Sprintf("{messageID: %s}", r.Message)
+}
+
+// ReadReceipt - участник, прочитавший сообщение, и время, когда он отметил чат прочитанным
+type ReadReceipt struct {
+	User   uuid.UUID `json:"user"`
+	ReadAt float64   `json:"read_at"`
+}
+
+func (r ReadReceipt) String() string {
+	return fmt.Sprintf("{user: %s, readAt: %f}", r.User, r.ReadAt)
+}
+
+type ReadReceiptsResponse struct {
+	Users []ReadReceipt `json:"users"`
+}
+
+func (r ReadReceiptsResponse) String() string {
+	return fmt.Sprintf("{users: %d}", len(r.Users))
+}
+
+// MessageRevision - прежняя версия текста, действовавшая до правки в EditedAt
+type MessageRevision struct {
+	Message  uuid.UUID `json:"message"`
+	Text     string    `json:"text"`
+	EditedAt float64   `json:"edited_at"`
+}
+
+func (r MessageRevision) String() string {
+	return fmt.Sprintf("{messageID: %s, text: %s, editedAt: %f}", r.Message, r.Text, r.EditedAt)
+}
+
+// MessageRevisionsResponse - прежние версии сообщения от ранних к поздним
+type MessageRevisionsResponse struct {
+	Revisions []MessageRevision `json:"revisions"`
+}
+
+func (r MessageRevisionsResponse) String() string {
+	return fmt.Sprintf("{revisions: %d}", len(r.Revisions))
 }
 
+// Parent - корневое сообщение треда, в который отправляется ответ, uuid.Nil - сообщение в ленту чата
 type SendMessageRequest struct {
 	Chat   uuid.UUID `json: "chat"`
 	Author uuid.UUID `json: "author"`
 	Text   string    `json: "text"`
+	Parent uuid.UUID `json:"parent"`
 }
 
 func (r SendMessageRequest) String() string {
-	return fmt.Sprintf("{authorID: %s, chatID: %s, text: %s}", r.Author, r.Chat, r.Text)
+	return fmt.Sprintf("{authorID: %s, chatID: %s, parentID: %s, text: %s}", r.Author, r.Chat, r.Parent, r.Text)
 }
 
 type SendMessageResponse struct {
@@ -35,18 +188,99 @@ func (r SendMessageResponse) String() string {
 	return fmt.Sprintf("{messageID: %s}", r.ID)
 }
 
+const (
+	DirectionOlder = "older"
+	DirectionNewer = "newer"
+)
+
+// RootsOnly - не возвращать ответы в тредах, только сообщения ленты чата
 type MessageListRequest struct {
-	Chat uuid.UUID `json: "chat"`
+	Chat      uuid.UUID `json: "chat"`
+	Limit     int       `json:"limit"`
+	Direction string    `json:"direction"`
+	Cursor    string    `json:"cursor"`
+	RootsOnly bool      `json:"roots_only"`
 }
 
 func (r MessageListRequest) String() string {
-	return fmt.Sprintf("{chatID: %s}", r.Chat)
+	return fmt.Sprintf("{chatID: %s, limit: %d, direction: %s, cursor: %s, rootsOnly: %t}", r.Chat, r.Limit, r.Direction, r.Cursor, r.RootsOnly)
 }
 
+// ThreadRequest - ответы на сообщение Message, пагинация такая же, как у списка сообщений
+type ThreadRequest struct {
+	Message   uuid.UUID `json:"message"`
+	Limit     int       `json:"limit"`
+	Direction string    `json:"direction"`
+	Cursor    string    `json:"cursor"`
+}
+
+func (r ThreadRequest) String() string {
+	return fmt.Sprintf("{messageID: %s, limit: %d, direction: %s, cursor: %s}", r.Message, r.Limit, r.Direction, r.Cursor)
+}
+
+type ThreadResponse struct {
+	Root       Message   `json:"root"`
+	Replies    []Message `json:"replies"`
+	NextCursor string    `json:"next_cursor"`
+	PrevCursor string    `json:"prev_cursor"`
+}
+
+func (r ThreadResponse) String() string {
+	return fmt.Sprintf("{root: %s, replies: %d, next: %s, prev: %s}", r.Root.ID, len(r.Replies), r.NextCursor, r.PrevCursor)
+}
+
+// PrevCursor передается с direction=older для загрузки более ранних сообщений,
+// NextCursor - с direction=newer для более поздних. Пустой курсор - сообщений в эту сторону нет
 type MessageListResponse struct {
 	MessageList []Message
+	NextCursor  string `json:"next_cursor"`
+	PrevCursor  string `json:"prev_cursor"`
 }
 
 func (r MessageListResponse) String() string {
-	return fmt.Sprintf("{messages: %v}", r.MessageList)
+	return fmt.Sprintf("{messages: %v, next: %s, prev: %s}", r.MessageList, r.NextCursor, r.PrevCursor)
+}
+
+// порядок результатов поиска
+const (
+	SearchOrderRelevance = "relevance"
+	SearchOrderTime      = "time"
+)
+
+// SearchMessagesRequest - поиск по тексту сообщений во всех чатах пользователя или только в Chat.
+// Author, From и To необязательны: From - не раньше, To - раньше заданного времени
+type SearchMessagesRequest struct {
+	Query  string    `json:"query"`
+	Chat   uuid.UUID `json:"chat"`
+	Author uuid.UUID `json:"author"`
+	From   float64   `json:"from"`
+	To     float64   `json:"to"`
+	Order  string    `json:"order"`
+	Limit  int       `json:"limit"`
+	Cursor string    `json:"cursor"`
+}
+
+func (r SearchMessagesRequest) String() string {
+	return fmt.Sprintf("{query: %s, chatID: %s, authorID: %s, from: %f, to: %f, order: %s, limit: %d, cursor: %s}",
+		r.Query, r.Chat, r.Author, r.From, r.To, r.Order, r.Limit, r.Cursor)
+}
+
+// SearchResult - найденное сообщение и фрагмент текста, в котором совпадения выделены тегами <mark>
+type SearchResult struct {
+	Message Message `json:"message"`
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+func (r SearchResult) String() string {
+	return fmt.Sprintf("{messageID: %s, rank: %f, snippet: %s}", r.Message.ID, r.Rank, r.Snippet)
+}
+
+type SearchMessagesResponse struct {
+	Results    []SearchResult `json:"results"`
+	NextCursor string         `json:"next_cursor"`
+}
+
+func (r SearchMessagesResponse) String() string {
+	return fmt.Sprintf("{results: %v, next: %s}", r.Results, r.NextCursor)
 }
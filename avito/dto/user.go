@@ -5,8 +5,10 @@ import (
 	"github.com/google/uuid"
 )
 
+// Password необязателен: без пароля пользователь работает только с API-токенами
 type CreateUserRequest struct {
 	Username string `json: "username"`
+	Password string `json:"password"`
 }
 
 func (r CreateUserRequest) String() string {
@@ -14,9 +16,87 @@ func (r CreateUserRequest) String() string {
 }
 
 type CreateUserResponse struct {
-	ID uuid.UUID `json: "id"`
+	ID    uuid.UUID `json: "id"`
+	Token string    `json:"token"`
 }
 
 func (r CreateUserResponse) String() string {
 	return fmt.Sprintf("{userID: %s}", r.ID)
-}
\ No newline at end of file
+}
+
+type CreateTokenResponse struct {
+	Token string `json:"token"`
+}
+
+// String не выводит сам токен, чтобы он не попадал в логи
+func (r CreateTokenResponse) String() string {
+	return "{token: ***}"
+}
+
+// User - публичные данные пользователя, DisplayName и AvatarURL пустые, если не заданы
+type User struct {
+	ID          uuid.UUID `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	CreatedAt   float64   `json:"created_at"`
+}
+
+func (r User) String() string {
+	return fmt.Sprintf("{userID: %s, username: %s, displayName: %s}", r.ID, r.Username, r.DisplayName)
+}
+
+// UserRequest - пользователь по ID или по Username, задается ровно одно из полей
+type UserRequest struct {
+	ID       uuid.UUID `json:"id"`
+	Username string    `json:"username"`
+}
+
+func (r UserRequest) String() string {
+	return fmt.Sprintf("{userID: %s, username: %s}", r.ID, r.Username)
+}
+
+type ResolveUsersRequest struct {
+	IDs []uuid.UUID `json:"ids"`
+}
+
+func (r ResolveUsersRequest) String() string {
+	return fmt.Sprintf("{userIDs: %v}", r.IDs)
+}
+
+// SearchUsersRequest - пользователи, имя которых начинается с Prefix без учета регистра
+type SearchUsersRequest struct {
+	Prefix string `json:"prefix"`
+	Limit  int    `json:"limit"`
+	Cursor string `json:"cursor"`
+}
+
+func (r SearchUsersRequest) String() string {
+	return fmt.Sprintf("{prefix: %s, limit: %d, cursor: %s}", r.Prefix, r.Limit, r.Cursor)
+}
+
+// NextCursor пустой только в ответе поиска, если пользователей больше нет
+type UsersResponse struct {
+	Users      []User `json:"users"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func (r UsersResponse) String() string {
+	return fmt.Sprintf("{users: %v, next: %s}", r.Users, r.NextCursor)
+}
+
+// UpdateProfileRequest меняет только переданные поля, пустая строка очищает поле
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+func (r UpdateProfileRequest) String() string {
+	field := func(s *string) string {
+		if s == nil {
+			return "<unchanged>"
+		}
+		return *s
+	}
+	return fmt.Sprintf("{displayName: %s, avatarURL: %s}", field(r.DisplayName), field(r.AvatarURL))
+}
@@ -0,0 +1,48 @@
+package events
+
+import (
+	"avito/storage"
+	"context"
+	"log"
+	"os"
+)
+
+// Bus - шина событий. Сервисы публикуют события внутри транзакции хранилища,
+// клиенты получают их только после коммита. Реализация отвечает за доставку события в Hub каждого экземпляра сервера
+type Bus interface {
+	Publish(ctx context.Context, tx storage.Tx, event Event) error
+	// Listen блокируется до отмены ctx и передает полученные события в Hub
+	Listen(ctx context.Context)
+}
+
+// localBus доставляет события только клиентам текущего экземпляра
+type localBus struct {
+	hub     Hub
+	members MembersFunc
+	log     *log.Logger
+}
+
+func NewLocalBus(hub Hub, members MembersFunc) Bus {
+	return &localBus{
+		hub:     hub,
+		members: members,
+		log:     log.New(os.Stdout, "LOCAL-EVENT-BUS: ", log.LstdFlags),
+	}
+}
+
+func (b *localBus) Publish(ctx context.Context, tx storage.Tx, event Event) error {
+	// рассылка не зависит от отмены запроса клиентом
+	storage.AfterCommit(tx, func() {
+		resolved, err := withRecipients(context.Background(), b.members, event)
+		if err != nil {
+			b.log.Printf("Error while get recipients of event %s, reason: %+v", event, err)
+			return
+		}
+		b.hub.Publish(resolved)
+	})
+	return nil
+}
+
+func (b *localBus) Listen(ctx context.Context) {
+	<-ctx.Done()
+}
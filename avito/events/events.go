@@ -0,0 +1,68 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+const (
+	MessageCreated     = "message.created"
+	MessageEdited      = "message.edited"
+	MessageDeleted     = "message.deleted"
+	MessageHidden      = "message.hidden"
+	ReactionAdded      = "message.reaction_added"
+	ReactionRemoved    = "message.reaction_removed"
+	MessagePinned      = "message.pinned"
+	MessageUnpinned    = "message.unpinned"
+	ChatCreated        = "chat.created"
+	ChatMembersChanged = "chat.members_changed"
+	ChatRolesChanged   = "chat.roles_changed"
+	ChatRenamed        = "chat.renamed"
+	ChatRead           = "chat.read"
+)
+
+// Event - событие, которое доставляется подключенным клиентам-участникам чата.
+// Recipients == nil означает всех участников чата на момент доставки
+type Event struct {
+	Type       string          `json:"type"`
+	Chat       uuid.UUID       `json:"chat"`
+	Recipients []uuid.UUID     `json:"-"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// MembersFunc возвращает участников чата, шина определяет через нее получателей события
+type MembersFunc func(ctx context.Context, chat uuid.UUID) ([]uuid.UUID, error)
+
+func (e Event) String() string {
+	return fmt.Sprintf("{type: %s, chatID: %s, recipients: %d}", e.Type, e.Chat, len(e.Recipients))
+}
+
+func NewEvent(eventType string, chat uuid.UUID, recipients []uuid.UUID, payload interface{}) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		Type:       eventType,
+		Chat:       chat,
+		Recipients: recipients,
+		Payload:    data,
+	}, nil
+}
+
+// withRecipients подставляет участников чата, если получатели события не заданы явно
+func withRecipients(ctx context.Context, members MembersFunc, event Event) (Event, error) {
+	if event.Recipients != nil {
+		return event, nil
+	}
+
+	recipients, err := members(ctx, event.Chat)
+	if err != nil {
+		return Event{}, err
+	}
+	event.Recipients = recipients
+	return event, nil
+}
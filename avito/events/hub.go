@@ -0,0 +1,123 @@
+package events
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"log"
+	"os"
+	"sync"
+)
+
+// Hub - реестр подписок подключенных клиентов, рассылает события получателям
+type Hub interface {
+	Subscribe(userID uuid.UUID) *Subscription
+	Unsubscribe(sub *Subscription)
+	Publish(event Event)
+}
+
+// Subscription - подписка одного соединения, у каждой свой буфер отправки
+type Subscription struct {
+	UserID uuid.UUID
+	send   chan []byte
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Messages - канал с сериализованными событиями для отправки клиенту
+func (s *Subscription) Messages() <-chan []byte {
+	return s.send
+}
+
+// Done закрывается, когда подписка отключена хабом (например, клиент не успевает читать)
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscription) close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+type hub struct {
+	mu         sync.RWMutex
+	subs       map[uuid.UUID]map[*Subscription]struct{}
+	bufferSize int
+	log        *log.Logger
+}
+
+func NewHub(bufferSize int) Hub {
+	return &hub{
+		subs:       make(map[uuid.UUID]map[*Subscription]struct{}),
+		bufferSize: bufferSize,
+		log:        log.New(os.Stdout, "EVENT-HUB: ", log.LstdFlags),
+	}
+}
+
+func (h *hub) Subscribe(userID uuid.UUID) *Subscription {
+	sub := &Subscription{
+		UserID: userID,
+		send:   make(chan []byte, h.bufferSize),
+		done:   make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*Subscription]struct{})
+	}
+	h.subs[userID][sub] = struct{}{}
+	h.log.Printf("User %s subscribed", userID)
+
+	return sub
+}
+
+func (h *hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+func (h *hub) remove(sub *Subscription) {
+	if userSubs, ok := h.subs[sub.UserID]; ok {
+		delete(userSubs, sub)
+		if len(userSubs) == 0 {
+			delete(h.subs, sub.UserID)
+		}
+	}
+	sub.close()
+}
+
+func (h *hub) Publish(event Event) {
+	frame, err := json.Marshal(event)
+	if err != nil {
+		h.log.Printf("Error while marshal event %s, reason: %v", event, err)
+		return
+	}
+
+	slow := make([]*Subscription, 0)
+	h.mu.RLock()
+	for _, userID := range event.Recipients {
+		for sub := range h.subs[userID] {
+			select {
+			case sub.send <- frame:
+			default:
+				slow = append(slow, sub)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	if len(slow) == 0 {
+		return
+	}
+
+	// клиенты, которые не успевают вычитывать буфер, отключаются,
+	// чтобы не задерживать рассылку остальным
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, sub := range slow {
+		h.log.Printf("Disconnect slow consumer, user %s", sub.UserID)
+		h.remove(sub)
+	}
+}
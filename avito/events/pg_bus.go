@@ -0,0 +1,231 @@
+package events
+
+import (
+	"avito/db"
+	"avito/storage"
+	"context"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	pgChannel        = "chat_events"
+	pgReconnectDelay = 5 * time.Second
+	// событие нужно слушателям только в момент доставки, старые строки удаляются
+	pgEventRetention    = 10 * time.Minute
+	pgEventCleanupDelay = time.Minute
+)
+
+// pgBus рассылает события всем экземплярам сервера через LISTEN/NOTIFY.
+// Событие записывается в event_outbox в транзакции сервиса, а NOTIFY с id строки
+// postgres доставляет только после коммита. Событие получает через NOTIFY и свой экземпляр,
+// поэтому каждый клиент получает его ровно один раз
+type pgBus struct {
+	db      db.ConnDB
+	hub     Hub
+	members MembersFunc
+	log     *log.Logger
+	// lastID - наибольший id доставленного события, по нему после переподключения
+	// дочитываются пропущенные события. Меняется только в горутине Listen
+	lastID    int64
+	connected bool
+}
+
+func NewPGBus(connDB db.ConnDB, hub Hub, members MembersFunc) Bus {
+	return &pgBus{
+		db:      connDB,
+		hub:     hub,
+		members: members,
+		log:     log.New(os.Stdout, "PG-EVENT-BUS: ", log.LstdFlags),
+	}
+}
+
+func (b *pgBus) Publish(ctx context.Context, tx storage.Tx, event Event) error {
+	pgTx, err := storage.PgTx(tx)
+	if err != nil {
+		return err
+	}
+
+	var id int64
+	err = pgTx.QueryRow(ctx, `insert into event_outbox (type, chat_id, recipients, payload)
+		values ($1, $2, $3, $4) returning id`, event.Type, event.Chat, event.Recipients, string(event.Payload)).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	_, err = pgTx.Exec(ctx, `select pg_notify($1, $2)`, pgChannel, strconv.FormatInt(id, 10))
+	return err
+}
+
+func (b *pgBus) Listen(ctx context.Context) {
+	go b.cleanup(ctx)
+
+	for {
+		err := b.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		b.log.Printf("Listener connection lost, reason: %+v. Reconnect in %s", err, pgReconnectDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pgReconnectDelay):
+		}
+	}
+}
+
+// listen держит отдельное соединение вне пула, т.к. LISTEN привязан к сессии
+func (b *pgBus) listen(ctx context.Context) error {
+	conn, err := pgx.ConnectConfig(ctx, b.db.DB.Config().ConnConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err = conn.Exec(ctx, "listen "+pgChannel); err != nil {
+		return err
+	}
+	b.log.Printf("Listening channel %s", pgChannel)
+
+	replayed, err := b.replay(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		id, err := strconv.ParseInt(notification.Payload, 10, 64)
+		if err != nil {
+			b.log.Printf("Error while parse notification %q, reason: %v", notification.Payload, err)
+			continue
+		}
+		// NOTIFY события, закоммиченного между LISTEN и дочитыванием, приходит уже после его доставки
+		if replayed[id] {
+			delete(replayed, id)
+			continue
+		}
+
+		event, err := b.loadEvent(ctx, conn, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			b.log.Printf("Error while load event %d, reason: %+v", id, err)
+			continue
+		}
+
+		b.deliver(id, event)
+	}
+}
+
+// replay доставляет события, NOTIFY которых пришли, пока слушатель переподключался: строки остаются
+// в event_outbox, поэтому дочитываются все id больше последнего доставленного.
+// При первом подключении дочитывать нечего, запоминается текущий последний id.
+// Возвращает id доставленных событий, чтобы не доставить их второй раз по NOTIFY
+func (b *pgBus) replay(ctx context.Context, conn *pgx.Conn) (map[int64]bool, error) {
+	if !b.connected {
+		if err := conn.QueryRow(ctx, `select coalesce(max(id), 0) from event_outbox`).Scan(&b.lastID); err != nil {
+			return nil, err
+		}
+		b.connected = true
+		return nil, nil
+	}
+
+	rows, err := conn.Query(ctx, `select id, type, chat_id, recipients, payload from event_outbox where id > $1 order by id`, b.lastID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0)
+	missed := make([]Event, 0)
+	for rows.Next() {
+		var id int64
+		event, err := scanEvent(rows, &id)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+		missed = append(missed, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	replayed := make(map[int64]bool, len(ids))
+	for i, event := range missed {
+		replayed[ids[i]] = true
+		resolved, err := withRecipients(ctx, b.members, event)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			b.log.Printf("Error while load event %d, reason: %+v", ids[i], err)
+			continue
+		}
+		b.deliver(ids[i], resolved)
+	}
+	if len(missed) > 0 {
+		b.log.Printf("Delivered %d events missed while reconnecting", len(missed))
+	}
+
+	return replayed, nil
+}
+
+func (b *pgBus) deliver(id int64, event Event) {
+	if id > b.lastID {
+		b.lastID = id
+	}
+	b.hub.Publish(event)
+}
+
+// loadEvent читает событие по id из NOTIFY и определяет получателей
+func (b *pgBus) loadEvent(ctx context.Context, conn *pgx.Conn, id int64) (Event, error) {
+	event, err := scanEvent(conn.QueryRow(ctx, `select id, type, chat_id, recipients, payload from event_outbox where id = $1`, id), &id)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return withRecipients(ctx, b.members, event)
+}
+
+func scanEvent(row pgx.Row, id *int64) (Event, error) {
+	var event Event
+	var recipients []uuid.UUID
+	var payload []byte
+	if err := row.Scan(id, &event.Type, &event.Chat, &recipients, &payload); err != nil {
+		return Event{}, err
+	}
+	event.Recipients = recipients
+	event.Payload = payload
+
+	return event, nil
+}
+
+// cleanup удаляет события, которые уже доставлены всем слушателям
+func (b *pgBus) cleanup(ctx context.Context) {
+	ticker := time.NewTicker(pgEventCleanupDelay)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := b.db.DB.Exec(ctx, `delete from event_outbox where created_at < now() - make_interval(secs => $1)`,
+				pgEventRetention.Seconds())
+			if err != nil && ctx.Err() == nil {
+				b.log.Printf("Error while delete old events, reason: %+v", err)
+			}
+		}
+	}
+}
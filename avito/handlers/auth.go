@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"avito/dto"
+	"avito/service"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"strings"
+)
+
+const bearerPrefix = "Bearer "
+
+// AuthMiddleware определяет пользователя по токену из заголовка Authorization: Bearer <token>
+// и передает его сервисам через контекст запроса. Браузеры не позволяют задать заголовки
+// при открытии WebSocket, поэтому для него токен можно передать параметром token
+func (h *handlers) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if header := r.Header.Get("Authorization"); strings.HasPrefix(header, bearerPrefix) {
+			token = strings.TrimSpace(header[len(bearerPrefix):])
+		} else if websocket.IsWebSocketUpgrade(r) {
+			token = r.URL.Query().Get("token")
+		}
+
+		identity, err := h.service.GetAuthService().Authenticate(r.Context(), token)
+		if err != nil {
+			h.log.Printf("Error while authenticate request to %s, reason: %v", r.URL.Path, err)
+			w.Header().Set("Content-Type", "application/json")
+			sendError(err, w)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(service.WithIdentity(r.Context(), identity)))
+	})
+}
+
+func (h *handlers) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var loginRequest dto.LoginRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&loginRequest)
+	if err != nil {
+		h.log.Printf("Error while parse loginRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received loginRequest: %s", loginRequest)
+
+	response, err := h.service.GetAuthService().Login(r.Context(), loginRequest)
+	if err != nil {
+		h.log.Printf("Error while login, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response for session %s", response.SessionID)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var refreshRequest dto.RefreshRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&refreshRequest)
+	if err != nil {
+		h.log.Printf("Error while parse refreshRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received refreshRequest")
+
+	response, err := h.service.GetAuthService().Refresh(r.Context(), refreshRequest)
+	if err != nil {
+		h.log.Printf("Error while refresh, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response for session %s", response.SessionID)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := h.service.GetAuthService().Logout(r.Context())
+	if err != nil {
+		h.log.Printf("Error while logout, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) GetSessionListHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	response, err := h.service.GetAuthService().GetSessionList(r.Context())
+	if err != nil {
+		h.log.Printf("Error while getSessionList, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var revokeSessionRequest dto.RevokeSessionRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&revokeSessionRequest)
+	if err != nil {
+		h.log.Printf("Error while parse revokeSessionRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received revokeSessionRequest: %s", revokeSessionRequest)
+
+	err = h.service.GetAuthService().RevokeSession(r.Context(), revokeSessionRequest)
+	if err != nil {
+		h.log.Printf("Error while revokeSession, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
-	"../dto"
-	"../service"
+	"avito/config"
+	"avito/dto"
+	"avito/events"
+	"avito/service"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -11,21 +13,60 @@ import (
 
 type Handlers interface {
 	AddNewUserHandler(w http.ResponseWriter, r *http.Request)
+	CreateTokenHandler(w http.ResponseWriter, r *http.Request)
+	GetUserHandler(w http.ResponseWriter, r *http.Request)
+	ResolveUsersHandler(w http.ResponseWriter, r *http.Request)
+	SearchUsersHandler(w http.ResponseWriter, r *http.Request)
+	UpdateProfileHandler(w http.ResponseWriter, r *http.Request)
 	CreateChatHandler(w http.ResponseWriter, r *http.Request)
 	SendMessageHandler(w http.ResponseWriter, r *http.Request)
 
 	GetChatListHandler(w http.ResponseWriter, r *http.Request)
+	GetChatHandler(w http.ResponseWriter, r *http.Request)
+	AddChatMembersHandler(w http.ResponseWriter, r *http.Request)
+	RemoveChatMemberHandler(w http.ResponseWriter, r *http.Request)
+	SetMemberRoleHandler(w http.ResponseWriter, r *http.Request)
+	LeaveChatHandler(w http.ResponseWriter, r *http.Request)
+	RenameChatHandler(w http.ResponseWriter, r *http.Request)
+	OpenDirectChatHandler(w http.ResponseWriter, r *http.Request)
+	GetChatRenamesHandler(w http.ResponseWriter, r *http.Request)
+	MarkChatReadHandler(w http.ResponseWriter, r *http.Request)
 	GetMessageListHandler(w http.ResponseWriter, r *http.Request)
+	GetThreadHandler(w http.ResponseWriter, r *http.Request)
+	EditMessageHandler(w http.ResponseWriter, r *http.Request)
+	GetMessageRevisionsHandler(w http.ResponseWriter, r *http.Request)
+	GetReadReceiptsHandler(w http.ResponseWriter, r *http.Request)
+	SearchMessagesHandler(w http.ResponseWriter, r *http.Request)
+	DeleteMessageHandler(w http.ResponseWriter, r *http.Request)
+	AddReactionHandler(w http.ResponseWriter, r *http.Request)
+	RemoveReactionHandler(w http.ResponseWriter, r *http.Request)
+	PinMessageHandler(w http.ResponseWriter, r *http.Request)
+	UnpinMessageHandler(w http.ResponseWriter, r *http.Request)
+	GetPinnedMessagesHandler(w http.ResponseWriter, r *http.Request)
+
+	WebSocketHandler(w http.ResponseWriter, r *http.Request)
+
+	LoginHandler(w http.ResponseWriter, r *http.Request)
+	RefreshHandler(w http.ResponseWriter, r *http.Request)
+	LogoutHandler(w http.ResponseWriter, r *http.Request)
+	GetSessionListHandler(w http.ResponseWriter, r *http.Request)
+	RevokeSessionHandler(w http.ResponseWriter, r *http.Request)
+
+	AuthMiddleware(next http.Handler) http.Handler
 }
 
 type handlers struct {
 	service service.ServiceAPI
+	hub events.Hub
+	wsConfig config.WSConfig
 	log *log.Logger
 }
 
-func NewHandlers(api service.ServiceAPI) Handlers {
+func NewHandlers(api service.ServiceAPI, hub events.Hub, wsConfig config.WSConfig) Handlers {
 	return &handlers{
 		service: api,
+		hub: hub,
+		wsConfig: wsConfig,
 		log: log.New(os.Stdout, "CONTROLLER: ", log.LstdFlags),
 	}
 }
@@ -40,21 +81,132 @@ func (h *handlers) AddNewUserHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		h.log.Printf("Error while parse createUserRequest, reason: %v", err)
-		response := &dto.ErrorResponse{Message: "Cannot parse request body"}
-		sendResponse(http.StatusBadRequest, response, w)
+		sendBadRequest("Cannot parse request body", w)
 		return
 	}
 	h.log.Printf("Received createUserRequest: %s", createUserRequest)
 
-	userID, err, isInternal := h.service.GetUserService().CreateUser(createUserRequest)
+	response, err := h.service.GetUserService().CreateUser(r.Context(), createUserRequest)
 	if err != nil {
 		h.log.Printf("Error while createUser, reason: %v", err)
-		response := &dto.ErrorResponse{Message: err.Error()}
-		sendResponse(getErrorStatus(isInternal), response, w)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) CreateTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	response, err := h.service.GetAuthService().CreateToken(r.Context())
+	if err != nil {
+		h.log.Printf("Error while createToken, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var userRequest dto.UserRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&userRequest)
+	if err != nil {
+		h.log.Printf("Error while parse userRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received userRequest: %s", userRequest)
+
+	response, err := h.service.GetUserService().GetUser(r.Context(), userRequest)
+	if err != nil {
+		h.log.Printf("Error while getUser, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) ResolveUsersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var resolveUsersRequest dto.ResolveUsersRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&resolveUsersRequest)
+	if err != nil {
+		h.log.Printf("Error while parse resolveUsersRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received resolveUsersRequest: %s", resolveUsersRequest)
+
+	response, err := h.service.GetUserService().ResolveUsers(r.Context(), resolveUsersRequest)
+	if err != nil {
+		h.log.Printf("Error while resolveUsers, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) SearchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var searchUsersRequest dto.SearchUsersRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&searchUsersRequest)
+	if err != nil {
+		h.log.Printf("Error while parse searchUsersRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received searchUsersRequest: %s", searchUsersRequest)
+
+	response, err := h.service.GetUserService().SearchUsers(r.Context(), searchUsersRequest)
+	if err != nil {
+		h.log.Printf("Error while searchUsers, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var updateProfileRequest dto.UpdateProfileRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&updateProfileRequest)
+	if err != nil {
+		h.log.Printf("Error while parse updateProfileRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received updateProfileRequest: %s", updateProfileRequest)
+
+	response, err := h.service.GetUserService().UpdateProfile(r.Context(), updateProfileRequest)
+	if err != nil {
+		h.log.Printf("Error while updateProfile, reason: %v", err)
+		sendError(err, w)
 		return
 	}
 
-	response := &dto.CreateUserResponse{ID: userID}
 	h.log.Printf("Send response: %v", response)
 	sendResponse(http.StatusOK, response, w)
 }
@@ -68,17 +220,15 @@ func (h *handlers) CreateChatHandler(w http.ResponseWriter, r *http.Request) {
 	err := dec.Decode(&createChatRequest)
 	if err != nil {
 		h.log.Printf("Error while parse createChatRequest, reason: %v", err)
-		response := &dto.ErrorResponse{Message: "Cannot parse request"}
-		sendResponse(http.StatusBadRequest, response, w)
+		sendBadRequest("Cannot parse request", w)
 		return
 	}
 	h.log.Printf("Received createChatRequest: %s", createChatRequest)
 
-	chatID, err, isInternal := h.service.GetChatService().CreateChat(createChatRequest)
+	chatID, err := h.service.GetChatService().CreateChat(r.Context(), createChatRequest)
 	if err != nil {
 		h.log.Printf("Error while createChat, reason: %v", err)
-		response := &dto.ErrorResponse{Message: err.Error()}
-		sendResponse(getErrorStatus(isInternal), response, w)
+		sendError(err, w)
 		return
 	}
 
@@ -97,17 +247,15 @@ func (h *handlers) SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		h.log.Printf("Error while parse sendMessageRequest, reason: %v", err)
-		response := &dto.ErrorResponse{Message: "Cannot parse request"}
-		sendResponse(http.StatusBadRequest, response, w)
+		sendBadRequest("Cannot parse request", w)
 		return
 	}
 	h.log.Printf("Received sendMessageRequest: %s", sendMessageRequest)
 
-	messageID, err, isInternal := h.service.GetMessageService().SendMessage(sendMessageRequest)
+	messageID, err := h.service.GetMessageService().SendMessage(r.Context(), sendMessageRequest)
 	if err != nil {
 		h.log.Printf("Error while send message, reason: %v", err)
-		response := &dto.ErrorResponse{Message: err.Error()}
-		sendResponse(getErrorStatus(isInternal), response, w)
+		sendError(err, w)
 		return
 	}
 
@@ -126,21 +274,238 @@ func (h *handlers) GetChatListHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		h.log.Printf("Error while parse chatListRequest, reason, %v", err)
-		response := &dto.ErrorResponse{Message: "Cannot parse request"}
-		sendResponse(http.StatusBadRequest, response, w)
+		sendBadRequest("Cannot parse request", w)
 		return
 	}
 	h.log.Printf("Received chatListRequest: %s", chatListRequest)
 
-	chats, err, isInternal := h.service.GetChatService().GetChatList(chatListRequest)
+	response, err := h.service.GetChatService().GetChatList(r.Context(), chatListRequest)
 	if err != nil {
 		h.log.Printf("Error while getChatList, reason: %v", err)
-		response := &dto.ErrorResponse{Message: err.Error()}
-		sendResponse(getErrorStatus(isInternal), response, w)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) GetChatHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var chatRequest dto.ChatRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&chatRequest)
+	if err != nil {
+		h.log.Printf("Error while parse chatRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received chatRequest: %s", chatRequest)
+
+	response, err := h.service.GetChatService().GetChat(r.Context(), chatRequest)
+	if err != nil {
+		h.log.Printf("Error while getChat, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) AddChatMembersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var chatMembersRequest dto.ChatMembersRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&chatMembersRequest)
+	if err != nil {
+		h.log.Printf("Error while parse chatMembersRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received chatMembersRequest: %s", chatMembersRequest)
+
+	response, err := h.service.GetChatService().AddChatMembers(r.Context(), chatMembersRequest)
+	if err != nil {
+		h.log.Printf("Error while addChatMembers, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) RemoveChatMemberHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var removeChatMemberRequest dto.RemoveChatMemberRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&removeChatMemberRequest)
+	if err != nil {
+		h.log.Printf("Error while parse removeChatMemberRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received removeChatMemberRequest: %s", removeChatMemberRequest)
+
+	err = h.service.GetChatService().RemoveChatMember(r.Context(), removeChatMemberRequest)
+	if err != nil {
+		h.log.Printf("Error while removeChatMember, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) SetMemberRoleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var setMemberRoleRequest dto.SetMemberRoleRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&setMemberRoleRequest)
+	if err != nil {
+		h.log.Printf("Error while parse setMemberRoleRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received setMemberRoleRequest: %s", setMemberRoleRequest)
+
+	err = h.service.GetChatService().SetMemberRole(r.Context(), setMemberRoleRequest)
+	if err != nil {
+		h.log.Printf("Error while setMemberRole, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) LeaveChatHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var chatRequest dto.ChatRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&chatRequest)
+	if err != nil {
+		h.log.Printf("Error while parse chatRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received leave chatRequest: %s", chatRequest)
+
+	err = h.service.GetChatService().LeaveChat(r.Context(), chatRequest)
+	if err != nil {
+		h.log.Printf("Error while leaveChat, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) RenameChatHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var renameChatRequest dto.RenameChatRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&renameChatRequest)
+	if err != nil {
+		h.log.Printf("Error while parse renameChatRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received renameChatRequest: %s", renameChatRequest)
+
+	err = h.service.GetChatService().RenameChat(r.Context(), renameChatRequest)
+	if err != nil {
+		h.log.Printf("Error while renameChat, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) GetChatRenamesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var chatRequest dto.ChatRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&chatRequest)
+	if err != nil {
+		h.log.Printf("Error while parse chatRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received renames chatRequest: %s", chatRequest)
+
+	response, err := h.service.GetChatService().GetChatRenames(r.Context(), chatRequest)
+	if err != nil {
+		h.log.Printf("Error while getChatRenames, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) MarkChatReadHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var markChatReadRequest dto.MarkChatReadRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&markChatReadRequest)
+	if err != nil {
+		h.log.Printf("Error while parse markChatReadRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received markChatReadRequest: %s", markChatReadRequest)
+
+	err = h.service.GetChatService().MarkChatRead(r.Context(), markChatReadRequest)
+	if err != nil {
+		h.log.Printf("Error while markChatRead, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) OpenDirectChatHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var directChatRequest dto.DirectChatRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&directChatRequest)
+	if err != nil {
+		h.log.Printf("Error while parse directChatRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received directChatRequest: %s", directChatRequest)
+
+	response, err := h.service.GetChatService().OpenDirectChat(r.Context(), directChatRequest)
+	if err != nil {
+		h.log.Printf("Error while openDirectChat, reason: %v", err)
+		sendError(err, w)
 		return
 	}
 
-	response := &dto.ChatListResponse{ChatList: chats}
 	h.log.Printf("Send response: %v", response)
 	sendResponse(http.StatusOK, response, w)
 }
@@ -155,21 +520,288 @@ func (h *handlers) GetMessageListHandler(w http.ResponseWriter, r *http.Request)
 
 	if err != nil {
 		h.log.Printf("Error while parse getMessageListRequest, reason: %v", err)
-		response := &dto.ErrorResponse{Message: "Cannot parse request"}
-		sendResponse(http.StatusBadRequest, response, w)
+		sendBadRequest("Cannot parse request", w)
 		return
 	}
 	h.log.Printf("Received messageListRequest: %s", messageListRequest)
 
-	messages, err, isInternal := h.service.GetMessageService().GetMessageList(messageListRequest)
+	response, err := h.service.GetMessageService().GetMessageList(r.Context(), messageListRequest)
 	if err != nil {
 		h.log.Printf("Error while getMessageList, reason: %v", err)
-		response := &dto.ErrorResponse {Message: err.Error()}
-		sendResponse(getErrorStatus(isInternal), response, w)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) GetThreadHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var threadRequest dto.ThreadRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&threadRequest)
+	if err != nil {
+		h.log.Printf("Error while parse threadRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received threadRequest: %s", threadRequest)
+
+	response, err := h.service.GetMessageService().GetThread(r.Context(), threadRequest)
+	if err != nil {
+		h.log.Printf("Error while getThread, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) EditMessageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var editMessageRequest dto.EditMessageRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&editMessageRequest)
+	if err != nil {
+		h.log.Printf("Error while parse editMessageRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received editMessageRequest: %s", editMessageRequest)
+
+	response, err := h.service.GetMessageService().EditMessage(r.Context(), editMessageRequest)
+	if err != nil {
+		h.log.Printf("Error while editMessage, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) GetMessageRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var messageRequest dto.MessageRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&messageRequest)
+	if err != nil {
+		h.log.Printf("Error while parse messageRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received revisions messageRequest: %s", messageRequest)
+
+	response, err := h.service.GetMessageService().GetMessageRevisions(r.Context(), messageRequest)
+	if err != nil {
+		h.log.Printf("Error while getMessageRevisions, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) GetReadReceiptsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var messageRequest dto.MessageRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&messageRequest)
+	if err != nil {
+		h.log.Printf("Error while parse messageRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received read receipts messageRequest: %s", messageRequest)
+
+	response, err := h.service.GetMessageService().GetReadReceipts(r.Context(), messageRequest)
+	if err != nil {
+		h.log.Printf("Error while getReadReceipts, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) SearchMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var searchRequest dto.SearchMessagesRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&searchRequest)
+	if err != nil {
+		h.log.Printf("Error while parse searchMessagesRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received searchMessagesRequest: %s", searchRequest)
+
+	response, err := h.service.GetMessageService().SearchMessages(r.Context(), searchRequest)
+	if err != nil {
+		h.log.Printf("Error while searchMessages, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	h.log.Printf("Send response: %v", response)
+	sendResponse(http.StatusOK, response, w)
+}
+
+func (h *handlers) DeleteMessageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var deleteMessageRequest dto.DeleteMessageRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&deleteMessageRequest)
+	if err != nil {
+		h.log.Printf("Error while parse deleteMessageRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received deleteMessageRequest: %s", deleteMessageRequest)
+
+	err = h.service.GetMessageService().DeleteMessage(r.Context(), deleteMessageRequest)
+	if err != nil {
+		h.log.Printf("Error while deleteMessage, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) AddReactionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var reactionRequest dto.ReactionRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&reactionRequest)
+	if err != nil {
+		h.log.Printf("Error while parse reactionRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received add reactionRequest: %s", reactionRequest)
+
+	err = h.service.GetMessageService().AddReaction(r.Context(), reactionRequest)
+	if err != nil {
+		h.log.Printf("Error while addReaction, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) RemoveReactionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var reactionRequest dto.ReactionRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&reactionRequest)
+	if err != nil {
+		h.log.Printf("Error while parse reactionRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received remove reactionRequest: %s", reactionRequest)
+
+	err = h.service.GetMessageService().RemoveReaction(r.Context(), reactionRequest)
+	if err != nil {
+		h.log.Printf("Error while removeReaction, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) PinMessageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var messageRequest dto.MessageRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&messageRequest)
+	if err != nil {
+		h.log.Printf("Error while parse messageRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received pin messageRequest: %s", messageRequest)
+
+	err = h.service.GetMessageService().PinMessage(r.Context(), messageRequest)
+	if err != nil {
+		h.log.Printf("Error while pinMessage, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) UnpinMessageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var messageRequest dto.MessageRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&messageRequest)
+	if err != nil {
+		h.log.Printf("Error while parse messageRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received unpin messageRequest: %s", messageRequest)
+
+	err = h.service.GetMessageService().UnpinMessage(r.Context(), messageRequest)
+	if err != nil {
+		h.log.Printf("Error while unpinMessage, reason: %v", err)
+		sendError(err, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handlers) GetPinnedMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var chatRequest dto.ChatRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&chatRequest)
+	if err != nil {
+		h.log.Printf("Error while parse chatRequest, reason: %v", err)
+		sendBadRequest("Cannot parse request", w)
+		return
+	}
+	h.log.Printf("Received pinned chatRequest: %s", chatRequest)
+
+	response, err := h.service.GetMessageService().GetPinnedMessages(r.Context(), chatRequest)
+	if err != nil {
+		h.log.Printf("Error while getPinnedMessages, reason: %v", err)
+		sendError(err, w)
 		return
 	}
 
-	response := &dto.MessageListResponse{MessageList: messages}
 	h.log.Printf("Send response: %v", response)
 	sendResponse(http.StatusOK, response, w)
 }
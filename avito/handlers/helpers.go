@@ -1,11 +1,48 @@
 package handlers
 
-import "net/http"
+import (
+	"avito/dto"
+	"avito/service"
+	"errors"
+	"net/http"
+)
 
-func getErrorStatus(isInternal bool) int {
-	if !isInternal {
-		return http.StatusBadRequest
+// коды ошибок, которые возникают до вызова сервисов
+const (
+	codeInvalidRequest = "invalid_request"
+)
+
+func getErrorStatus(kind service.ErrorKind) int {
+	switch kind {
+	case service.KindValidation:
+		return http.StatusUnprocessableEntity
+	case service.KindNotFound:
+		return http.StatusNotFound
+	case service.KindConflict:
+		return http.StatusConflict
+	case service.KindForbidden:
+		return http.StatusForbidden
+	case service.KindUnauthorized:
+		return http.StatusUnauthorized
+	case service.KindTimeout:
+		return http.StatusGatewayTimeout
 	}
 
 	return http.StatusInternalServerError
 }
+
+// sendError отправляет ошибку сервиса. Ошибки не типа *service.Error считаются внутренними
+func sendError(err error, w http.ResponseWriter) {
+	var serviceErr *service.Error
+	if !errors.As(err, &serviceErr) {
+		sendResponse(http.StatusInternalServerError, &dto.ErrorResponse{Code: service.CodeInternal, Message: "System error. Contact support"}, w)
+		return
+	}
+
+	response := &dto.ErrorResponse{Code: serviceErr.Code, Message: serviceErr.Message, Details: serviceErr.Details}
+	sendResponse(getErrorStatus(serviceErr.Kind), response, w)
+}
+
+func sendBadRequest(message string, w http.ResponseWriter) {
+	sendResponse(http.StatusBadRequest, &dto.ErrorResponse{Code: codeInvalidRequest, Message: message}, w)
+}
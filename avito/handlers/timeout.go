@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"avito/config"
+	"context"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// TimeoutMiddleware ограничивает время обработки запроса. Контекст запроса отменяется по таймауту
+// или при отключении клиента, вместе с ним прерываются и запросы к базе
+func TimeoutMiddleware(timeouts config.TimeoutConfig) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := timeouts.RequestTimeout
+			if route := mux.CurrentRoute(r); route != nil {
+				if path, err := route.GetPathTemplate(); err == nil {
+					if endpointTimeout, ok := timeouts.EndpointTimeouts[path]; ok {
+						timeout = endpointTimeout
+					}
+				}
+			}
+
+			if timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
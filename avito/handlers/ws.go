@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"avito/dto"
+	"avito/events"
+	"avito/service"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"time"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+func (h *handlers) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	// пользователь проверяется в AuthMiddleware, без него подписка не открывается
+	userID, ok := service.UserFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		sendResponse(http.StatusUnauthorized, &dto.ErrorResponse{Code: service.CodeUnauthorized, Message: "Authentication required"}, w)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.log.Printf("Error while upgrade connection, reason: %v", err)
+		return
+	}
+	h.log.Printf("User %s connected to ws", userID)
+
+	sub := h.hub.Subscribe(userID)
+	closed := make(chan struct{})
+	go h.readLoop(conn, userID, closed)
+	h.writeLoop(conn, sub, closed)
+
+	h.hub.Unsubscribe(sub)
+	conn.Close()
+	h.log.Printf("User %s disconnected from ws", userID)
+}
+
+// readLoop нужен только для обработки control-фреймов и обнаружения закрытия соединения,
+// входящие сообщения от клиента игнорируются
+func (h *handlers) readLoop(conn *websocket.Conn, userID uuid.UUID, closed chan<- struct{}) {
+	defer close(closed)
+
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(h.wsConfig.PingPeriod * 2))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(h.wsConfig.PingPeriod * 2))
+	})
+
+	for {
+		if _, _, err := conn.NextReader(); err != nil {
+			h.log.Printf("Stop reading ws of user %s, reason: %v", userID, err)
+			return
+		}
+	}
+}
+
+func (h *handlers) writeLoop(conn *websocket.Conn, sub *events.Subscription, closed <-chan struct{}) {
+	ticker := time.NewTicker(h.wsConfig.PingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case frame := <-sub.Messages():
+			conn.SetWriteDeadline(time.Now().Add(h.wsConfig.WriteTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(h.wsConfig.WriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-sub.Done():
+			conn.SetWriteDeadline(time.Now().Add(h.wsConfig.WriteTimeout))
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "slow consumer"))
+			return
+		}
+	}
+}
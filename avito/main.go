@@ -1,16 +1,20 @@
 package main
 
 import (
-	"./config"
-	"./db"
-	"./handlers"
-	"./service"
-	"./storage"
+	"avito/config"
+	"avito/db"
+	"avito/events"
+	"avito/handlers"
+	"avito/migrations"
+	"avito/service"
+	"avito/storage"
 	"context"
 	"fmt"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 )
 
 func main() {
@@ -21,26 +25,167 @@ func main() {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	pgConn := db.NewConnectToPG(&applicationConfig.DB, ctx)
 
-	storageAPI := storage.NewStorageAPI(pgConn, ctx)
-	serviceAPI := service.NewServiceAPI(storageAPI)
+	var storageAPI storage.StorageAPI
+	var migrator *migrations.Migrator
+	var pgConn db.ConnDB
+	switch applicationConfig.StorageDriver {
+	case "postgres":
+		pgConn = db.NewConnectToPG(&applicationConfig.DB, ctx)
+		migrator, err = migrations.NewPGMigrator(pgConn)
+		storageAPI = storage.NewStorageAPI(pgConn)
+	case "sqlite":
+		sqliteDB := db.NewConnectToSQLite(applicationConfig.SQLitePath)
+		migrator, err = migrations.NewSQLiteMigrator(sqliteDB)
+		storageAPI = storage.NewSQLiteStorageAPI(sqliteDB)
+	case "memory":
+		storageAPI = storage.NewMemoryStorageAPI()
+	default:
+		log.Fatalf("Unknown storage driver: %s", applicationConfig.StorageDriver)
+	}
+	if err != nil {
+		log.Fatalf("Cannot load migrations: %+v", err)
+	}
+
+	// ./server migrate up | down [n] | status - ручное управление миграциями без запуска сервера
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if migrator == nil {
+			log.Fatalf("Storage driver %s has no migrations", applicationConfig.StorageDriver)
+		}
+		if err := runMigrate(ctx, migrator, os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %+v", err)
+		}
+		return
+	}
+
+	if migrator != nil {
+		if err := migrator.Up(ctx); err != nil {
+			log.Fatalf("Cannot apply migrations: %+v", err)
+		}
+	}
+
+	hub := events.NewHub(applicationConfig.WS.SendBuffer)
+	var bus events.Bus
+	switch applicationConfig.EventBus {
+	case "local":
+		bus = events.NewLocalBus(hub, storageAPI.GetChatStorage().GetChatUsers)
+	case "postgres":
+		if applicationConfig.StorageDriver != "postgres" {
+			log.Fatalf("Event bus postgres requires storage driver postgres")
+		}
+		bus = events.NewPGBus(pgConn, hub, storageAPI.GetChatStorage().GetChatUsers)
+	default:
+		log.Fatalf("Unknown event bus: %s", applicationConfig.EventBus)
+	}
+	go bus.Listen(ctx)
+
+	serviceAPI := service.NewServiceAPI(storageAPI, bus, applicationConfig.Auth, applicationConfig.Messages)
+	go service.RunMessagePurge(ctx, serviceAPI.GetMessageService(), applicationConfig.Messages)
 
-	a := handlers.NewHandlers(serviceAPI)
+	a := handlers.NewHandlers(serviceAPI, hub, applicationConfig.WS)
 
 	r := mux.NewRouter()
-	// добавление нового пользователя
+	r.Use(handlers.TimeoutMiddleware(applicationConfig.Timeouts))
+	// добавление нового пользователя, в ответе возвращается токен для остальных методов
 	r.HandleFunc("/users/add", a.AddNewUserHandler).Methods("POST")
+	// вход по логину и паролю, создает сессию с access и refresh токенами
+	r.HandleFunc("/auth/login", a.LoginHandler).Methods("POST")
+	// обмен refresh токена на новую пару токенов
+	r.HandleFunc("/auth/refresh", a.RefreshHandler).Methods("POST")
+
+	// остальные методы выполняются от имени пользователя, определенного по токену
+	authorized := r.NewRoute().Subrouter()
+	authorized.Use(a.AuthMiddleware)
+	// выдача нового токена текущему пользователю
+	authorized.HandleFunc("/tokens/add", a.CreateTokenHandler).Methods("POST")
+	// справочник пользователей: пользователь по id или имени, несколько пользователей по id, поиск по началу имени
+	authorized.HandleFunc("/users/get", a.GetUserHandler).Methods("POST")
+	authorized.HandleFunc("/users/resolve", a.ResolveUsersHandler).Methods("POST")
+	authorized.HandleFunc("/users/search", a.SearchUsersHandler).Methods("POST")
+	// изменение профиля текущего пользователя
+	authorized.HandleFunc("/users/profile", a.UpdateProfileHandler).Methods("POST")
+	// завершение текущей сессии
+	authorized.HandleFunc("/auth/logout", a.LogoutHandler).Methods("POST")
+	// список активных сессий пользователя и отзыв сессии
+	authorized.HandleFunc("/auth/sessions/get", a.GetSessionListHandler).Methods("POST")
+	authorized.HandleFunc("/auth/sessions/delete", a.RevokeSessionHandler).Methods("POST")
 	// создание чата между пользователями
-	r.HandleFunc("/chats/add", a.CreateChatHandler).Methods("POST")
+	authorized.HandleFunc("/chats/add", a.CreateChatHandler).Methods("POST")
+	// личный чат с пользователем: существующий или новый
+	authorized.HandleFunc("/dm", a.OpenDirectChatHandler).Methods("POST")
 	// отправление сообщения от лица пользователя
-	r.HandleFunc("/messages/add", a.SendMessageHandler).Methods("POST")
+	authorized.HandleFunc("/messages/add", a.SendMessageHandler).Methods("POST")
 	// получение списка чатов конкретного пользователя
-	r.HandleFunc("/chats/get", a.GetChatListHandler).Methods("POST")
+	authorized.HandleFunc("/chats/get", a.GetChatListHandler).Methods("POST")
+	// получение чата с участниками, доступно только участникам
+	authorized.HandleFunc("/chats/info", a.GetChatHandler).Methods("POST")
+	// приглашение и удаление участников, выход из чата
+	authorized.HandleFunc("/chats/members/add", a.AddChatMembersHandler).Methods("POST")
+	authorized.HandleFunc("/chats/members/delete", a.RemoveChatMemberHandler).Methods("POST")
+	// изменение роли участника и передача владения чатом
+	authorized.HandleFunc("/chats/members/role", a.SetMemberRoleHandler).Methods("POST")
+	authorized.HandleFunc("/chats/leave", a.LeaveChatHandler).Methods("POST")
+	// переименование чата и история переименований
+	authorized.HandleFunc("/chats/rename", a.RenameChatHandler).Methods("POST")
+	authorized.HandleFunc("/chats/renames/get", a.GetChatRenamesHandler).Methods("POST")
+	// отметка о прочтении чата до сообщения
+	authorized.HandleFunc("/chats/read", a.MarkChatReadHandler).Methods("POST")
 	// получение списка сообщений конкретного чата
-	r.HandleFunc("/messages/get", a.GetMessageListHandler).Methods("POST")
+	authorized.HandleFunc("/messages/get", a.GetMessageListHandler).Methods("POST")
+	// ответы в треде сообщения
+	authorized.HandleFunc("/messages/thread/get", a.GetThreadHandler).Methods("POST")
+	// редактирование сообщения автором и история правок
+	authorized.HandleFunc("/messages/edit", a.EditMessageHandler).Methods("POST")
+	authorized.HandleFunc("/messages/revisions/get", a.GetMessageRevisionsHandler).Methods("POST")
+	// удаление сообщения у всех участников или скрытие только у себя
+	authorized.HandleFunc("/messages/delete", a.DeleteMessageHandler).Methods("POST")
+	// реакции на сообщение
+	authorized.HandleFunc("/messages/reactions/add", a.AddReactionHandler).Methods("POST")
+	authorized.HandleFunc("/messages/reactions/delete", a.RemoveReactionHandler).Methods("POST")
+	// закрепление сообщений владельцем и администраторами, список закрепленных
+	authorized.HandleFunc("/messages/pins/add", a.PinMessageHandler).Methods("POST")
+	authorized.HandleFunc("/messages/pins/delete", a.UnpinMessageHandler).Methods("POST")
+	authorized.HandleFunc("/messages/pins/get", a.GetPinnedMessagesHandler).Methods("POST")
+	// участники, прочитавшие сообщение
+	authorized.HandleFunc("/messages/read_by/get", a.GetReadReceiptsHandler).Methods("POST")
+	// полнотекстовый поиск по сообщениям чатов пользователя
+	authorized.HandleFunc("/messages/search", a.SearchMessagesHandler).Methods("POST")
+	// подписка на новые сообщения, чаты и изменения участников по WebSocket
+	authorized.HandleFunc("/ws", a.WebSocketHandler).Methods("GET")
 	http.Handle("/", r)
 
 	fmt.Println("Server is listening...")
 	http.ListenAndServe(fmt.Sprintf(":%d", applicationConfig.HTTPPort), nil)
 }
+
+func runMigrate(ctx context.Context, migrator *migrations.Migrator, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up | down [n] | status")
+	}
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+			steps = n
+		}
+		return migrator.Down(ctx, steps)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			fmt.Println(status)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command: %s", args[0])
+	}
+}
@@ -0,0 +1,206 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"golang.org/x/xerrors"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// файлы миграций: <dialect>/<version>_<name>.up.sql и <dialect>/<version>_<name>.down.sql
+//
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+var fileNameRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+func (s Status) String() string {
+	applied := "pending"
+	if s.AppliedAt != nil {
+		applied = "applied at " + s.AppliedAt.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%04d_%s: %s", s.Version, s.Name, applied)
+}
+
+// driver - операции с базой, которые зависят от СУБД
+type driver interface {
+	// lock не дает нескольким экземплярам сервера применять миграции одновременно
+	lock(ctx context.Context) (func(), error)
+	ensureTable(ctx context.Context) error
+	applied(ctx context.Context) (map[int]time.Time, error)
+	// apply выполняет sql и отмечает версию примененной (up) или откатанной в одной транзакции
+	apply(ctx context.Context, m Migration, sql string, up bool) error
+}
+
+type Migrator struct {
+	driver     driver
+	migrations []Migration
+	log        *log.Logger
+}
+
+func newMigrator(dialect string, d driver) (*Migrator, error) {
+	migrations, err := load(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		driver:     d,
+		migrations: migrations,
+		log:        log.New(os.Stdout, "MIGRATIONS: ", log.LstdFlags),
+	}, nil
+}
+
+func load(dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dialect)
+	if err != nil {
+		return nil, xerrors.Errorf("Cannot read migrations of %s: %w", dialect, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileNameRegexp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, xerrors.Errorf("Invalid migration file name: %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+
+		content, err := fs.ReadFile(files, path.Join(dialect, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, xerrors.Errorf("Migration %d has different names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if len(m.Up) == 0 || len(m.Down) == 0 {
+			return nil, xerrors.Errorf("Migration %04d_%s must have up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func (m *Migrator) prepare(ctx context.Context) (func(), map[int]time.Time, error) {
+	unlock, err := m.driver.lock(ctx)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("Cannot acquire migrations lock: %w", err)
+	}
+
+	if err := m.driver.ensureTable(ctx); err != nil {
+		unlock()
+		return nil, nil, xerrors.Errorf("Cannot create schema_migrations: %w", err)
+	}
+
+	applied, err := m.driver.applied(ctx)
+	if err != nil {
+		unlock()
+		return nil, nil, xerrors.Errorf("Cannot read applied migrations: %w", err)
+	}
+
+	return unlock, applied, nil
+}
+
+// Up применяет все еще не примененные миграции по возрастанию версии
+func (m *Migrator) Up(ctx context.Context) error {
+	unlock, applied, err := m.prepare(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		m.log.Printf("Applying %04d_%s", migration.Version, migration.Name)
+		if err := m.driver.apply(ctx, migration, migration.Up, true); err != nil {
+			return xerrors.Errorf("Cannot apply migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Down откатывает steps последних примененных миграций
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	unlock, applied, err := m.prepare(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		m.log.Printf("Rolling back %04d_%s", migration.Version, migration.Name)
+		if err := m.driver.apply(ctx, migration, migration.Down, false); err != nil {
+			return xerrors.Errorf("Cannot rollback migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		steps--
+	}
+
+	return nil
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	unlock, applied, err := m.prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
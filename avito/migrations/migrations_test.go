@@ -0,0 +1,111 @@
+package migrations
+
+import (
+	"avito/db"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	for _, dialect := range []string{"postgres", "sqlite"} {
+		migrations, err := load(dialect)
+		if err != nil {
+			t.Fatalf("Cannot load %s migrations: %+v", dialect, err)
+		}
+		// версии идут подряд с первой, пропуск означает потерянный файл
+		for i, migration := range migrations {
+			if migration.Version != i+1 {
+				t.Errorf("%s migration %04d_%s has version %d, expected %d", dialect, migration.Version, migration.Name, migration.Version, i+1)
+			}
+		}
+	}
+}
+
+func TestSQLiteMigrationsUpDown(t *testing.T) {
+	ctx := context.Background()
+	sqliteDB := db.NewConnectToSQLite(filepath.Join(t.TempDir(), "test.db"))
+	defer sqliteDB.Close()
+
+	migrator, err := NewSQLiteMigrator(sqliteDB)
+	if err != nil {
+		t.Fatalf("NewSQLiteMigrator: %+v", err)
+	}
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up: %+v", err)
+	}
+	checkApplied(t, migrator, len(migrator.migrations))
+	schema := sqliteTables(t, sqliteDB)
+
+	// повторный запуск ничего не применяет
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Repeated Up: %+v", err)
+	}
+
+	if err := migrator.Down(ctx, 1); err != nil {
+		t.Fatalf("Down: %+v", err)
+	}
+	checkApplied(t, migrator, len(migrator.migrations)-1)
+
+	// полный откат оставляет только таблицу версий, после него схема создается заново такой же
+	if err := migrator.Down(ctx, len(migrator.migrations)); err != nil {
+		t.Fatalf("Down all: %+v", err)
+	}
+	checkApplied(t, migrator, 0)
+	if tables := sqliteTables(t, sqliteDB); len(tables) != 1 || tables[0] != "schema_migrations" {
+		t.Errorf("Tables left after rollback: %v", tables)
+	}
+
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up after rollback: %+v", err)
+	}
+	checkApplied(t, migrator, len(migrator.migrations))
+	if tables := sqliteTables(t, sqliteDB); len(tables) != len(schema) {
+		t.Errorf("Tables after rollback and up %v, expected %v", tables, schema)
+	}
+}
+
+func checkApplied(t *testing.T, migrator *Migrator, expected int) {
+	t.Helper()
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %+v", err)
+	}
+
+	applied := 0
+	for i, status := range statuses {
+		if status.AppliedAt == nil {
+			continue
+		}
+		applied++
+		// применяются и откатываются только последние версии
+		if i >= expected {
+			t.Errorf("Migration %s is applied", status)
+		}
+	}
+	if applied != expected {
+		t.Errorf("%d migrations are applied, expected %d", applied, expected)
+	}
+}
+
+// sqliteTables возвращает обычные таблицы базы, без служебных таблиц SQLite и FTS5
+func sqliteTables(t *testing.T, sqliteDB *sql.DB) []string {
+	t.Helper()
+	rows, err := sqliteDB.Query(`select name from sqlite_master where type = 'table' and name not like 'sqlite_%' 
+and name not like 'messages_fts_%' order by name`)
+	if err != nil {
+		t.Fatalf("Cannot list tables: %+v", err)
+	}
+	defer rows.Close()
+
+	tables := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("Cannot scan table name: %+v", err)
+		}
+		tables = append(tables, name)
+	}
+	return tables
+}
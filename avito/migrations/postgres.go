@@ -0,0 +1,91 @@
+package migrations
+
+import (
+	"avito/db"
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+// произвольный ключ advisory lock для миграций
+const pgMigrationsLockKey = 7414730617
+
+type pgDriver struct {
+	pool *pgxpool.Pool
+	conn *pgxpool.Conn
+}
+
+func NewPGMigrator(connDB db.ConnDB) (*Migrator, error) {
+	return newMigrator("postgres", &pgDriver{pool: connDB.DB})
+}
+
+// lock берет соединение из пула на все время миграций: advisory lock принадлежит сессии
+func (d *pgDriver) lock(ctx context.Context) (func(), error) {
+	conn, err := d.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Exec(ctx, `select pg_advisory_lock($1)`, pgMigrationsLockKey); err != nil {
+		conn.Release()
+		return nil, err
+	}
+	d.conn = conn
+
+	return func() {
+		conn.Exec(context.Background(), `select pg_advisory_unlock($1)`, pgMigrationsLockKey)
+		conn.Release()
+		d.conn = nil
+	}, nil
+}
+
+func (d *pgDriver) ensureTable(ctx context.Context) error {
+	_, err := d.conn.Exec(ctx, `create table if not exists schema_migrations (
+	version bigint primary key,
+	name text not null,
+	applied_at timestamp not null default now())`)
+	return err
+}
+
+func (d *pgDriver) applied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := d.conn.Query(ctx, `select version, applied_at from schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func (d *pgDriver) apply(ctx context.Context, m Migration, sql string, up bool) error {
+	tx, err := d.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+
+	if up {
+		_, err = tx.Exec(ctx, `insert into schema_migrations (version, name) values ($1, $2)`, m.Version, m.Name)
+	} else {
+		_, err = tx.Exec(ctx, `delete from schema_migrations where version=$1`, m.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS chats_users;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS chats;
+DROP TABLE IF EXISTS users;
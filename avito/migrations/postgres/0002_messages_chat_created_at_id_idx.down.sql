@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS messages_chat_idx ON messages (chat);
+DROP INDEX IF EXISTS messages_chat_created_at_id_idx;
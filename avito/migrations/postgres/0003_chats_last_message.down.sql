@@ -0,0 +1,3 @@
+ALTER TABLE chats DROP CONSTRAINT IF EXISTS chats_last_message_id_fkey;
+ALTER TABLE chats DROP COLUMN IF EXISTS last_message_at;
+ALTER TABLE chats DROP COLUMN IF EXISTS last_message_id;
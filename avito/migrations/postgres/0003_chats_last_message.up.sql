@@ -0,0 +1,7 @@
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS last_message_id UUID;
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS last_message_at TIMESTAMP;
+ALTER TABLE chats DROP CONSTRAINT IF EXISTS chats_last_message_id_fkey;
+ALTER TABLE chats ADD CONSTRAINT chats_last_message_id_fkey FOREIGN KEY (last_message_id) REFERENCES messages(id);
+UPDATE chats c SET last_message_id = m.id, last_message_at = m.created_at
+FROM (SELECT DISTINCT ON (chat) chat, id, created_at FROM messages ORDER BY chat, created_at DESC, id DESC) m
+WHERE m.chat = c.id AND c.last_message_id IS NULL;
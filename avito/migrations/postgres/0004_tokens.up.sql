@@ -0,0 +1,2 @@
+CREATE TABLE IF NOT EXISTS tokens (id UUID DEFAULT uuid_generate_v4() PRIMARY KEY, user_id UUID NOT NULL REFERENCES users(id), token_hash TEXT NOT NULL, created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL, UNIQUE(token_hash));
+CREATE INDEX IF NOT EXISTS tokens_user_id_idx ON tokens (user_id);
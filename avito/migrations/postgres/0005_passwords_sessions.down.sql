@@ -0,0 +1,6 @@
+DELETE FROM tokens WHERE session_id IS NOT NULL;
+DROP INDEX IF EXISTS tokens_session_id_idx;
+ALTER TABLE tokens DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE tokens DROP COLUMN IF EXISTS session_id;
+DROP TABLE IF EXISTS sessions;
+ALTER TABLE users DROP COLUMN IF EXISTS password_hash;
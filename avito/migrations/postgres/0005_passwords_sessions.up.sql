@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash TEXT;
+CREATE TABLE IF NOT EXISTS sessions (id UUID DEFAULT uuid_generate_v4() PRIMARY KEY, user_id UUID NOT NULL REFERENCES users(id), refresh_token_hash TEXT NOT NULL, created_at TIMESTAMP NOT NULL, expires_at TIMESTAMP NOT NULL, revoked_at TIMESTAMP, UNIQUE(refresh_token_hash));
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS session_id UUID REFERENCES sessions(id);
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS tokens_session_id_idx ON tokens (session_id);
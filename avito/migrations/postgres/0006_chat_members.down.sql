@@ -0,0 +1,9 @@
+UPDATE chats SET last_message_id = NULL, last_message_at = NULL
+WHERE last_message_id IN (SELECT id FROM messages WHERE type <> 'text');
+DELETE FROM messages WHERE type <> 'text';
+UPDATE chats c SET last_message_id = m.id, last_message_at = m.created_at
+FROM (SELECT DISTINCT ON (chat) chat, id, created_at FROM messages ORDER BY chat, created_at DESC, id DESC) m
+WHERE m.chat = c.id AND c.last_message_id IS NULL;
+ALTER TABLE messages DROP COLUMN IF EXISTS target;
+ALTER TABLE messages DROP COLUMN IF EXISTS type;
+ALTER TABLE chats_users DROP CONSTRAINT IF EXISTS chats_users_chat_id_user_id_key;
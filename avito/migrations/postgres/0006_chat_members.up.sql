@@ -0,0 +1,6 @@
+DELETE FROM chats_users a USING chats_users b WHERE a.chat_id = b.chat_id AND a.user_id = b.user_id AND a.id > b.id;
+ALTER TABLE chats_users DROP CONSTRAINT IF EXISTS chats_users_chat_id_user_id_key;
+ALTER TABLE chats_users ADD CONSTRAINT chats_users_chat_id_user_id_key UNIQUE (chat_id, user_id);
+-- системные сообщения о входе и выходе участников: type - вид события, target - участник, которого оно касается
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS type TEXT NOT NULL DEFAULT 'text';
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS target UUID REFERENCES users(id);
@@ -0,0 +1 @@
+ALTER TABLE chats_users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,5 @@
+ALTER TABLE chats_users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'member';
+-- создатель чата раньше не сохранялся, поэтому владельцем существующего чата становится первый добавленный участник
+UPDATE chats_users cu SET role = 'owner'
+FROM (SELECT DISTINCT ON (chat_id) id, chat_id FROM chats_users ORDER BY chat_id, id) first
+WHERE cu.id = first.id AND NOT EXISTS (SELECT 1 FROM chats_users o WHERE o.chat_id = first.chat_id AND o.role = 'owner');
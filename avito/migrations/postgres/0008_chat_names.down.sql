@@ -0,0 +1,8 @@
+UPDATE chats SET last_message_id = NULL, last_message_at = NULL
+WHERE last_message_id IN (SELECT id FROM messages WHERE type = 'chat_renamed');
+DELETE FROM messages WHERE type = 'chat_renamed';
+UPDATE chats c SET last_message_id = m.id, last_message_at = m.created_at
+FROM (SELECT DISTINCT ON (chat) chat, id, created_at FROM messages ORDER BY chat, created_at DESC, id DESC) m
+WHERE m.chat = c.id AND c.last_message_id IS NULL;
+DROP TABLE IF EXISTS chat_renames;
+DROP INDEX IF EXISTS chats_lower_name_idx;
@@ -0,0 +1,7 @@
+-- имена чатов уникальны без учета регистра, более поздние дубликаты получают суффикс из id
+UPDATE chats c SET name = c.name || ' (' || left(c.id::text, 8) || ')'
+FROM (SELECT id, row_number() OVER (PARTITION BY lower(name) ORDER BY created_at, id) AS rn FROM chats) d
+WHERE d.id = c.id AND d.rn > 1;
+CREATE UNIQUE INDEX IF NOT EXISTS chats_lower_name_idx ON chats (lower(name));
+CREATE TABLE IF NOT EXISTS chat_renames (id UUID DEFAULT uuid_generate_v4() PRIMARY KEY, chat_id UUID NOT NULL REFERENCES chats(id), old_name TEXT NOT NULL, new_name TEXT NOT NULL, renamed_by UUID NOT NULL REFERENCES users(id), created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL);
+CREATE INDEX IF NOT EXISTS chat_renames_chat_id_created_at_idx ON chat_renames (chat_id, created_at);
@@ -0,0 +1,9 @@
+UPDATE chats SET last_message_id = NULL, last_message_at = NULL WHERE type = 'direct';
+DELETE FROM messages WHERE chat IN (SELECT id FROM chats WHERE type = 'direct');
+DELETE FROM chats_users WHERE chat_id IN (SELECT id FROM chats WHERE type = 'direct');
+DELETE FROM chats WHERE type = 'direct';
+DROP INDEX IF EXISTS chats_lower_name_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS chats_lower_name_idx ON chats (lower(name));
+DROP INDEX IF EXISTS chats_direct_key_idx;
+ALTER TABLE chats DROP COLUMN IF EXISTS direct_key;
+ALTER TABLE chats DROP COLUMN IF EXISTS type;
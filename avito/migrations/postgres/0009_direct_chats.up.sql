@@ -0,0 +1,7 @@
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS type TEXT NOT NULL DEFAULT 'group';
+-- пара участников личного чата "<меньший id>:<больший id>", у групповых чатов NULL
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS direct_key TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS chats_direct_key_idx ON chats (direct_key);
+-- у личных чатов нет имени, уникальность имен проверяется только среди групповых
+DROP INDEX IF EXISTS chats_lower_name_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS chats_lower_name_idx ON chats (lower(name)) WHERE type = 'group';
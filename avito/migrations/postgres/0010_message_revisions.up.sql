@@ -0,0 +1,4 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP;
+-- прежние версии текста сообщения, edited_at - время правки, заменившей эту версию
+CREATE TABLE IF NOT EXISTS message_revisions (id UUID DEFAULT uuid_generate_v4() PRIMARY KEY, message_id UUID NOT NULL REFERENCES messages(id), "text" TEXT NOT NULL, edited_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL);
+CREATE INDEX IF NOT EXISTS message_revisions_message_id_edited_at_idx ON message_revisions (message_id, edited_at);
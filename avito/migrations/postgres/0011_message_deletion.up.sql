@@ -0,0 +1,6 @@
+-- удаленное для всех сообщение остается в ленте как tombstone, текст стирается задачей очистки после срока хранения
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_by UUID REFERENCES users(id);
+CREATE INDEX IF NOT EXISTS messages_deleted_at_idx ON messages (deleted_at) WHERE deleted_at IS NOT NULL;
+-- сообщения, скрытые отдельными пользователями ("удалить у себя")
+CREATE TABLE IF NOT EXISTS hidden_messages (user_id UUID NOT NULL REFERENCES users(id), message_id UUID NOT NULL REFERENCES messages(id), created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL, PRIMARY KEY (user_id, message_id));
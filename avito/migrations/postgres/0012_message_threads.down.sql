@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS messages_parent_created_at_id_idx;
+ALTER TABLE messages DROP COLUMN IF EXISTS last_reply_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS reply_count;
+ALTER TABLE messages DROP COLUMN IF EXISTS parent;
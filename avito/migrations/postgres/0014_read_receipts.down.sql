@@ -0,0 +1,3 @@
+ALTER TABLE chats_users DROP COLUMN IF EXISTS read_at;
+ALTER TABLE chats_users DROP COLUMN IF EXISTS last_read_message_at;
+ALTER TABLE chats_users DROP COLUMN IF EXISTS last_read_message_id;
@@ -0,0 +1,7 @@
+-- указатель прочтения участника: последнее прочитанное сообщение, его время создания для подсчета непрочитанных
+-- по индексу (chat, created_at, id) и время, когда участник его прочитал
+ALTER TABLE chats_users ADD COLUMN IF NOT EXISTS last_read_message_id UUID REFERENCES messages(id);
+ALTER TABLE chats_users ADD COLUMN IF NOT EXISTS last_read_message_at TIMESTAMP;
+ALTER TABLE chats_users ADD COLUMN IF NOT EXISTS read_at TIMESTAMP;
+-- существующая история считается прочитанной, иначе у старых чатов появятся тысячи непрочитанных
+UPDATE chats_users cu SET last_read_message_id = c.last_message_id, last_read_message_at = c.last_message_at, read_at = c.last_message_at FROM chats c WHERE c.id = cu.chat_id AND cu.last_read_message_id IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS messages_text_tsv_idx;
+ALTER TABLE messages DROP COLUMN IF EXISTS text_tsv;
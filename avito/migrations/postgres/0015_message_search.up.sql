@@ -0,0 +1,3 @@
+-- поисковый вектор текста поддерживается самим Postgres при вставке, правке и очистке сообщения
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS text_tsv TSVECTOR GENERATED ALWAYS AS (to_tsvector('russian', "text")) STORED;
+CREATE INDEX IF NOT EXISTS messages_text_tsv_idx ON messages USING GIN (text_tsv);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_lower_username_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_url;
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
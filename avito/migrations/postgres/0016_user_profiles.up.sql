@@ -0,0 +1,5 @@
+-- профиль пользователя, незаданные поля хранятся как NULL
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_url TEXT;
+-- поиск по префиксу имени без учета регистра: с collate "C" и like, и сортировка идут по индексу
+CREATE INDEX IF NOT EXISTS users_lower_username_idx ON users ((lower(username) COLLATE "C"));
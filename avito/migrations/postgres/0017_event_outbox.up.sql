@@ -0,0 +1,11 @@
+-- события шины postgres: NOTIFY передает только id строки, остальное слушатели читают отсюда.
+-- recipients = NULL - событие для всех участников чата на момент доставки
+CREATE TABLE IF NOT EXISTS event_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    chat_id UUID NOT NULL,
+    recipients UUID[],
+    payload JSON NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS event_outbox_created_at_idx ON event_outbox (created_at);
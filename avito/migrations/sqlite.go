@@ -0,0 +1,72 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqliteDriver struct {
+	db *sql.DB
+}
+
+func NewSQLiteMigrator(db *sql.DB) (*Migrator, error) {
+	return newMigrator("sqlite", &sqliteDriver{db: db})
+}
+
+// lock не нужен: SQLite сам сериализует пишущие транзакции к файлу базы
+func (d *sqliteDriver) lock(ctx context.Context) (func(), error) {
+	return func() {}, nil
+}
+
+func (d *sqliteDriver) ensureTable(ctx context.Context) error {
+	_, err := d.db.ExecContext(ctx, `create table if not exists schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at INTEGER NOT NULL)`)
+	return err
+}
+
+func (d *sqliteDriver) applied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := d.db.QueryContext(ctx, `select version, applied_at from schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = time.Unix(appliedAt, 0).UTC()
+	}
+
+	return applied, rows.Err()
+}
+
+func (d *sqliteDriver) apply(ctx context.Context, m Migration, sql string, up bool) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, sql); err != nil {
+		return err
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, `insert into schema_migrations (version, name, applied_at) values (?, ?, ?)`,
+			m.Version, m.Name, time.Now().Unix())
+	} else {
+		_, err = tx.ExecContext(ctx, `delete from schema_migrations where version=?`, m.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
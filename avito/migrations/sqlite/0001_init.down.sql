@@ -0,0 +1,5 @@
+UPDATE chats SET last_message_id = NULL;
+DROP TABLE IF EXISTS chats_users;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS chats;
+DROP TABLE IF EXISTS users;
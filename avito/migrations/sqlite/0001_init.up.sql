@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS users (id TEXT PRIMARY KEY, username TEXT NOT NULL UNIQUE, created_at INTEGER NOT NULL);
+CREATE TABLE IF NOT EXISTS chats (id TEXT PRIMARY KEY, name TEXT NOT NULL, created_at INTEGER NOT NULL, last_message_id TEXT REFERENCES messages(id), last_message_at INTEGER);
+CREATE TABLE IF NOT EXISTS messages (id TEXT PRIMARY KEY, chat TEXT REFERENCES chats(id), author TEXT REFERENCES users(id), "text" TEXT NOT NULL, created_at INTEGER NOT NULL);
+CREATE TABLE IF NOT EXISTS chats_users (id TEXT PRIMARY KEY, chat_id TEXT REFERENCES chats(id), user_id TEXT REFERENCES users(id));
+CREATE INDEX IF NOT EXISTS chats_users_chat_id_idx ON chats_users (chat_id);
+CREATE INDEX IF NOT EXISTS chats_users_user_id_idx ON chats_users (user_id);
+CREATE INDEX IF NOT EXISTS messages_author_idx ON messages (author);
+CREATE INDEX IF NOT EXISTS messages_chat_created_at_id_idx ON messages (chat, created_at, id);
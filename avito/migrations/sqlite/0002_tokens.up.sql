@@ -0,0 +1,2 @@
+CREATE TABLE IF NOT EXISTS tokens (id TEXT PRIMARY KEY, user_id TEXT NOT NULL REFERENCES users(id), token_hash TEXT NOT NULL UNIQUE, created_at INTEGER NOT NULL);
+CREATE INDEX IF NOT EXISTS tokens_user_id_idx ON tokens (user_id);
@@ -0,0 +1,10 @@
+DELETE FROM tokens WHERE session_id IS NOT NULL;
+DROP INDEX IF EXISTS tokens_session_id_idx;
+-- SQLite не удаляет колонки со ссылками на другие таблицы, поэтому tokens пересоздается
+CREATE TABLE tokens_old (id TEXT PRIMARY KEY, user_id TEXT NOT NULL REFERENCES users(id), token_hash TEXT NOT NULL UNIQUE, created_at INTEGER NOT NULL);
+INSERT INTO tokens_old (id, user_id, token_hash, created_at) SELECT id, user_id, token_hash, created_at FROM tokens;
+DROP TABLE tokens;
+ALTER TABLE tokens_old RENAME TO tokens;
+CREATE INDEX IF NOT EXISTS tokens_user_id_idx ON tokens (user_id);
+DROP TABLE IF EXISTS sessions;
+ALTER TABLE users DROP COLUMN password_hash;
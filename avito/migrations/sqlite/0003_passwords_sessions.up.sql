@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN password_hash TEXT;
+CREATE TABLE IF NOT EXISTS sessions (id TEXT PRIMARY KEY, user_id TEXT NOT NULL REFERENCES users(id), refresh_token_hash TEXT NOT NULL UNIQUE, created_at INTEGER NOT NULL, expires_at INTEGER NOT NULL, revoked_at INTEGER);
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+ALTER TABLE tokens ADD COLUMN session_id TEXT REFERENCES sessions(id);
+ALTER TABLE tokens ADD COLUMN expires_at INTEGER;
+CREATE INDEX IF NOT EXISTS tokens_session_id_idx ON tokens (session_id);
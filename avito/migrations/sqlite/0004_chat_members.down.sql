@@ -0,0 +1,10 @@
+UPDATE chats SET last_message_id = NULL, last_message_at = NULL
+WHERE last_message_id IN (SELECT id FROM messages WHERE type <> 'text');
+DELETE FROM messages WHERE type <> 'text';
+UPDATE chats SET
+    last_message_id = (SELECT id FROM messages m WHERE m.chat = chats.id ORDER BY created_at DESC, id DESC LIMIT 1),
+    last_message_at = (SELECT max(created_at) FROM messages m WHERE m.chat = chats.id)
+WHERE last_message_id IS NULL;
+ALTER TABLE messages DROP COLUMN target;
+ALTER TABLE messages DROP COLUMN type;
+DROP INDEX IF EXISTS chats_users_chat_id_user_id_idx;
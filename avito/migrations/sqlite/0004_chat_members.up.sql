@@ -0,0 +1,5 @@
+DELETE FROM chats_users WHERE rowid NOT IN (SELECT min(rowid) FROM chats_users GROUP BY chat_id, user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS chats_users_chat_id_user_id_idx ON chats_users (chat_id, user_id);
+-- target без REFERENCES: SQLite не удаляет колонки со ссылками, и откат пришлось бы делать пересозданием messages
+ALTER TABLE messages ADD COLUMN type TEXT NOT NULL DEFAULT 'text';
+ALTER TABLE messages ADD COLUMN target TEXT;
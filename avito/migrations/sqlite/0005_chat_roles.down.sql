@@ -0,0 +1 @@
+ALTER TABLE chats_users DROP COLUMN role;
@@ -0,0 +1,3 @@
+ALTER TABLE chats_users ADD COLUMN role TEXT NOT NULL DEFAULT 'member';
+-- создатель чата раньше не сохранялся, поэтому владельцем существующего чата становится первый добавленный участник
+UPDATE chats_users SET role = 'owner' WHERE rowid IN (SELECT min(rowid) FROM chats_users GROUP BY chat_id);
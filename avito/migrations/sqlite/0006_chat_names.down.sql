@@ -0,0 +1,9 @@
+UPDATE chats SET last_message_id = NULL, last_message_at = NULL
+WHERE last_message_id IN (SELECT id FROM messages WHERE type = 'chat_renamed');
+DELETE FROM messages WHERE type = 'chat_renamed';
+UPDATE chats SET
+    last_message_id = (SELECT id FROM messages m WHERE m.chat = chats.id ORDER BY created_at DESC, id DESC LIMIT 1),
+    last_message_at = (SELECT max(created_at) FROM messages m WHERE m.chat = chats.id)
+WHERE last_message_id IS NULL;
+DROP TABLE IF EXISTS chat_renames;
+DROP INDEX IF EXISTS chats_lower_name_idx;
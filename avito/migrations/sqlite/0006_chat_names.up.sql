@@ -0,0 +1,6 @@
+-- имена чатов уникальны без учета регистра, более поздние дубликаты получают суффикс из id
+UPDATE chats SET name = name || ' (' || substr(id, 1, 8) || ')'
+WHERE id IN (SELECT id FROM (SELECT id, row_number() OVER (PARTITION BY lower(name) ORDER BY created_at, id) AS rn FROM chats) WHERE rn > 1);
+CREATE UNIQUE INDEX IF NOT EXISTS chats_lower_name_idx ON chats (lower(name));
+CREATE TABLE IF NOT EXISTS chat_renames (id TEXT PRIMARY KEY, chat_id TEXT NOT NULL REFERENCES chats(id), old_name TEXT NOT NULL, new_name TEXT NOT NULL, renamed_by TEXT NOT NULL REFERENCES users(id), created_at INTEGER NOT NULL);
+CREATE INDEX IF NOT EXISTS chat_renames_chat_id_created_at_idx ON chat_renames (chat_id, created_at);
@@ -0,0 +1,4 @@
+ALTER TABLE messages ADD COLUMN edited_at INTEGER;
+-- прежние версии текста сообщения, edited_at - время правки, заменившей эту версию
+CREATE TABLE IF NOT EXISTS message_revisions (id TEXT PRIMARY KEY, message_id TEXT NOT NULL REFERENCES messages(id), "text" TEXT NOT NULL, edited_at INTEGER NOT NULL);
+CREATE INDEX IF NOT EXISTS message_revisions_message_id_edited_at_idx ON message_revisions (message_id, edited_at);
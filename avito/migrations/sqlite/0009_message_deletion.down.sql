@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS hidden_messages;
+DROP INDEX IF EXISTS messages_deleted_at_idx;
+ALTER TABLE messages DROP COLUMN deleted_by;
+ALTER TABLE messages DROP COLUMN deleted_at;
@@ -0,0 +1,6 @@
+-- удаленное для всех сообщение остается в ленте как tombstone, текст стирается задачей очистки после срока хранения
+ALTER TABLE messages ADD COLUMN deleted_at INTEGER;
+ALTER TABLE messages ADD COLUMN deleted_by TEXT;
+CREATE INDEX IF NOT EXISTS messages_deleted_at_idx ON messages (deleted_at) WHERE deleted_at IS NOT NULL;
+-- сообщения, скрытые отдельными пользователями ("удалить у себя")
+CREATE TABLE IF NOT EXISTS hidden_messages (user_id TEXT NOT NULL REFERENCES users(id), message_id TEXT NOT NULL REFERENCES messages(id), created_at INTEGER NOT NULL, PRIMARY KEY (user_id, message_id));
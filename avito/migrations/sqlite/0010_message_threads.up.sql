@@ -0,0 +1,5 @@
+-- ответы в треде ссылаются на корневое сообщение, счетчик и время последнего ответа хранятся в корне
+ALTER TABLE messages ADD COLUMN parent TEXT;
+ALTER TABLE messages ADD COLUMN reply_count INTEGER DEFAULT 0 NOT NULL;
+ALTER TABLE messages ADD COLUMN last_reply_at INTEGER;
+CREATE INDEX IF NOT EXISTS messages_parent_created_at_id_idx ON messages (parent, created_at, id) WHERE parent IS NOT NULL;
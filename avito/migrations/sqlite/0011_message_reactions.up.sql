@@ -0,0 +1,2 @@
+-- реакция - emoji пользователя на сообщение, каждый emoji ставится пользователем один раз
+CREATE TABLE IF NOT EXISTS message_reactions (message_id TEXT NOT NULL REFERENCES messages(id), user_id TEXT NOT NULL REFERENCES users(id), emoji TEXT NOT NULL, created_at INTEGER NOT NULL, PRIMARY KEY (message_id, user_id, emoji));
@@ -0,0 +1,7 @@
+-- указатель прочтения участника: последнее прочитанное сообщение, его время создания для подсчета непрочитанных
+-- по индексу (chat, created_at, id) и время, когда участник его прочитал
+ALTER TABLE chats_users ADD COLUMN last_read_message_id TEXT;
+ALTER TABLE chats_users ADD COLUMN last_read_message_at INTEGER;
+ALTER TABLE chats_users ADD COLUMN read_at INTEGER;
+-- существующая история считается прочитанной, иначе у старых чатов появятся тысячи непрочитанных
+UPDATE chats_users SET last_read_message_id = (SELECT last_message_id FROM chats WHERE chats.id = chats_users.chat_id), last_read_message_at = (SELECT last_message_at FROM chats WHERE chats.id = chats_users.chat_id), read_at = (SELECT last_message_at FROM chats WHERE chats.id = chats_users.chat_id) WHERE last_read_message_id IS NULL;
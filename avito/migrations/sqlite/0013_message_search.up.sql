@@ -0,0 +1,12 @@
+-- полнотекстовый индекс FTS5 хранит копию текста сообщения и поддерживается триггерами
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5("text", message_id UNINDEXED);
+INSERT INTO messages_fts ("text", message_id) SELECT "text", id FROM messages;
+CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+    INSERT INTO messages_fts ("text", message_id) VALUES (new."text", new.id);
+END;
+CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF "text" ON messages BEGIN
+    UPDATE messages_fts SET "text" = new."text" WHERE message_id = old.id;
+END;
+CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+    DELETE FROM messages_fts WHERE message_id = old.id;
+END;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_lower_username_idx;
+ALTER TABLE users DROP COLUMN avatar_url;
+ALTER TABLE users DROP COLUMN display_name;
@@ -0,0 +1,4 @@
+-- профиль пользователя, незаданные поля хранятся как NULL
+ALTER TABLE users ADD COLUMN display_name TEXT;
+ALTER TABLE users ADD COLUMN avatar_url TEXT;
+CREATE INDEX IF NOT EXISTS users_lower_username_idx ON users (lower(username));
@@ -0,0 +1,3 @@
+-- закрепленное сообщение, сообщение закрепляется в своем чате один раз
+CREATE TABLE IF NOT EXISTS pinned_messages (message_id TEXT PRIMARY KEY REFERENCES messages(id), chat_id TEXT NOT NULL REFERENCES chats(id), pinned_by TEXT NOT NULL REFERENCES users(id), pinned_at INTEGER NOT NULL);
+CREATE INDEX IF NOT EXISTS pinned_messages_chat_idx ON pinned_messages (chat_id, pinned_at);
@@ -1,26 +1,31 @@
 package service
 
 import (
-	"../storage"
+	"avito/config"
+	"avito/events"
+	"avito/storage"
 )
 
 type ServiceAPI interface {
 	GetUserService() UserServiceAPI
 	GetChatService() ChatServiceAPI
 	GetMessageService() MessageServiceAPI
+	GetAuthService() AuthServiceAPI
 }
 
 type serviceAPI struct {
 	userServiceAPI UserServiceAPI
 	chatServiceAPI ChatServiceAPI
 	messageServiceAPI MessageServiceAPI
+	authServiceAPI AuthServiceAPI
 }
 
-func NewServiceAPI(api storage.StorageAPI) ServiceAPI {
+func NewServiceAPI(api storage.StorageAPI, bus events.Bus, authConfig config.AuthConfig, messageConfig config.MessageConfig) ServiceAPI {
 	return &serviceAPI{
 		userServiceAPI: NewUserServiceAPI(api),
-		chatServiceAPI: NewChatServiceAPI(api),
-		messageServiceAPI: NewMessageServiceAPI(api),
+		chatServiceAPI: NewChatServiceAPI(api, bus),
+		messageServiceAPI: NewMessageServiceAPI(api, bus, messageConfig),
+		authServiceAPI: NewAuthServiceAPI(api, authConfig),
 	}
 }
 
@@ -35,3 +40,7 @@ func (s *serviceAPI) GetChatService() ChatServiceAPI {
 func (s *serviceAPI) GetMessageService() MessageServiceAPI {
 	return s.messageServiceAPI
 }
+
+func (s *serviceAPI) GetAuthService() AuthServiceAPI {
+	return s.authServiceAPI
+}
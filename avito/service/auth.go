@@ -0,0 +1,276 @@
+package service
+
+import (
+	"avito/config"
+	"avito/dto"
+	"avito/storage"
+	"context"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"log"
+	"os"
+	"time"
+)
+
+// errRefreshTokenReused - refresh token уже заменен параллельным запросом
+var errRefreshTokenReused = xerrors.New("Refresh token is already used")
+
+// ошибки бизнес-логики возвращаются как *Error, handlers по ним выбирают HTTP-статус
+type AuthServiceAPI interface {
+	// Authenticate возвращает владельца токена и сессию, в которой токен выдан
+	Authenticate(ctx context.Context, token string) (Identity, error)
+	// CreateToken выдает бессрочный API-токен пользователю, от имени которого выполняется запрос
+	CreateToken(ctx context.Context) (dto.CreateTokenResponse, error)
+	Login(ctx context.Context, loginRequest dto.LoginRequest) (dto.AuthResponse, error)
+	Refresh(ctx context.Context, refreshRequest dto.RefreshRequest) (dto.AuthResponse, error)
+	// Logout отзывает сессию текущего токена
+	Logout(ctx context.Context) error
+	GetSessionList(ctx context.Context) (dto.SessionListResponse, error)
+	RevokeSession(ctx context.Context, revokeSessionRequest dto.RevokeSessionRequest) error
+}
+
+type authService struct {
+	storage storage.StorageAPI
+	config  config.AuthConfig
+	log     *log.Logger
+}
+
+func NewAuthServiceAPI(api storage.StorageAPI, authConfig config.AuthConfig) AuthServiceAPI {
+	return &authService{
+		storage: api,
+		config:  authConfig,
+		log:     log.New(os.Stdout, "AUTH-SERVICE: ", log.LstdFlags),
+	}
+}
+
+func (a *authService) Authenticate(ctx context.Context, token string) (Identity, error) {
+	if len(token) == 0 {
+		return Identity{}, unauthorizedError(CodeUnauthorized, "Authentication required")
+	}
+
+	storedToken, err := a.storage.GetTokenStorage().GetToken(ctx, hashToken(token))
+	if err != nil {
+		a.log.Printf("Error while get token, reason: %+v", err)
+		return Identity{}, internalError(err)
+	}
+	if storedToken.UserID == uuid.Nil {
+		return Identity{}, unauthorizedError(CodeUnauthorized, "Invalid token")
+	}
+	if storedToken.ExpiresAt != nil && !time.Now().Before(*storedToken.ExpiresAt) {
+		return Identity{}, unauthorizedError(CodeTokenExpired, "Token expired")
+	}
+
+	return Identity{UserID: storedToken.UserID, SessionID: storedToken.SessionID}, nil
+}
+
+func (a *authService) CreateToken(ctx context.Context) (dto.CreateTokenResponse, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return dto.CreateTokenResponse{}, err
+	}
+	a.log.Printf("Trying to create token for user %s", userID)
+
+	token, tokenHash, err := newToken()
+	if err != nil {
+		a.log.Printf("Error while generate token, reason: %+v", err)
+		return dto.CreateTokenResponse{}, internalError(err)
+	}
+
+	err = a.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		return a.storage.GetTokenStorage().CreateToken(ctx, tx, storage.Token{UserID: userID, Hash: tokenHash})
+	})
+	if err != nil {
+		a.log.Printf("Error while create token in DB, reason: %+v", err)
+		return dto.CreateTokenResponse{}, internalError(err)
+	}
+
+	return dto.CreateTokenResponse{Token: token}, nil
+}
+
+func (a *authService) Login(ctx context.Context, loginRequest dto.LoginRequest) (dto.AuthResponse, error) {
+	a.log.Printf("Trying to login user %s", loginRequest)
+	userID, passwordHash, err := a.storage.GetUserStorage().GetUserCredentials(ctx, loginRequest.Username)
+	if err != nil {
+		a.log.Printf("Error while get user credentials, reason: %+v", err)
+		return dto.AuthResponse{}, internalError(err)
+	}
+	if !checkPassword(passwordHash, loginRequest.Password) || userID == uuid.Nil {
+		return dto.AuthResponse{}, unauthorizedError(CodeInvalidCredentials, "Invalid username or password")
+	}
+
+	now := time.Now()
+	session := storage.Session{ID: uuid.Must(uuid.NewUUID()), UserID: userID, CreatedAt: now, ExpiresAt: now.Add(a.config.RefreshTokenTTL)}
+	var refreshToken string
+	refreshToken, session.RefreshTokenHash, err = newToken()
+	if err != nil {
+		a.log.Printf("Error while generate refresh token, reason: %+v", err)
+		return dto.AuthResponse{}, internalError(err)
+	}
+
+	var response dto.AuthResponse
+	err = a.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		if err := a.storage.GetSessionStorage().CreateSession(ctx, tx, session); err != nil {
+			return xerrors.Errorf("Cannot create session: %w", err)
+		}
+
+		var err error
+		response, err = a.createAccessToken(ctx, tx, session, now)
+		return err
+	})
+	if err != nil {
+		a.log.Printf("Error while create session in DB, reason: %+v", err)
+		return dto.AuthResponse{}, internalError(err)
+	}
+	response.RefreshToken = refreshToken
+
+	return response, nil
+}
+
+func (a *authService) Refresh(ctx context.Context, refreshRequest dto.RefreshRequest) (dto.AuthResponse, error) {
+	a.log.Printf("Trying to refresh session")
+	invalidToken := unauthorizedError(CodeInvalidRefreshToken, "Invalid or expired refresh token")
+	if len(refreshRequest.RefreshToken) == 0 {
+		return dto.AuthResponse{}, invalidToken
+	}
+
+	oldHash := hashToken(refreshRequest.RefreshToken)
+	session, err := a.storage.GetSessionStorage().GetSessionByRefreshToken(ctx, oldHash)
+	if err != nil {
+		a.log.Printf("Error while get session by refresh token, reason: %+v", err)
+		return dto.AuthResponse{}, internalError(err)
+	}
+	now := time.Now()
+	if session.ID == uuid.Nil || session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+		return dto.AuthResponse{}, invalidToken
+	}
+
+	refreshToken, newHash, err := newToken()
+	if err != nil {
+		a.log.Printf("Error while generate refresh token, reason: %+v", err)
+		return dto.AuthResponse{}, internalError(err)
+	}
+	session.RefreshTokenHash = newHash
+	session.ExpiresAt = now.Add(a.config.RefreshTokenTTL)
+
+	var response dto.AuthResponse
+	err = a.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		ok, err := a.storage.GetSessionStorage().RotateRefreshToken(ctx, tx, session.ID, oldHash, newHash, session.ExpiresAt)
+		if err != nil {
+			return xerrors.Errorf("Cannot rotate refresh token: %w", err)
+		}
+		if !ok {
+			return errRefreshTokenReused
+		}
+		if err := a.storage.GetTokenStorage().DeleteExpiredTokens(ctx, tx, session.ID, now); err != nil {
+			return xerrors.Errorf("Cannot delete expired access tokens: %w", err)
+		}
+
+		response, err = a.createAccessToken(ctx, tx, session, now)
+		return err
+	})
+	if xerrors.Is(err, errRefreshTokenReused) {
+		return dto.AuthResponse{}, invalidToken
+	}
+	if err != nil {
+		a.log.Printf("Error while refresh session in DB, reason: %+v", err)
+		return dto.AuthResponse{}, internalError(err)
+	}
+	response.RefreshToken = refreshToken
+
+	return response, nil
+}
+
+// createAccessToken выдает access-токен сессии, refresh token заполняет вызывающий
+func (a *authService) createAccessToken(ctx context.Context, tx storage.Tx, session storage.Session, now time.Time) (dto.AuthResponse, error) {
+	accessToken, accessHash, err := newToken()
+	if err != nil {
+		return dto.AuthResponse{}, xerrors.Errorf("Cannot generate access token: %w", err)
+	}
+
+	expiresAt := now.Add(a.config.AccessTokenTTL)
+	err = a.storage.GetTokenStorage().CreateToken(ctx, tx, storage.Token{
+		UserID:    session.UserID,
+		SessionID: session.ID,
+		Hash:      accessHash,
+		ExpiresAt: &expiresAt,
+	})
+	if err != nil {
+		return dto.AuthResponse{}, xerrors.Errorf("Cannot create access token: %w", err)
+	}
+
+	return dto.AuthResponse{
+		SessionID:   session.ID,
+		AccessToken: accessToken,
+		ExpiresIn:   int(a.config.AccessTokenTTL / time.Second),
+	}, nil
+}
+
+func (a *authService) Logout(ctx context.Context) error {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return unauthorizedError(CodeUnauthorized, "Authentication required")
+	}
+	if identity.SessionID == uuid.Nil {
+		return conflictError(CodeNotSessionToken, "Request is authenticated with API token, not a session")
+	}
+	a.log.Printf("Trying to logout session %s", identity.SessionID)
+
+	return a.revokeSession(ctx, identity.UserID, identity.SessionID)
+}
+
+func (a *authService) GetSessionList(ctx context.Context) (dto.SessionListResponse, error) {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return dto.SessionListResponse{}, unauthorizedError(CodeUnauthorized, "Authentication required")
+	}
+	a.log.Printf("Trying to get sessions of user %s", identity.UserID)
+
+	sessions, err := a.storage.GetSessionStorage().GetUserSessions(ctx, identity.UserID, time.Now())
+	if err != nil {
+		a.log.Printf("Error while get sessions from DB, reason: %+v", err)
+		return dto.SessionListResponse{}, internalError(err)
+	}
+
+	response := dto.SessionListResponse{Sessions: make([]dto.Session, 0, len(sessions))}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, dto.Session{
+			ID:        session.ID,
+			CreatedAt: float64(session.CreatedAt.UnixNano()) / float64(time.Second),
+			ExpiresAt: float64(session.ExpiresAt.UnixNano()) / float64(time.Second),
+			Current:   session.ID == identity.SessionID,
+		})
+	}
+
+	return response, nil
+}
+
+func (a *authService) RevokeSession(ctx context.Context, revokeSessionRequest dto.RevokeSessionRequest) error {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return err
+	}
+	a.log.Printf("Trying to revoke session: %s", revokeSessionRequest)
+	if revokeSessionRequest.SessionID == uuid.Nil {
+		return validationError("session_id", FieldRequired, "Session id is empty")
+	}
+
+	return a.revokeSession(ctx, userID, revokeSessionRequest.SessionID)
+}
+
+func (a *authService) revokeSession(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID) error {
+	var revoked bool
+	err := a.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		var err error
+		revoked, err = a.storage.GetSessionStorage().RevokeSession(ctx, tx, userID, sessionID, time.Now())
+		return err
+	})
+	if err != nil {
+		a.log.Printf("Error while revoke session in DB, reason: %+v", err)
+		return internalError(err)
+	}
+	if !revoked {
+		return notFoundError(CodeSessionNotFound, "Session is not exist or already revoked")
+	}
+
+	return nil
+}
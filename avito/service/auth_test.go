@@ -0,0 +1,81 @@
+package service
+
+import (
+	"avito/config"
+	"avito/dto"
+	"avito/storage"
+	"context"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+func newTestAuth(t *testing.T, accessTokenTTL time.Duration) (storage.StorageAPI, AuthServiceAPI, dto.AuthResponse) {
+	t.Helper()
+	api := storage.NewMemoryStorageAPI()
+	serviceAPI := NewServiceAPI(api, nil, config.AuthConfig{AccessTokenTTL: accessTokenTTL, RefreshTokenTTL: time.Hour}, config.MessageConfig{})
+	ctx := context.Background()
+
+	_, err := serviceAPI.GetUserService().CreateUser(ctx, dto.CreateUserRequest{Username: "alice", Password: "secret-password"})
+	if err != nil {
+		t.Fatalf("CreateUser: %+v", err)
+	}
+	login, err := serviceAPI.GetAuthService().Login(ctx, dto.LoginRequest{Username: "alice", Password: "secret-password"})
+	if err != nil {
+		t.Fatalf("Login: %+v", err)
+	}
+
+	return api, serviceAPI.GetAuthService(), login
+}
+
+func TestRefreshTokenIsSingleUse(t *testing.T) {
+	_, auth, login := newTestAuth(t, time.Hour)
+	ctx := context.Background()
+
+	refreshed, err := auth.Refresh(ctx, dto.RefreshRequest{RefreshToken: login.RefreshToken})
+	if err != nil {
+		t.Fatalf("Refresh: %+v", err)
+	}
+	if refreshed.SessionID != login.SessionID || refreshed.RefreshToken == login.RefreshToken {
+		t.Errorf("Refresh returned session %s and the same refresh token", refreshed.SessionID)
+	}
+
+	// повторное использование refresh token
+	_, err = auth.Refresh(ctx, dto.RefreshRequest{RefreshToken: login.RefreshToken})
+	if !isErrorCode(err, CodeInvalidRefreshToken) {
+		t.Errorf("Reused refresh token returned %v", err)
+	}
+
+	// прежний access-токен действует до истечения
+	for _, token := range []string{login.AccessToken, refreshed.AccessToken} {
+		if _, err := auth.Authenticate(ctx, token); err != nil {
+			t.Errorf("Authenticate: %+v", err)
+		}
+	}
+}
+
+func TestRefreshDeletesExpiredAccessTokens(t *testing.T) {
+	api, auth, login := newTestAuth(t, time.Millisecond)
+	ctx := context.Background()
+
+	time.Sleep(5 * time.Millisecond)
+	if _, err := auth.Authenticate(ctx, login.AccessToken); !isErrorCode(err, CodeTokenExpired) {
+		t.Fatalf("Expired access token returned %v", err)
+	}
+	if _, err := auth.Refresh(ctx, dto.RefreshRequest{RefreshToken: login.RefreshToken}); err != nil {
+		t.Fatalf("Refresh: %+v", err)
+	}
+
+	token, err := api.GetTokenStorage().GetToken(ctx, hashToken(login.AccessToken))
+	if err != nil {
+		t.Fatalf("GetToken: %+v", err)
+	}
+	if token.UserID != uuid.Nil {
+		t.Errorf("Expired access token is not deleted by refresh")
+	}
+}
+
+func isErrorCode(err error, code string) bool {
+	serviceErr, ok := err.(*Error)
+	return ok && serviceErr.Code == code
+}
@@ -1,101 +1,672 @@
 package service
 
 import (
-	"../dto"
-	"../storage"
+	"avito/dto"
+	"avito/events"
+	"avito/storage"
 	"context"
+	"fmt"
 	"github.com/google/uuid"
 	"golang.org/x/xerrors"
 	"log"
 	"os"
+	"strings"
 )
 
-// третий параметр в функциях - isInternal, для определения типа ошибки в handlers
+// ошибки бизнес-логики возвращаются как *Error, handlers по ним выбирают HTTP-статус
 type ChatServiceAPI interface {
-	CreateChat(createChatRequest dto.CreateChatRequest) (uuid.UUID, error, bool)
-	GetChatList(chatListRequest dto.ChatListRequest) ([]dto.Chat, error, bool)
+	CreateChat(ctx context.Context, createChatRequest dto.CreateChatRequest) (uuid.UUID, error)
+	// OpenDirectChat возвращает личный чат с пользователем, создавая его при первом обращении
+	OpenDirectChat(ctx context.Context, directChatRequest dto.DirectChatRequest) (dto.Chat, error)
+	GetChatList(ctx context.Context, chatListRequest dto.ChatListRequest) (dto.ChatListResponse, error)
+	// GetChat возвращает чат со всеми участниками, доступен только участникам чата
+	GetChat(ctx context.Context, chatRequest dto.ChatRequest) (dto.Chat, error)
+	// AddChatMembers, RemoveChatMember и SetMemberRole доступны владельцу и администраторам,
+	// управлять можно только участниками с ролью ниже своей
+	AddChatMembers(ctx context.Context, chatMembersRequest dto.ChatMembersRequest) (dto.ChatMembersResponse, error)
+	RemoveChatMember(ctx context.Context, removeChatMemberRequest dto.RemoveChatMemberRequest) error
+	SetMemberRole(ctx context.Context, setMemberRoleRequest dto.SetMemberRoleRequest) error
+	// LeaveChat доступен всем, кроме владельца: ему нужно сначала передать владение.
+	// Из личного чата выйти нельзя
+	LeaveChat(ctx context.Context, chatRequest dto.ChatRequest) error
+	// RenameChat доступен владельцу и администраторам, имя остается уникальным без учета регистра
+	RenameChat(ctx context.Context, renameChatRequest dto.RenameChatRequest) error
+	GetChatRenames(ctx context.Context, chatRequest dto.ChatRequest) (dto.ChatRenamesResponse, error)
+	// MarkChatRead передвигает указатель прочтения текущего пользователя вперед до сообщения,
+	// указатель назад не сдвигается
+	MarkChatRead(ctx context.Context, markChatReadRequest dto.MarkChatReadRequest) error
 }
 
 type chatService struct {
 	storage storage.StorageAPI
-	ctx context.Context
+	bus events.Bus
 	log *log.Logger
 }
 
-func NewChatServiceAPI(api storage.StorageAPI) ChatServiceAPI {
+func NewChatServiceAPI(api storage.StorageAPI, bus events.Bus) ChatServiceAPI {
 	return &chatService{
 		storage: api,
-		ctx: context.Background(),
+		bus: bus,
 		log: log.New(os.Stdout, "CHAT-SERVICE: ", log.LstdFlags),
 	}
 }
 
-func (c *chatService) GetChatList(chatListRequest dto.ChatListRequest) ([]dto.Chat, error, bool) {
+func (c *chatService) GetChatList(ctx context.Context, chatListRequest dto.ChatListRequest) (dto.ChatListResponse, error) {
 	c.log.Printf("Trying to get chats of user %s", chatListRequest)
-	ok, err := c.storage.GetUserStorage().CheckExistUsers(chatListRequest.User)
+	userID, err := checkActingUser(ctx, "user", chatListRequest.User)
 	if err != nil {
-		c.log.Printf("Error while check exist users, reason: %+v", err)
-		return nil, xerrors.Errorf("System error. Contact support"), true
+		return dto.ChatListResponse{}, err
 	}
-	if !ok {
-		return nil, xerrors.Errorf("User is not exist"), false
+
+	page, err := makePageParams(chatListRequest.Limit, dto.DirectionOlder, chatListRequest.Cursor)
+	if err != nil {
+		return dto.ChatListResponse{}, err
+	}
+	if chatListRequest.UsersLimit < 0 {
+		return dto.ChatListResponse{}, validationError("users_limit", FieldOutOfRange, "Users limit must not be negative")
+	}
+
+	params := storage.ChatListParams{
+		Page:       page,
+		NamePrefix: chatListRequest.NamePrefix,
+		UsersLimit: chatListRequest.UsersLimit,
+	}
+	if chatListRequest.OmitUsers {
+		params.UsersLimit = -1
 	}
 
-	chats, err := c.storage.GetChatStorage().GetChatList(chatListRequest.User)
+	chats, err := c.storage.GetChatStorage().GetChatList(ctx, userID, params)
 	if err != nil {
 		c.log.Printf("Error while get chats from DB, reason: %+v", err)
-		return nil, xerrors.Errorf("System error. Contact support"), true
+		return dto.ChatListResponse{}, internalError(err)
+	}
+
+	response := dto.ChatListResponse{ChatList: chats.Chats}
+	if chats.HasMore {
+		response.NextCursor = chats.Last.Encode()
 	}
 
-	return chats, nil, false
+	return response, nil
 }
 
-func (c *chatService) CreateChat(createChatRequest dto.CreateChatRequest) (uuid.UUID, error, bool) {
+func (c *chatService) GetChat(ctx context.Context, chatRequest dto.ChatRequest) (dto.Chat, error) {
+	c.log.Printf("Trying to get chat: %s", chatRequest)
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return dto.Chat{}, err
+	}
+
+	if _, err := chatMemberRole(ctx, c.storage, c.log, userID, chatRequest.Chat); err != nil {
+		return dto.Chat{}, err
+	}
+
+	chat, err := c.storage.GetChatStorage().GetChat(ctx, chatRequest.Chat)
+	if err != nil {
+		c.log.Printf("Error while get chat from DB, reason: %+v", err)
+		return dto.Chat{}, internalError(err)
+	}
+	if chat.ID == uuid.Nil {
+		return dto.Chat{}, notFoundError(CodeChatNotFound, "Chat doesn't exist")
+	}
+
+	return chat, nil
+}
+
+func (c *chatService) CreateChat(ctx context.Context, createChatRequest dto.CreateChatRequest) (uuid.UUID, error) {
 	c.log.Printf("Trying to create chat: %s", createChatRequest.Name)
-	if len(createChatRequest.Name) == 0 {
-		return uuid.Nil, xerrors.Errorf("Chat name is empty"), false
+	name := strings.TrimSpace(createChatRequest.Name)
+	if len(name) == 0 {
+		return uuid.Nil, validationError("name", FieldRequired, "Chat name is empty")
+	}
+	if err := c.checkChatNameFree(ctx, name, uuid.Nil); err != nil {
+		return uuid.Nil, err
 	}
 	c.log.Printf("Chat name is valid")
 
-	if len(createChatRequest.Users) <= 1 {
-		return uuid.Nil, xerrors.Errorf("Not enough users to create chat"), false
+	creator, err := currentUser(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// создатель всегда становится участником чата, повторы в списке пропускаются
+	users := uniqueUUIDs(append([]uuid.UUID{creator}, createChatRequest.Users...))
+
+	if len(users) <= 1 {
+		return uuid.Nil, validationError("users", FieldTooShort, "Not enough users to create chat")
 	}
 	c.log.Printf("Enough users to create chat")
 
-	ok, err := c.storage.GetUserStorage().CheckExistUsers(createChatRequest.Users...)
+	ok, err := c.storage.GetUserStorage().CheckExistUsers(ctx, users...)
 	if err != nil {
 		c.log.Printf("Error while exist users in DB, reason: %+v", err)
-		return uuid.Nil, xerrors.Errorf("System error. Contact support"), true
+		return uuid.Nil, internalError(err)
 	}
 	if !ok {
-		return uuid.Nil, xerrors.Errorf("One or more users are not exist"), false
+		return uuid.Nil, notFoundError(CodeUserNotFound, "One or more users are not exist")
 	}
 
-	tx, err := c.storage.GetTransaction(c.ctx)
+	var chat dto.Chat
+	err = c.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		var err error
+		chat, err = c.storage.GetChatStorage().CreateChat(ctx, tx, name)
+		if err != nil {
+			return xerrors.Errorf("Cannot create chat: %w", err)
+		}
+
+		err = c.storage.GetChatStorage().CreateRecordChatsUsers(ctx, tx, chat.ID, dto.RoleOwner, creator)
+		if err != nil {
+			return xerrors.Errorf("Cannot create record in chats_users: %w", err)
+		}
+
+		err = c.storage.GetChatStorage().CreateRecordChatsUsers(ctx, tx, chat.ID, dto.RoleMember, users[1:]...)
+		if err != nil {
+			return xerrors.Errorf("Cannot create record in chats_users: %w", err)
+		}
+
+		chat.Users = users
+		chat.UsersCount = len(chat.Users)
+		return publishEvent(ctx, c.bus, tx, events.ChatCreated, chat.ID, chat.Users, chat)
+	})
 	if err != nil {
-		c.log.Printf("Error while create transaction, reason: %+v", err)
-		return uuid.Nil, xerrors.Errorf("System error. Contact support"), true
+		c.log.Printf("Error while create chat in DB, reason: %+v", err)
+		// имя могли занять параллельным запросом между проверкой и вставкой
+		if xerrors.Is(err, storage.ErrChatNameTaken) {
+			return uuid.Nil, conflictError(CodeChatNameTaken, "Chat with this name already exists")
+		}
+		return uuid.Nil, internalError(err)
 	}
 
-	chatID, err := c.storage.GetChatStorage().CreateChat(tx, createChatRequest.Name)
+	return chat.ID, nil
+}
+
+func (c *chatService) OpenDirectChat(ctx context.Context, directChatRequest dto.DirectChatRequest) (dto.Chat, error) {
+	c.log.Printf("Trying to open direct chat: %s", directChatRequest)
+	actor, err := currentUser(ctx)
 	if err != nil {
-		c.log.Printf("Error while create chat in DB, reason: %+v", err)
-		tx.Rollback(c.ctx)
-		return uuid.Nil, xerrors.Errorf("System error. Contact support"), true
+		return dto.Chat{}, err
+	}
+
+	peer := directChatRequest.User
+	if peer == uuid.Nil {
+		return dto.Chat{}, validationError("user", FieldRequired, "User is empty")
+	}
+	if peer == actor {
+		return dto.Chat{}, validationError("user", FieldInvalidValue, "Cannot create direct chat with yourself")
+	}
+
+	ok, err := c.storage.GetUserStorage().CheckExistUsers(ctx, peer)
+	if err != nil {
+		c.log.Printf("Error while exist users in DB, reason: %+v", err)
+		return dto.Chat{}, internalError(err)
+	}
+	if !ok {
+		return dto.Chat{}, notFoundError(CodeUserNotFound, "User doesn't exist")
+	}
+
+	chatID, err := c.storage.GetChatStorage().GetDirectChat(ctx, actor, peer)
+	if err != nil {
+		c.log.Printf("Error while get direct chat from DB, reason: %+v", err)
+		return dto.Chat{}, internalError(err)
+	}
+
+	created := false
+	if chatID == uuid.Nil {
+		var chat dto.Chat
+		err = c.storage.RunInTx(ctx, func(tx storage.Tx) error {
+			var err error
+			chat, err = c.storage.GetChatStorage().CreateDirectChat(ctx, tx, actor, peer)
+			if err != nil {
+				return xerrors.Errorf("Cannot create direct chat: %w", err)
+			}
+			if chat.ID == uuid.Nil {
+				return nil
+			}
+
+			err = c.storage.GetChatStorage().CreateRecordChatsUsers(ctx, tx, chat.ID, dto.RoleMember, actor, peer)
+			if err != nil {
+				return xerrors.Errorf("Cannot create record in chats_users: %w", err)
+			}
+
+			chat.Users = []uuid.UUID{actor, peer}
+			chat.UsersCount = len(chat.Users)
+			chat.Members = []dto.ChatMember{{User: actor, Role: dto.RoleMember}, {User: peer, Role: dto.RoleMember}}
+			return publishEvent(ctx, c.bus, tx, events.ChatCreated, chat.ID, chat.Users, chat)
+		})
+		if err != nil {
+			c.log.Printf("Error while create direct chat in DB, reason: %+v", err)
+			return dto.Chat{}, internalError(err)
+		}
+		created = chat.ID != uuid.Nil
+		chatID = chat.ID
+
+		// чат этой пары создан параллельным запросом, возвращаем его
+		if !created {
+			chatID, err = c.storage.GetChatStorage().GetDirectChat(ctx, actor, peer)
+			if err != nil {
+				c.log.Printf("Error while get direct chat from DB, reason: %+v", err)
+				return dto.Chat{}, internalError(err)
+			}
+			if chatID == uuid.Nil {
+				return dto.Chat{}, internalError(xerrors.Errorf("Direct chat of %s and %s is not found", actor, peer))
+			}
+		}
+	}
+
+	chat, err := c.storage.GetChatStorage().GetChat(ctx, chatID)
+	if err != nil {
+		c.log.Printf("Error while get chat from DB, reason: %+v", err)
+		return dto.Chat{}, internalError(err)
+	}
+	if chat.ID == uuid.Nil {
+		return dto.Chat{}, notFoundError(CodeChatNotFound, "Chat doesn't exist")
+	}
+
+	return chat, nil
+}
+
+func (c *chatService) AddChatMembers(ctx context.Context, chatMembersRequest dto.ChatMembersRequest) (dto.ChatMembersResponse, error) {
+	c.log.Printf("Trying to add members to chat: %s", chatMembersRequest)
+	actor, err := currentUser(ctx)
+	if err != nil {
+		return dto.ChatMembersResponse{}, err
+	}
+	if len(chatMembersRequest.Users) == 0 {
+		return dto.ChatMembersResponse{}, validationError("users", FieldRequired, "Users list is empty")
+	}
+
+	role := chatMembersRequest.Role
+	if len(role) == 0 {
+		role = dto.RoleMember
+	}
+	if !isValidRole(role) || role == dto.RoleOwner {
+		return dto.ChatMembersResponse{}, validationError("role", FieldInvalidFormat, "Role must be admin, member or readonly")
+	}
+
+	actorRole, err := checkPermission(ctx, c.storage, c.log, actor, chatMembersRequest.Chat, permissionManageMembers)
+	if err != nil {
+		return dto.ChatMembersResponse{}, err
+	}
+	if !outranks(actorRole, role) {
+		return dto.ChatMembersResponse{}, forbiddenError(CodeInsufficientRole, fmt.Sprintf("Role %s cannot add members with role %s", actorRole, role))
+	}
+
+	users := uniqueUUIDs(chatMembersRequest.Users)
+	ok, err := c.storage.GetUserStorage().CheckExistUsers(ctx, users...)
+	if err != nil {
+		c.log.Printf("Error while exist users in DB, reason: %+v", err)
+		return dto.ChatMembersResponse{}, internalError(err)
+	}
+	if !ok {
+		return dto.ChatMembersResponse{}, notFoundError(CodeUserNotFound, "One or more users are not exist")
+	}
+
+	members, err := c.storage.GetChatStorage().GetChatUsers(ctx, chatMembersRequest.Chat)
+	if err != nil {
+		c.log.Printf("Error while get chat members from DB, reason: %+v", err)
+		return dto.ChatMembersResponse{}, internalError(err)
+	}
+
+	var added []uuid.UUID
+	err = c.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		var err error
+		added, err = c.storage.GetChatStorage().AddChatUsers(ctx, tx, chatMembersRequest.Chat, role, users...)
+		if err != nil {
+			return xerrors.Errorf("Cannot add users to chat: %w", err)
+		}
+		if len(added) == 0 {
+			return nil
+		}
+
+		messages := make([]dto.Message, 0, len(added))
+		for _, user := range added {
+			message, err := c.storage.GetMessageStorage().CreateSystemMessage(ctx, tx, actor, chatMembersRequest.Chat, dto.MessageUserAdded, user, "")
+			if err != nil {
+				return xerrors.Errorf("Cannot create system message: %w", err)
+			}
+			messages = append(messages, message)
+		}
+
+		return c.publishMembersChanged(ctx, tx, chatMembersRequest.Chat, members, added, nil, messages)
+	})
+	if err != nil {
+		c.log.Printf("Error while add chat members in DB, reason: %+v", err)
+		return dto.ChatMembersResponse{}, internalError(err)
+	}
+
+	return dto.ChatMembersResponse{Added: added}, nil
+}
+
+func (c *chatService) RemoveChatMember(ctx context.Context, removeChatMemberRequest dto.RemoveChatMemberRequest) error {
+	c.log.Printf("Trying to remove member from chat: %s", removeChatMemberRequest)
+	actor, err := currentUser(ctx)
+	if err != nil {
+		return err
+	}
+	if removeChatMemberRequest.User == uuid.Nil {
+		return validationError("user", FieldRequired, "User is empty")
+	}
+
+	return c.removeMember(ctx, actor, removeChatMemberRequest.Chat, removeChatMemberRequest.User)
+}
+
+func (c *chatService) LeaveChat(ctx context.Context, chatRequest dto.ChatRequest) error {
+	c.log.Printf("Trying to leave chat: %s", chatRequest)
+	actor, err := currentUser(ctx)
+	if err != nil {
+		return err
 	}
 
-	err = c.storage.GetChatStorage().CreateRecordChatsUsers(tx, chatID, createChatRequest.Users...)
+	return c.removeMember(ctx, actor, chatRequest.Chat, actor)
+}
+
+// removeMember удаляет user из чата от имени actor, удаление самого себя записывается как выход из чата
+func (c *chatService) removeMember(ctx context.Context, actor uuid.UUID, chat uuid.UUID, user uuid.UUID) error {
+	messageType := dto.MessageUserLeft
+	if actor == user {
+		role, err := chatMemberRole(ctx, c.storage, c.log, actor, chat)
+		if err != nil {
+			return err
+		}
+		if role == dto.RoleOwner {
+			return conflictError(CodeOwnerCannotLeave, "Owner must transfer ownership before leaving chat")
+		}
+		chatType, err := c.storage.GetChatStorage().GetChatType(ctx, chat)
+		if err != nil {
+			c.log.Printf("Error while get chat type from DB, reason: %+v", err)
+			return internalError(err)
+		}
+		if chatType == dto.ChatDirect {
+			return conflictError(CodeDirectChat, "Cannot leave direct chat")
+		}
+	} else {
+		messageType = dto.MessageUserRemoved
+		actorRole, err := checkPermission(ctx, c.storage, c.log, actor, chat, permissionManageMembers)
+		if err != nil {
+			return err
+		}
+		if err := c.checkOutranks(ctx, actorRole, chat, user); err != nil {
+			return err
+		}
+	}
+
+	members, err := c.storage.GetChatStorage().GetChatUsers(ctx, chat)
+	if err != nil {
+		c.log.Printf("Error while get chat members from DB, reason: %+v", err)
+		return internalError(err)
+	}
+
+	var removed bool
+	err = c.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		var err error
+		removed, err = c.storage.GetChatStorage().RemoveChatUser(ctx, tx, chat, user)
+		if err != nil {
+			return xerrors.Errorf("Cannot remove user from chat: %w", err)
+		}
+		if !removed {
+			return nil
+		}
+
+		message, err := c.storage.GetMessageStorage().CreateSystemMessage(ctx, tx, actor, chat, messageType, user, "")
+		if err != nil {
+			return xerrors.Errorf("Cannot create system message: %w", err)
+		}
+
+		return c.publishMembersChanged(ctx, tx, chat, members, nil, []uuid.UUID{user}, []dto.Message{message})
+	})
+	if err != nil {
+		c.log.Printf("Error while remove chat member in DB, reason: %+v", err)
+		return internalError(err)
+	}
+	if !removed {
+		return notFoundError(CodeMemberNotFound, "User doesn't consist in chat")
+	}
+
+	return nil
+}
+
+func (c *chatService) SetMemberRole(ctx context.Context, setMemberRoleRequest dto.SetMemberRoleRequest) error {
+	c.log.Printf("Trying to set role of chat member: %s", setMemberRoleRequest)
+	actor, err := currentUser(ctx)
+	if err != nil {
+		return err
+	}
+	if setMemberRoleRequest.User == uuid.Nil {
+		return validationError("user", FieldRequired, "User is empty")
+	}
+	if !isValidRole(setMemberRoleRequest.Role) {
+		return validationError("role", FieldInvalidFormat, "Role must be owner, admin, member or readonly")
+	}
+
+	chat, user, role := setMemberRoleRequest.Chat, setMemberRoleRequest.User, setMemberRoleRequest.Role
+	actorRole, err := checkPermission(ctx, c.storage, c.log, actor, chat, permissionManageMembers)
+	if err != nil {
+		return err
+	}
+	if err := c.checkOutranks(ctx, actorRole, chat, user); err != nil {
+		return err
+	}
+
+	// передать владение может только владелец, сам он при этом становится администратором
+	changes := []dto.ChatMember{{User: user, Role: role}}
+	if role == dto.RoleOwner {
+		if actorRole != dto.RoleOwner {
+			return forbiddenError(CodeInsufficientRole, "Only owner can transfer ownership")
+		}
+		changes = append(changes, dto.ChatMember{User: actor, Role: dto.RoleAdmin})
+	} else if !outranks(actorRole, role) {
+		return forbiddenError(CodeInsufficientRole, fmt.Sprintf("Role %s cannot assign role %s", actorRole, role))
+	}
+
+	err = c.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		for _, change := range changes {
+			ok, err := c.storage.GetChatStorage().SetChatUserRole(ctx, tx, chat, change.User, change.Role)
+			if err != nil {
+				return xerrors.Errorf("Cannot set role: %w", err)
+			}
+			if !ok {
+				return xerrors.Errorf("User %s was removed from chat %s", change.User, chat)
+			}
+		}
+
+		return publishEvent(ctx, c.bus, tx, events.ChatRolesChanged, chat, nil, dto.ChatRolesChanged{Chat: chat, Members: changes})
+	})
 	if err != nil {
-		c.log.Printf("Error while create record in chats_users, reason: %+v", err)
-		tx.Rollback(c.ctx)
-		return uuid.Nil, xerrors.Errorf("System error. Contact support"), true
+		c.log.Printf("Error while set role in DB, reason: %+v", err)
+		return internalError(err)
 	}
 
-	err = tx.Commit(c.ctx)
+	return nil
+}
+
+func (c *chatService) RenameChat(ctx context.Context, renameChatRequest dto.RenameChatRequest) error {
+	c.log.Printf("Trying to rename chat: %s", renameChatRequest)
+	actor, err := currentUser(ctx)
 	if err != nil {
-		c.log.Printf("Error while commit transaction, reason: %+v", err)
-		return uuid.Nil, xerrors.Errorf("System error. Contact support"), true
+		return err
 	}
 
-	return chatID, nil, false
+	chat, name := renameChatRequest.Chat, strings.TrimSpace(renameChatRequest.Name)
+	if len(name) == 0 {
+		return validationError("name", FieldRequired, "Chat name is empty")
+	}
+	if _, err := checkPermission(ctx, c.storage, c.log, actor, chat, permissionRename); err != nil {
+		return err
+	}
+	if err := c.checkChatNameFree(ctx, name, chat); err != nil {
+		return err
+	}
+
+	var rename dto.ChatRename
+	err = c.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		var err error
+		rename, err = c.storage.GetChatStorage().RenameChat(ctx, tx, chat, name, actor)
+		if err != nil {
+			return xerrors.Errorf("Cannot rename chat: %w", err)
+		}
+		if rename.Chat == uuid.Nil || rename.OldName == rename.NewName {
+			return nil
+		}
+
+		message, err := c.storage.GetMessageStorage().CreateSystemMessage(ctx, tx, actor, chat, dto.MessageChatRenamed, uuid.Nil, name)
+		if err != nil {
+			return xerrors.Errorf("Cannot create system message: %w", err)
+		}
+
+		if err := publishEvent(ctx, c.bus, tx, events.ChatRenamed, chat, nil, rename); err != nil {
+			return err
+		}
+		return publishEvent(ctx, c.bus, tx, events.MessageCreated, chat, nil, message)
+	})
+	if err != nil {
+		c.log.Printf("Error while rename chat in DB, reason: %+v", err)
+		if xerrors.Is(err, storage.ErrChatNameTaken) {
+			return conflictError(CodeChatNameTaken, "Chat with this name already exists")
+		}
+		return internalError(err)
+	}
+	if rename.Chat == uuid.Nil {
+		return notFoundError(CodeChatNotFound, "Chat doesn't exist")
+	}
+
+	return nil
+}
+
+func (c *chatService) GetChatRenames(ctx context.Context, chatRequest dto.ChatRequest) (dto.ChatRenamesResponse, error) {
+	c.log.Printf("Trying to get renames of chat: %s", chatRequest)
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return dto.ChatRenamesResponse{}, err
+	}
+	if _, err := chatMemberRole(ctx, c.storage, c.log, userID, chatRequest.Chat); err != nil {
+		return dto.ChatRenamesResponse{}, err
+	}
+
+	renames, err := c.storage.GetChatStorage().GetChatRenames(ctx, chatRequest.Chat)
+	if err != nil {
+		c.log.Printf("Error while get chat renames from DB, reason: %+v", err)
+		return dto.ChatRenamesResponse{}, internalError(err)
+	}
+
+	return dto.ChatRenamesResponse{Renames: renames}, nil
+}
+
+func (c *chatService) MarkChatRead(ctx context.Context, markChatReadRequest dto.MarkChatReadRequest) error {
+	c.log.Printf("Trying to mark chat read: %s", markChatReadRequest)
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	chat := markChatReadRequest.Chat
+	if _, err := chatMemberRole(ctx, c.storage, c.log, userID, chat); err != nil {
+		return err
+	}
+	message, err := c.storage.GetMessageStorage().GetMessage(ctx, markChatReadRequest.Message)
+	if err != nil {
+		c.log.Printf("Error while get message from DB, reason: %+v", err)
+		return internalError(err)
+	}
+	if message.ID == uuid.Nil {
+		return notFoundError(CodeMessageNotFound, "Message doesn't exist")
+	}
+	if message.Chat != chat {
+		return validationError("message", FieldInvalidValue, "Message belongs to another chat")
+	}
+
+	err = c.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		moved, err := c.storage.GetChatStorage().MarkChatRead(ctx, tx, chat, userID, message.ID)
+		if err != nil || !moved {
+			return err
+		}
+
+		return publishEvent(ctx, c.bus, tx, events.ChatRead, chat, nil, dto.ChatRead{Chat: chat, User: userID, Message: message.ID})
+	})
+	if err != nil {
+		c.log.Printf("Error while mark chat read in DB, reason: %+v", err)
+		return internalError(err)
+	}
+
+	return nil
+}
+
+// checkChatNameFree возвращает Conflict, если имя без учета регистра занято другим чатом
+func (c *chatService) checkChatNameFree(ctx context.Context, name string, except uuid.UUID) error {
+	taken, err := c.storage.GetChatStorage().IsChatNameTaken(ctx, name, except)
+	if err != nil {
+		c.log.Printf("Error while check chat name in DB, reason: %+v", err)
+		return internalError(err)
+	}
+	if taken {
+		return conflictError(CodeChatNameTaken, "Chat with this name already exists")
+	}
+
+	return nil
+}
+
+// checkOutranks проверяет, что user состоит в чате и его роль ниже actorRole
+func (c *chatService) checkOutranks(ctx context.Context, actorRole string, chat uuid.UUID, user uuid.UUID) error {
+	role, err := c.storage.GetChatStorage().GetChatUserRole(ctx, chat, user)
+	if err != nil {
+		c.log.Printf("Error while get role of user in chat, reason: %+v", err)
+		return internalError(err)
+	}
+	if len(role) == 0 {
+		return notFoundError(CodeMemberNotFound, "User doesn't consist in chat")
+	}
+	if !outranks(actorRole, role) {
+		return forbiddenError(CodeInsufficientRole, fmt.Sprintf("Role %s cannot manage members with role %s", actorRole, role))
+	}
+
+	return nil
+}
+
+// publishMembersChanged рассылает изменение состава участников текущим и удаленным участникам,
+// а системные сообщения - текущим участникам. Состав после изменения считается от members до транзакции
+func (c *chatService) publishMembersChanged(ctx context.Context, tx storage.Tx, chat uuid.UUID, members []uuid.UUID,
+	added []uuid.UUID, removed []uuid.UUID, messages []dto.Message) error {
+	if added == nil {
+		added = make([]uuid.UUID, 0)
+	}
+	if removed == nil {
+		removed = make([]uuid.UUID, 0)
+	}
+
+	excluded := make(map[uuid.UUID]struct{}, len(removed))
+	for _, user := range removed {
+		excluded[user] = struct{}{}
+	}
+	users := make([]uuid.UUID, 0, len(members)+len(added))
+	for _, user := range uniqueUUIDs(append(append(make([]uuid.UUID, 0, len(members)+len(added)), members...), added...)) {
+		if _, ok := excluded[user]; !ok {
+			users = append(users, user)
+		}
+	}
+
+	change := dto.ChatMembersChanged{Chat: chat, Added: added, Removed: removed, Users: users}
+	recipients := append(append(make([]uuid.UUID, 0, len(users)+len(removed)), users...), removed...)
+	if err := publishEvent(ctx, c.bus, tx, events.ChatMembersChanged, chat, recipients, change); err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		if err := publishEvent(ctx, c.bus, tx, events.MessageCreated, chat, nil, message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// uniqueUUIDs убирает повторы, сохраняя порядок первого появления
+func uniqueUUIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]struct{}, len(ids))
+	result := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		result = append(result, id)
+	}
+	return result
 }
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"avito/dto"
+	"github.com/google/uuid"
+	"sync"
+	"testing"
+)
+
+func TestOpenDirectChatIsIdempotent(t *testing.T) {
+	forEachServiceAPI(t, func(t *testing.T, serviceAPI ServiceAPI) {
+		chatService := serviceAPI.GetChatService()
+		alice := newTestUser(t, serviceAPI, "alice")
+		bob := newTestUser(t, serviceAPI, "bob")
+		aliceID, _ := UserFromContext(alice)
+		bobID, _ := UserFromContext(bob)
+
+		chat, err := chatService.OpenDirectChat(alice, dto.DirectChatRequest{User: bobID})
+		if err != nil {
+			t.Fatalf("OpenDirectChat: %+v", err)
+		}
+		if chat.Type != dto.ChatDirect || chat.UsersCount != 2 {
+			t.Errorf("Unexpected direct chat %s", chat)
+		}
+		// пара пользователей не упорядочена: чат тот же, кто бы его ни открыл
+		again, err := chatService.OpenDirectChat(alice, dto.DirectChatRequest{User: bobID})
+		if err != nil {
+			t.Fatalf("Repeated OpenDirectChat: %+v", err)
+		}
+		reverse, err := chatService.OpenDirectChat(bob, dto.DirectChatRequest{User: aliceID})
+		if err != nil {
+			t.Fatalf("Reverse OpenDirectChat: %+v", err)
+		}
+		if again.ID != chat.ID || reverse.ID != chat.ID {
+			t.Errorf("Direct chats %s, %s and %s differ", chat.ID, again.ID, reverse.ID)
+		}
+
+		if _, err := chatService.OpenDirectChat(alice, dto.DirectChatRequest{User: aliceID}); !isErrorKind(err, KindValidation) {
+			t.Errorf("Direct chat with yourself returned %v", err)
+		}
+		if _, err := chatService.OpenDirectChat(alice, dto.DirectChatRequest{User: uuid.Must(uuid.NewUUID())}); !isErrorCode(err, CodeUserNotFound) {
+			t.Errorf("Direct chat with unknown user returned %v", err)
+		}
+		if err := chatService.LeaveChat(bob, dto.ChatRequest{Chat: chat.ID}); !isErrorCode(err, CodeDirectChat) {
+			t.Errorf("Leave direct chat returned %v", err)
+		}
+	})
+}
+
+func TestOpenDirectChatConcurrently(t *testing.T) {
+	forEachServiceAPI(t, func(t *testing.T, serviceAPI ServiceAPI) {
+		chatService := serviceAPI.GetChatService()
+		alice := newTestUser(t, serviceAPI, "alice")
+		bob := newTestUser(t, serviceAPI, "bob")
+		aliceID, _ := UserFromContext(alice)
+		bobID, _ := UserFromContext(bob)
+
+		// запросы с обеих сторон получают один и тот же чат
+		const requests = 8
+		ids := make([]uuid.UUID, requests)
+		errs := make([]error, requests)
+		var wg sync.WaitGroup
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				var chat dto.Chat
+				if i%2 == 0 {
+					chat, errs[i] = chatService.OpenDirectChat(alice, dto.DirectChatRequest{User: bobID})
+				} else {
+					chat, errs[i] = chatService.OpenDirectChat(bob, dto.DirectChatRequest{User: aliceID})
+				}
+				ids[i] = chat.ID
+			}(i)
+		}
+		wg.Wait()
+
+		for i := range ids {
+			if errs[i] != nil {
+				t.Fatalf("OpenDirectChat: %+v", errs[i])
+			}
+			if ids[i] != ids[0] {
+				t.Errorf("Concurrent requests returned chats %s and %s", ids[0], ids[i])
+			}
+		}
+		list, err := chatService.GetChatList(alice, dto.ChatListRequest{User: aliceID})
+		if err != nil {
+			t.Fatalf("GetChatList: %+v", err)
+		}
+		if len(list.ChatList) != 1 {
+			t.Errorf("User has %d chats, expected one direct chat", len(list.ChatList))
+		}
+	})
+}
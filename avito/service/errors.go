@@ -0,0 +1,106 @@
+package service
+
+import (
+	"avito/dto"
+	"context"
+	"errors"
+	"fmt"
+)
+
+type ErrorKind int
+
+const (
+	KindValidation ErrorKind = iota
+	KindNotFound
+	KindConflict
+	KindForbidden
+	KindUnauthorized
+	KindInternal
+	KindTimeout
+)
+
+// коды ошибок - часть API, клиенты могут на них опираться, поэтому существующие коды не меняются
+const (
+	CodeValidationFailed    = "validation_failed"
+	CodeUserNotFound        = "user_not_found"
+	CodeChatNotFound        = "chat_not_found"
+	CodeMessageNotFound     = "message_not_found"
+	CodeUserAlreadyExists   = "user_already_exists"
+	CodeChatNameTaken       = "chat_name_taken"
+	CodeNotChatMember       = "not_chat_member"
+	CodeMemberNotFound      = "member_not_found"
+	CodeInsufficientRole    = "insufficient_role"
+	CodeNotMessageAuthor    = "not_message_author"
+	CodeEditWindowExpired   = "edit_window_expired"
+	CodeMessageDeleted      = "message_deleted"
+	CodeOwnerCannotLeave    = "owner_cannot_leave"
+	CodeDirectChat          = "direct_chat"
+	CodeChatTooLarge        = "chat_too_large"
+	CodeUnauthorized        = "unauthorized"
+	CodeTokenExpired        = "token_expired"
+	CodeInvalidCredentials  = "invalid_credentials"
+	CodeInvalidRefreshToken = "invalid_refresh_token"
+	CodeNotSessionToken     = "not_session_token"
+	CodeSessionNotFound     = "session_not_found"
+	CodeUserMismatch        = "user_mismatch"
+	CodeInternal            = "internal_error"
+	CodeRequestTimeout      = "request_timeout"
+)
+
+// коды ошибок отдельных полей в Details
+const (
+	FieldRequired      = "required"
+	FieldTooShort      = "too_short"
+	FieldInvalidFormat = "invalid_format"
+	FieldOutOfRange    = "out_of_range"
+	FieldInvalidValue  = "invalid_value"
+)
+
+// Error - ошибка бизнес-логики, по Kind handlers выбирают HTTP-статус
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Details []dto.FieldError
+}
+
+func (e *Error) Error() string {
+	if len(e.Details) == 0 {
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s: %s %v", e.Code, e.Message, e.Details)
+}
+
+func validationError(field, code, message string) error {
+	return &Error{
+		Kind:    KindValidation,
+		Code:    CodeValidationFailed,
+		Message: message,
+		Details: []dto.FieldError{{Field: field, Code: code, Message: message}},
+	}
+}
+
+func notFoundError(code, message string) error {
+	return &Error{Kind: KindNotFound, Code: code, Message: message}
+}
+
+func conflictError(code, message string) error {
+	return &Error{Kind: KindConflict, Code: code, Message: message}
+}
+
+func forbiddenError(code, message string) error {
+	return &Error{Kind: KindForbidden, Code: code, Message: message}
+}
+
+func unauthorizedError(code, message string) error {
+	return &Error{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+// internalError не раскрывает причину клиенту, причина логируется в месте возникновения.
+// Ошибки из-за истекшего или отмененного контекста запроса возвращаются отдельным типом
+func internalError(cause error) error {
+	if errors.Is(cause, context.DeadlineExceeded) || errors.Is(cause, context.Canceled) {
+		return &Error{Kind: KindTimeout, Code: CodeRequestTimeout, Message: "Request timed out"}
+	}
+	return &Error{Kind: KindInternal, Code: CodeInternal, Message: "System error. Contact support"}
+}
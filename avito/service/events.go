@@ -0,0 +1,24 @@
+package service
+
+import (
+	"avito/events"
+	"avito/storage"
+	"context"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+)
+
+// publishEvent публикует событие в транзакции tx: клиенты получат его только после коммита.
+// recipients == nil - событие для всех участников чата
+func publishEvent(ctx context.Context, bus events.Bus, tx storage.Tx, eventType string, chat uuid.UUID, recipients []uuid.UUID, payload interface{}) error {
+	event, err := events.NewEvent(eventType, chat, recipients, payload)
+	if err != nil {
+		return xerrors.Errorf("Cannot create event %s: %w", eventType, err)
+	}
+
+	if err := bus.Publish(ctx, tx, event); err != nil {
+		return xerrors.Errorf("Cannot publish event %s: %w", event, err)
+	}
+
+	return nil
+}
@@ -1,92 +1,593 @@
 package service
 
 import (
-	"../dto"
-	"../storage"
+	"avito/config"
+	"avito/dto"
+	"avito/events"
+	"avito/storage"
 	"context"
+	"fmt"
 	"github.com/google/uuid"
-	"golang.org/x/xerrors"
 	"log"
 	"os"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
-// третий параметр в функциях - isInternal, для определения типа ошибки в handlers
+const maxEmojiRunes = 16
+
+// в больших чатах список прочитавших не отдается: он слишком длинный и дорогой
+const maxReadReceiptsChatSize = 100
+
+// ошибки бизнес-логики возвращаются как *Error, handlers по ним выбирают HTTP-статус
 type MessageServiceAPI interface {
-	SendMessage(sendMessageRequest dto.SendMessageRequest) (uuid.UUID, error, bool)
-	GetMessageList(getMessageList dto.MessageListRequest) ([]dto.Message, error, bool)
+	SendMessage(ctx context.Context, sendMessageRequest dto.SendMessageRequest) (uuid.UUID, error)
+	GetMessageList(ctx context.Context, getMessageList dto.MessageListRequest) (dto.MessageListResponse, error)
+	// GetThread возвращает корневое сообщение и страницу ответов на него
+	GetThread(ctx context.Context, threadRequest dto.ThreadRequest) (dto.ThreadResponse, error)
+	// EditMessage доступен только автору сообщения, пока не истекло окно редактирования
+	EditMessage(ctx context.Context, editMessageRequest dto.EditMessageRequest) (dto.Message, error)
+	GetMessageRevisions(ctx context.Context, messageRequest dto.MessageRequest) (dto.MessageRevisionsResponse, error)
+	// GetReadReceipts возвращает участников, прочитавших сообщение, только для небольших чатов
+	GetReadReceipts(ctx context.Context, messageRequest dto.MessageRequest) (dto.ReadReceiptsResponse, error)
+	// SearchMessages ищет по тексту сообщений в чатах текущего пользователя
+	SearchMessages(ctx context.Context, searchRequest dto.SearchMessagesRequest) (dto.SearchMessagesResponse, error)
+	// DeleteMessage скрывает сообщение у текущего пользователя или удаляет его у всех участников
+	DeleteMessage(ctx context.Context, deleteMessageRequest dto.DeleteMessageRequest) error
+	// AddReaction и RemoveReaction доступны участникам чата, повторный вызов ничего не меняет
+	AddReaction(ctx context.Context, reactionRequest dto.ReactionRequest) error
+	RemoveReaction(ctx context.Context, reactionRequest dto.ReactionRequest) error
+	// PinMessage и UnpinMessage доступны владельцу и администраторам чата, повторный вызов ничего не меняет
+	PinMessage(ctx context.Context, messageRequest dto.MessageRequest) error
+	UnpinMessage(ctx context.Context, messageRequest dto.MessageRequest) error
+	// GetPinnedMessages возвращает закрепленные сообщения чата от последних закрепленных к ранним
+	GetPinnedMessages(ctx context.Context, chatRequest dto.ChatRequest) (dto.PinnedMessagesResponse, error)
+	// PurgeDeletedMessages стирает текст сообщений, удаленных раньше срока хранения
+	PurgeDeletedMessages(ctx context.Context) (int, error)
 }
 
 type messageService struct {
 	storage storage.StorageAPI
-	ctx context.Context
+	bus events.Bus
+	config config.MessageConfig
 	log *log.Logger
 }
 
-func NewMessageServiceAPI(api storage.StorageAPI) MessageServiceAPI {
+func NewMessageServiceAPI(api storage.StorageAPI, bus events.Bus, messageConfig config.MessageConfig) MessageServiceAPI {
 	return &messageService{
 		storage: api,
-		ctx: context.Background(),
+		bus: bus,
+		config: messageConfig,
 		log: log.New(os.Stdout, "MESSAGE-SERVICE: ", log.LstdFlags),
 	}
 }
 
-func (m *messageService) SendMessage(sendMessageRequest dto.SendMessageRequest) (uuid.UUID, error, bool) {
+func (m *messageService) SendMessage(ctx context.Context, sendMessageRequest dto.SendMessageRequest) (uuid.UUID, error) {
 	m.log.Printf("Trying to send message: %s", sendMessageRequest)
-	// constraint по user_id и chat_id гарантируют, что сущности существуют
-	ok, err := m.storage.GetMessageStorage().CheckExistUserChats(sendMessageRequest.Author, sendMessageRequest.Chat)
+	author, err := checkActingUser(ctx, "author", sendMessageRequest.Author)
 	if err != nil {
-		m.log.Printf("Error while check exist user in chat, reason: %+v", err)
-		return uuid.Nil, xerrors.Errorf("System error. Contact support"), true
+		return uuid.Nil, err
 	}
-	if !ok {
-		return uuid.Nil, xerrors.Errorf("User doesn't consist in chat"), false
+
+	// constraint по user_id и chat_id гарантируют, что сущности существуют
+	if _, err := checkPermission(ctx, m.storage, m.log, author, sendMessageRequest.Chat, permissionPost); err != nil {
+		return uuid.Nil, err
 	}
 	m.log.Printf("Author of message exist in chat")
 
 	if len(strings.TrimSpace(sendMessageRequest.Text)) == 0 {
-		return uuid.Nil, xerrors.Errorf("Empty message"), false
+		return uuid.Nil, validationError("text", FieldRequired, "Empty message")
 	}
 
-	tx, err := m.storage.GetTransaction(m.ctx)
-	if err != nil {
-		m.log.Printf("Error while create transaction, reason: %+v", err)
-		return uuid.Nil, xerrors.Errorf("System error. Contact support"), true
+	if sendMessageRequest.Parent != uuid.Nil {
+		parent, err := m.getMessage(ctx, sendMessageRequest.Parent)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		// сообщение из другого чата - такой же 404, как и несуществующее, чтобы по id нельзя было узнать,
+		// есть ли сообщение. Треды одного уровня: отвечать можно только на сообщение пользователя из ленты чата
+		if parent.Chat != sendMessageRequest.Chat {
+			return uuid.Nil, notFoundError(CodeMessageNotFound, "Parent message doesn't exist")
+		}
+		if parent.Parent != nil || parent.Type != dto.MessageText {
+			return uuid.Nil, validationError("parent", FieldInvalidValue, "Cannot reply to this message")
+		}
+		if parent.DeletedAt != 0 {
+			return uuid.Nil, conflictError(CodeMessageDeleted, "Parent message is deleted")
+		}
 	}
 
-	messageID, err := m.storage.GetMessageStorage().CreateMessage(tx, sendMessageRequest.Author, sendMessageRequest.Chat, sendMessageRequest.Text)
+	var message dto.Message
+	err = m.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		var err error
+		message, err = m.storage.GetMessageStorage().CreateMessage(ctx, tx, author, sendMessageRequest.Chat, sendMessageRequest.Parent, sendMessageRequest.Text)
+		if err != nil {
+			return err
+		}
+
+		return publishEvent(ctx, m.bus, tx, events.MessageCreated, message.Chat, nil, message)
+	})
 	if err != nil {
 		m.log.Printf("Error while create message, reason: %+v", err)
-		tx.Rollback(m.ctx)
-		return uuid.Nil, xerrors.Errorf("System error. Contact support"), true
+		return uuid.Nil, internalError(err)
 	}
 
-	err = tx.Commit(m.ctx)
+	return message.ID, nil
+}
+
+func (m *messageService) GetMessageList(ctx context.Context, getMessageList dto.MessageListRequest) (dto.MessageListResponse, error) {
+	m.log.Printf("Trying to get messages in chat: %s", getMessageList)
+	params, err := makePageParams(getMessageList.Limit, getMessageList.Direction, getMessageList.Cursor)
 	if err != nil {
-		m.log.Printf("Error while commit transaction, reason: %+v", err)
-		return uuid.Nil, xerrors.Errorf("System error. Contact support"), true
+		return dto.MessageListResponse{}, err
 	}
 
-	return messageID, nil, false
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return dto.MessageListResponse{}, err
+	}
+	if _, err := chatMemberRole(ctx, m.storage, m.log, userID, getMessageList.Chat); err != nil {
+		return dto.MessageListResponse{}, err
+	}
+	m.log.Printf("User is member of chat")
+
+	listParams := storage.MessageListParams{Page: params, RootsOnly: getMessageList.RootsOnly}
+	page, err := m.storage.GetMessageStorage().GetMessageList(ctx, getMessageList.Chat, userID, listParams)
+	if err != nil {
+		m.log.Printf("Error while get message list, reason: %+v", err)
+		return dto.MessageListResponse{}, internalError(err)
+	}
+
+	response := dto.MessageListResponse{MessageList: page.Messages}
+	response.NextCursor, response.PrevCursor = pageCursors(page.First, page.Last, len(page.Messages), page.HasMore, params)
+
+	return response, nil
 }
 
-func (m *messageService) GetMessageList(getMessageList dto.MessageListRequest) ([]dto.Message, error, bool) {
-	m.log.Printf("Trying to get messages in chat: %s", getMessageList)
-	ok, err := m.storage.GetChatStorage().CheckExistChat(getMessageList.Chat)
+func (m *messageService) GetThread(ctx context.Context, threadRequest dto.ThreadRequest) (dto.ThreadResponse, error) {
+	m.log.Printf("Trying to get thread: %s", threadRequest)
+	params, err := makePageParams(threadRequest.Limit, threadRequest.Direction, threadRequest.Cursor)
 	if err != nil {
-		m.log.Printf("Error while check exist chat, reason: %+v", err)
-		return nil, xerrors.Errorf("System error. Contact support"), true
+		return dto.ThreadResponse{}, err
 	}
-	if !ok {
-		return nil, xerrors.Errorf("Chat doesn't exist"), false
+
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return dto.ThreadResponse{}, err
 	}
-	m.log.Printf("Chat is exist")
 
-	messages, err := m.storage.GetMessageStorage().GetMessageList(getMessageList.Chat)
+	root, _, err := m.getMemberMessage(ctx, userID, threadRequest.Message)
 	if err != nil {
-		m.log.Printf("Error while get message list, reason: %+v", err)
-		return nil, xerrors.Errorf("System error. Contact support"), true
+		return dto.ThreadResponse{}, err
+	}
+	if root.Parent != nil {
+		return dto.ThreadResponse{}, validationError("message", FieldInvalidValue, "Message is a reply, not a thread root")
+	}
+
+	listParams := storage.MessageListParams{Page: params, Parent: root.ID}
+	page, err := m.storage.GetMessageStorage().GetMessageList(ctx, root.Chat, userID, listParams)
+	if err != nil {
+		m.log.Printf("Error while get thread replies, reason: %+v", err)
+		return dto.ThreadResponse{}, internalError(err)
+	}
+
+	if root.DeletedAt == 0 {
+		reactions, err := m.storage.GetMessageStorage().GetReactions(ctx, []uuid.UUID{root.ID}, userID)
+		if err != nil {
+			m.log.Printf("Error while get reactions, reason: %+v", err)
+			return dto.ThreadResponse{}, internalError(err)
+		}
+		root.Reactions = reactions[root.ID]
+	}
+
+	response := dto.ThreadResponse{Root: root, Replies: page.Messages}
+	response.NextCursor, response.PrevCursor = pageCursors(page.First, page.Last, len(page.Messages), page.HasMore, params)
+
+	return response, nil
+}
+
+func (m *messageService) EditMessage(ctx context.Context, editMessageRequest dto.EditMessageRequest) (dto.Message, error) {
+	m.log.Printf("Trying to edit message: %s", editMessageRequest)
+	actor, err := currentUser(ctx)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	if len(strings.TrimSpace(editMessageRequest.Text)) == 0 {
+		return dto.Message{}, validationError("text", FieldRequired, "Empty message")
+	}
+
+	message, role, err := m.getMemberMessage(ctx, actor, editMessageRequest.Message)
+	if err != nil {
+		return dto.Message{}, err
+	}
+	// участник, которого перевели в readonly, больше не может править свои сообщения
+	if err := requirePermission(role, permissionPost); err != nil {
+		return dto.Message{}, err
+	}
+	if message.Type != dto.MessageText || message.Author != actor {
+		return dto.Message{}, forbiddenError(CodeNotMessageAuthor, "Only author can edit message")
+	}
+	if message.DeletedAt != 0 {
+		return dto.Message{}, conflictError(CodeMessageDeleted, "Message is deleted")
+	}
+	if m.config.EditWindow > 0 && time.Since(fromEpoch(message.CreatedAt)) > m.config.EditWindow {
+		return dto.Message{}, forbiddenError(CodeEditWindowExpired, "Message is too old to edit")
+	}
+
+	var edited dto.Message
+	err = m.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		var err error
+		edited, err = m.storage.GetMessageStorage().EditMessage(ctx, tx, message.ID, editMessageRequest.Text)
+		if err != nil || edited.ID == uuid.Nil || edited.Text == message.Text {
+			return err
+		}
+
+		return publishEvent(ctx, m.bus, tx, events.MessageEdited, edited.Chat, nil, edited)
+	})
+	if err != nil {
+		m.log.Printf("Error while edit message, reason: %+v", err)
+		return dto.Message{}, internalError(err)
+	}
+	if edited.ID == uuid.Nil {
+		return dto.Message{}, notFoundError(CodeMessageNotFound, "Message doesn't exist")
 	}
 
-	return messages, nil, false
+	return edited, nil
+}
+
+func (m *messageService) GetMessageRevisions(ctx context.Context, messageRequest dto.MessageRequest) (dto.MessageRevisionsResponse, error) {
+	m.log.Printf("Trying to get revisions of message: %s", messageRequest)
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return dto.MessageRevisionsResponse{}, err
+	}
+
+	message, _, err := m.getMemberMessage(ctx, userID, messageRequest.Message)
+	if err != nil {
+		return dto.MessageRevisionsResponse{}, err
+	}
+	// история правок удаленного сообщения не раскрывается
+	if message.DeletedAt != 0 {
+		return dto.MessageRevisionsResponse{Revisions: []dto.MessageRevision{}}, nil
+	}
+
+	revisions, err := m.storage.GetMessageStorage().GetMessageRevisions(ctx, message.ID)
+	if err != nil {
+		m.log.Printf("Error while get message revisions, reason: %+v", err)
+		return dto.MessageRevisionsResponse{}, internalError(err)
+	}
+
+	return dto.MessageRevisionsResponse{Revisions: revisions}, nil
+}
+
+func (m *messageService) GetReadReceipts(ctx context.Context, messageRequest dto.MessageRequest) (dto.ReadReceiptsResponse, error) {
+	m.log.Printf("Trying to get read receipts of message: %s", messageRequest)
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return dto.ReadReceiptsResponse{}, err
+	}
+
+	message, _, err := m.getMemberMessage(ctx, userID, messageRequest.Message)
+	if err != nil {
+		return dto.ReadReceiptsResponse{}, err
+	}
+
+	members, err := m.storage.GetChatStorage().GetChatUsers(ctx, message.Chat)
+	if err != nil {
+		m.log.Printf("Error while get chat members from DB, reason: %+v", err)
+		return dto.ReadReceiptsResponse{}, internalError(err)
+	}
+	if len(members) > maxReadReceiptsChatSize {
+		return dto.ReadReceiptsResponse{}, conflictError(CodeChatTooLarge,
+			fmt.Sprintf("Read receipts are available in chats up to %d members", maxReadReceiptsChatSize))
+	}
+
+	readers, err := m.storage.GetChatStorage().GetMessageReaders(ctx, message.ID)
+	if err != nil {
+		m.log.Printf("Error while get message readers from DB, reason: %+v", err)
+		return dto.ReadReceiptsResponse{}, internalError(err)
+	}
+
+	return dto.ReadReceiptsResponse{Users: readers}, nil
+}
+
+func (m *messageService) DeleteMessage(ctx context.Context, deleteMessageRequest dto.DeleteMessageRequest) error {
+	m.log.Printf("Trying to delete message: %s", deleteMessageRequest)
+	actor, err := currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	message, role, err := m.getMemberMessage(ctx, actor, deleteMessageRequest.Message)
+	if err != nil {
+		return err
+	}
+
+	if !deleteMessageRequest.ForEveryone {
+		err = m.storage.RunInTx(ctx, func(tx storage.Tx) error {
+			if err := m.storage.GetMessageStorage().HideMessage(ctx, tx, actor, message.ID); err != nil {
+				return err
+			}
+
+			// скрытие касается только других вкладок и устройств самого пользователя
+			return publishEvent(ctx, m.bus, tx, events.MessageHidden, message.Chat, []uuid.UUID{actor}, dto.MessageRequest{Message: message.ID})
+		})
+		if err != nil {
+			m.log.Printf("Error while hide message, reason: %+v", err)
+			return internalError(err)
+		}
+
+		return nil
+	}
+
+	// автор удаляет свои сообщения, модераторы - любые
+	if message.Type != dto.MessageText || message.Author != actor {
+		if err := requirePermission(role, permissionDeleteMessages); err != nil {
+			return err
+		}
+	}
+	if message.DeletedAt != 0 {
+		return nil
+	}
+
+	var deleted dto.Message
+	err = m.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		var err error
+		deleted, err = m.storage.GetMessageStorage().DeleteMessage(ctx, tx, message.ID, actor)
+		if err != nil || deleted.ID == uuid.Nil {
+			return err
+		}
+
+		return publishEvent(ctx, m.bus, tx, events.MessageDeleted, deleted.Chat, nil, deleted)
+	})
+	if err != nil {
+		m.log.Printf("Error while delete message, reason: %+v", err)
+		return internalError(err)
+	}
+	if deleted.ID == uuid.Nil {
+		return notFoundError(CodeMessageNotFound, "Message doesn't exist")
+	}
+
+	return nil
+}
+
+func (m *messageService) AddReaction(ctx context.Context, reactionRequest dto.ReactionRequest) error {
+	m.log.Printf("Trying to add reaction: %s", reactionRequest)
+	message, actor, err := m.checkReaction(ctx, reactionRequest)
+	if err != nil {
+		return err
+	}
+	if message.DeletedAt != 0 {
+		return conflictError(CodeMessageDeleted, "Message is deleted")
+	}
+
+	err = m.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		added, err := m.storage.GetMessageStorage().AddReaction(ctx, tx, message.ID, actor, reactionRequest.Emoji)
+		if err != nil || !added {
+			return err
+		}
+
+		return m.publishReaction(ctx, tx, events.ReactionAdded, message, actor, reactionRequest.Emoji)
+	})
+	if err != nil {
+		m.log.Printf("Error while add reaction, reason: %+v", err)
+		return internalError(err)
+	}
+
+	return nil
+}
+
+func (m *messageService) RemoveReaction(ctx context.Context, reactionRequest dto.ReactionRequest) error {
+	m.log.Printf("Trying to remove reaction: %s", reactionRequest)
+	message, actor, err := m.checkReaction(ctx, reactionRequest)
+	if err != nil {
+		return err
+	}
+
+	err = m.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		removed, err := m.storage.GetMessageStorage().RemoveReaction(ctx, tx, message.ID, actor, reactionRequest.Emoji)
+		if err != nil || !removed {
+			return err
+		}
+
+		return m.publishReaction(ctx, tx, events.ReactionRemoved, message, actor, reactionRequest.Emoji)
+	})
+	if err != nil {
+		m.log.Printf("Error while remove reaction, reason: %+v", err)
+		return internalError(err)
+	}
+
+	return nil
+}
+
+// checkReaction проверяет emoji и то, что текущий пользователь - участник чата сообщения
+func (m *messageService) checkReaction(ctx context.Context, reactionRequest dto.ReactionRequest) (dto.Message, uuid.UUID, error) {
+	actor, err := currentUser(ctx)
+	if err != nil {
+		return dto.Message{}, uuid.Nil, err
+	}
+	if err := checkEmoji(reactionRequest.Emoji); err != nil {
+		return dto.Message{}, uuid.Nil, err
+	}
+
+	message, _, err := m.getMemberMessage(ctx, actor, reactionRequest.Message)
+	if err != nil {
+		return dto.Message{}, uuid.Nil, err
+	}
+
+	return message, actor, nil
+}
+
+func (m *messageService) publishReaction(ctx context.Context, tx storage.Tx, eventType string, message dto.Message, actor uuid.UUID, emoji string) error {
+	return publishEvent(ctx, m.bus, tx, eventType, message.Chat, nil, dto.ReactionEvent{Message: message.ID, User: actor, Emoji: emoji})
+}
+
+// checkEmoji допускает короткую строку без пробелов и управляющих символов:
+// один emoji может состоять из нескольких кодовых точек (модификаторы, ZWJ-последовательности)
+func checkEmoji(emoji string) error {
+	if len(emoji) == 0 {
+		return validationError("emoji", FieldRequired, "Empty emoji")
+	}
+	if utf8.RuneCountInString(emoji) > maxEmojiRunes || !utf8.ValidString(emoji) {
+		return validationError("emoji", FieldInvalidValue, "Invalid emoji")
+	}
+	for _, r := range emoji {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return validationError("emoji", FieldInvalidValue, "Invalid emoji")
+		}
+	}
+
+	return nil
+}
+
+func (m *messageService) PinMessage(ctx context.Context, messageRequest dto.MessageRequest) error {
+	m.log.Printf("Trying to pin message: %s", messageRequest)
+	message, actor, err := m.checkPin(ctx, messageRequest)
+	if err != nil {
+		return err
+	}
+	if message.Type != dto.MessageText {
+		return validationError("message", FieldInvalidValue, "System message cannot be pinned")
+	}
+	if message.DeletedAt != 0 {
+		return conflictError(CodeMessageDeleted, "Message is deleted")
+	}
+
+	err = m.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		pinned, err := m.storage.GetMessageStorage().PinMessage(ctx, tx, message.Chat, message.ID, actor)
+		if err != nil || !pinned {
+			return err
+		}
+
+		return publishEvent(ctx, m.bus, tx, events.MessagePinned, message.Chat, nil, dto.PinEvent{Message: message.ID, User: actor})
+	})
+	if err != nil {
+		m.log.Printf("Error while pin message, reason: %+v", err)
+		return internalError(err)
+	}
+
+	return nil
+}
+
+func (m *messageService) UnpinMessage(ctx context.Context, messageRequest dto.MessageRequest) error {
+	m.log.Printf("Trying to unpin message: %s", messageRequest)
+	message, actor, err := m.checkPin(ctx, messageRequest)
+	if err != nil {
+		return err
+	}
+
+	err = m.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		unpinned, err := m.storage.GetMessageStorage().UnpinMessage(ctx, tx, message.ID)
+		if err != nil || !unpinned {
+			return err
+		}
+
+		return publishEvent(ctx, m.bus, tx, events.MessageUnpinned, message.Chat, nil, dto.PinEvent{Message: message.ID, User: actor})
+	})
+	if err != nil {
+		m.log.Printf("Error while unpin message, reason: %+v", err)
+		return internalError(err)
+	}
+
+	return nil
+}
+
+// checkPin проверяет, что текущий пользователь может закреплять сообщения в чате сообщения
+func (m *messageService) checkPin(ctx context.Context, messageRequest dto.MessageRequest) (dto.Message, uuid.UUID, error) {
+	actor, err := currentUser(ctx)
+	if err != nil {
+		return dto.Message{}, uuid.Nil, err
+	}
+
+	message, role, err := m.getMemberMessage(ctx, actor, messageRequest.Message)
+	if err != nil {
+		return dto.Message{}, uuid.Nil, err
+	}
+	if err := requirePermission(role, permissionPin); err != nil {
+		return dto.Message{}, uuid.Nil, err
+	}
+
+	return message, actor, nil
+}
+
+func (m *messageService) GetPinnedMessages(ctx context.Context, chatRequest dto.ChatRequest) (dto.PinnedMessagesResponse, error) {
+	m.log.Printf("Trying to get pinned messages of chat: %s", chatRequest)
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return dto.PinnedMessagesResponse{}, err
+	}
+	if _, err := chatMemberRole(ctx, m.storage, m.log, userID, chatRequest.Chat); err != nil {
+		return dto.PinnedMessagesResponse{}, err
+	}
+
+	pins, err := m.storage.GetMessageStorage().GetPinnedMessages(ctx, chatRequest.Chat, userID)
+	if err != nil {
+		m.log.Printf("Error while get pinned messages from DB, reason: %+v", err)
+		return dto.PinnedMessagesResponse{}, internalError(err)
+	}
+
+	return dto.PinnedMessagesResponse{Pins: pins}, nil
+}
+
+func (m *messageService) PurgeDeletedMessages(ctx context.Context) (int, error) {
+	if m.config.DeletedRetention <= 0 {
+		return 0, nil
+	}
+
+	var purged int
+	err := m.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		var err error
+		purged, err = m.storage.GetMessageStorage().PurgeDeletedMessages(ctx, tx, time.Now().Add(-m.config.DeletedRetention))
+		return err
+	})
+	if err != nil {
+		m.log.Printf("Error while purge deleted messages, reason: %+v", err)
+		return 0, internalError(err)
+	}
+	if purged > 0 {
+		m.log.Printf("Purged %d deleted messages", purged)
+	}
+
+	return purged, nil
+}
+
+// getMessage возвращает 404, если сообщения нет
+func (m *messageService) getMessage(ctx context.Context, messageID uuid.UUID) (dto.Message, error) {
+	message, err := m.storage.GetMessageStorage().GetMessage(ctx, messageID)
+	if err != nil {
+		m.log.Printf("Error while get message from DB, reason: %+v", err)
+		return dto.Message{}, internalError(err)
+	}
+	if message.ID == uuid.Nil {
+		return dto.Message{}, notFoundError(CodeMessageNotFound, "Message doesn't exist")
+	}
+
+	return message, nil
+}
+
+// getMemberMessage возвращает сообщение и роль user в его чате. Сообщение из чужого чата - такой же 404,
+// как и несуществующее, чтобы по id нельзя было узнать, есть ли сообщение
+func (m *messageService) getMemberMessage(ctx context.Context, user uuid.UUID, messageID uuid.UUID) (dto.Message, string, error) {
+	message, err := m.getMessage(ctx, messageID)
+	if err != nil {
+		return dto.Message{}, "", err
+	}
+
+	role, err := m.storage.GetChatStorage().GetChatUserRole(ctx, message.Chat, user)
+	if err != nil {
+		m.log.Printf("Error while get role of user in chat, reason: %+v", err)
+		return dto.Message{}, "", internalError(err)
+	}
+	if len(role) == 0 {
+		return dto.Message{}, "", notFoundError(CodeMessageNotFound, "Message doesn't exist")
+	}
+
+	return message, role, nil
+}
+
+func fromEpoch(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
 }
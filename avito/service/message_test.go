@@ -0,0 +1,455 @@
+package service
+
+import (
+	"avito/config"
+	"avito/db"
+	"avito/dto"
+	"avito/events"
+	"avito/migrations"
+	"avito/storage"
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"path/filepath"
+	"testing"
+)
+
+func newTestServiceAPI(t *testing.T) (ServiceAPI, events.Hub) {
+	t.Helper()
+	return newTestServiceAPIWith(storage.NewMemoryStorageAPI())
+}
+
+func newTestServiceAPIWith(api storage.StorageAPI) (ServiceAPI, events.Hub) {
+	hub := events.NewHub(16)
+	bus := events.NewLocalBus(hub, api.GetChatStorage().GetChatUsers)
+	return NewServiceAPI(api, bus, config.AuthConfig{}, config.MessageConfig{}), hub
+}
+
+// forEachServiceAPI выполняет тест над сервисами с хранилищем в памяти и с SQLite
+func forEachServiceAPI(t *testing.T, test func(t *testing.T, serviceAPI ServiceAPI)) {
+	t.Run("memory", func(t *testing.T) {
+		serviceAPI, _ := newTestServiceAPI(t)
+		test(t, serviceAPI)
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		sqliteDB := db.NewConnectToSQLite(filepath.Join(t.TempDir(), "test.db"))
+		defer sqliteDB.Close()
+		migrator, err := migrations.NewSQLiteMigrator(sqliteDB)
+		if err != nil {
+			t.Fatalf("NewSQLiteMigrator: %+v", err)
+		}
+		if err := migrator.Up(context.Background()); err != nil {
+			t.Fatalf("Cannot apply migrations: %+v", err)
+		}
+
+		serviceAPI, _ := newTestServiceAPIWith(storage.NewSQLiteStorageAPI(sqliteDB))
+		test(t, serviceAPI)
+	})
+}
+
+func newTestUser(t *testing.T, serviceAPI ServiceAPI, username string) context.Context {
+	t.Helper()
+	user, err := serviceAPI.GetUserService().CreateUser(context.Background(), dto.CreateUserRequest{Username: username})
+	if err != nil {
+		t.Fatalf("CreateUser %s: %+v", username, err)
+	}
+	return WithIdentity(context.Background(), Identity{UserID: user.ID})
+}
+
+func TestSendMessageFlow(t *testing.T) {
+	serviceAPI, hub := newTestServiceAPI(t)
+	alice := newTestUser(t, serviceAPI, "alice")
+	bob := newTestUser(t, serviceAPI, "bob")
+	carol := newTestUser(t, serviceAPI, "carol")
+	bobID, _ := UserFromContext(bob)
+	carolID, _ := UserFromContext(carol)
+
+	chat, err := serviceAPI.GetChatService().CreateChat(alice, dto.CreateChatRequest{Name: "general", Users: []uuid.UUID{bobID}})
+	if err != nil {
+		t.Fatalf("CreateChat: %+v", err)
+	}
+
+	bobEvents := hub.Subscribe(bobID)
+	defer hub.Unsubscribe(bobEvents)
+	carolEvents := hub.Subscribe(carolID)
+	defer hub.Unsubscribe(carolEvents)
+
+	messageID, err := serviceAPI.GetMessageService().SendMessage(alice, dto.SendMessageRequest{Chat: chat, Text: "hello"})
+	if err != nil {
+		t.Fatalf("SendMessage: %+v", err)
+	}
+
+	// событие публикуется после коммита и только участникам чата
+	select {
+	case frame := <-bobEvents.Messages():
+		var event struct {
+			Type    string
+			Payload dto.Message
+		}
+		if err := json.Unmarshal(frame, &event); err != nil {
+			t.Fatalf("Cannot unmarshal event: %v", err)
+		}
+		if event.Type != events.MessageCreated || event.Payload.ID != messageID {
+			t.Errorf("Unexpected event %s for message %s", frame, event.Payload.ID)
+		}
+	default:
+		t.Errorf("Member didn't receive message.created")
+	}
+	select {
+	case frame := <-carolEvents.Messages():
+		t.Errorf("Not a member received event %s", frame)
+	default:
+	}
+
+	list, err := serviceAPI.GetMessageService().GetMessageList(bob, dto.MessageListRequest{Chat: chat})
+	if err != nil {
+		t.Fatalf("GetMessageList: %+v", err)
+	}
+	if len(list.MessageList) != 1 || list.MessageList[0].ID != messageID || list.MessageList[0].Text != "hello" {
+		t.Errorf("Unexpected message list %s", list)
+	}
+
+	_, err = serviceAPI.GetMessageService().GetMessageList(carol, dto.MessageListRequest{Chat: chat})
+	if !isErrorKind(err, KindForbidden) {
+		t.Errorf("Not a member got message list, error %v", err)
+	}
+}
+
+func isErrorKind(err error, kind ErrorKind) bool {
+	serviceErr, ok := err.(*Error)
+	return ok && serviceErr.Kind == kind
+}
+
+func TestPinMessages(t *testing.T) {
+	forEachServiceAPI(t, func(t *testing.T, serviceAPI ServiceAPI) {
+		alice := newTestUser(t, serviceAPI, "alice")
+		bob := newTestUser(t, serviceAPI, "bob")
+		carol := newTestUser(t, serviceAPI, "carol")
+		dave := newTestUser(t, serviceAPI, "dave")
+		bobID, _ := UserFromContext(bob)
+		carolID, _ := UserFromContext(carol)
+
+		chat, err := serviceAPI.GetChatService().CreateChat(alice, dto.CreateChatRequest{Name: "general", Users: []uuid.UUID{bobID, carolID}})
+		if err != nil {
+			t.Fatalf("CreateChat: %+v", err)
+		}
+		if err := serviceAPI.GetChatService().SetMemberRole(alice, dto.SetMemberRoleRequest{Chat: chat, User: bobID, Role: dto.RoleAdmin}); err != nil {
+			t.Fatalf("SetMemberRole: %+v", err)
+		}
+		messageService := serviceAPI.GetMessageService()
+		first, err := messageService.SendMessage(carol, dto.SendMessageRequest{Chat: chat, Text: "first"})
+		if err != nil {
+			t.Fatalf("SendMessage: %+v", err)
+		}
+		second, err := messageService.SendMessage(carol, dto.SendMessageRequest{Chat: chat, Text: "second"})
+		if err != nil {
+			t.Fatalf("SendMessage: %+v", err)
+		}
+
+		if err := messageService.PinMessage(carol, dto.MessageRequest{Message: first}); !isErrorCode(err, CodeInsufficientRole) {
+			t.Errorf("Member pin returned %v", err)
+		}
+		if err := messageService.PinMessage(dave, dto.MessageRequest{Message: first}); !isErrorCode(err, CodeMessageNotFound) {
+			t.Errorf("Not a member pin returned %v", err)
+		}
+		if err := messageService.PinMessage(bob, dto.MessageRequest{Message: first}); err != nil {
+			t.Fatalf("Admin PinMessage: %+v", err)
+		}
+		if err := messageService.PinMessage(alice, dto.MessageRequest{Message: second}); err != nil {
+			t.Fatalf("Owner PinMessage: %+v", err)
+		}
+		// повторное закрепление ничего не меняет
+		if err := messageService.PinMessage(alice, dto.MessageRequest{Message: first}); err != nil {
+			t.Fatalf("Repeated PinMessage: %+v", err)
+		}
+
+		pinned, err := messageService.GetPinnedMessages(carol, dto.ChatRequest{Chat: chat})
+		if err != nil {
+			t.Fatalf("GetPinnedMessages: %+v", err)
+		}
+		if len(pinned.Pins) != 2 || pinned.Pins[0].Message.ID != second || pinned.Pins[1].Message.ID != first || pinned.Pins[1].PinnedBy != bobID {
+			t.Errorf("Unexpected pins %v", pinned.Pins)
+		}
+		if _, err := messageService.GetPinnedMessages(dave, dto.ChatRequest{Chat: chat}); !isErrorCode(err, CodeNotChatMember) {
+			t.Errorf("Not a member GetPinnedMessages returned %v", err)
+		}
+
+		if err := messageService.UnpinMessage(carol, dto.MessageRequest{Message: second}); !isErrorCode(err, CodeInsufficientRole) {
+			t.Errorf("Member unpin returned %v", err)
+		}
+		if err := messageService.UnpinMessage(bob, dto.MessageRequest{Message: second}); err != nil {
+			t.Fatalf("UnpinMessage: %+v", err)
+		}
+		pinned, err = messageService.GetPinnedMessages(carol, dto.ChatRequest{Chat: chat})
+		if err != nil {
+			t.Fatalf("GetPinnedMessages: %+v", err)
+		}
+		if len(pinned.Pins) != 1 || pinned.Pins[0].Message.ID != first {
+			t.Errorf("Unexpected pins after unpin %v", pinned.Pins)
+		}
+	})
+}
+
+func TestEditMessageAccess(t *testing.T) {
+	serviceAPI, _ := newTestServiceAPI(t)
+	alice := newTestUser(t, serviceAPI, "alice")
+	bob := newTestUser(t, serviceAPI, "bob")
+	carol := newTestUser(t, serviceAPI, "carol")
+	bobID, _ := UserFromContext(bob)
+
+	chat, err := serviceAPI.GetChatService().CreateChat(alice, dto.CreateChatRequest{Name: "general", Users: []uuid.UUID{bobID}})
+	if err != nil {
+		t.Fatalf("CreateChat: %+v", err)
+	}
+	messageService := serviceAPI.GetMessageService()
+	messageID, err := messageService.SendMessage(bob, dto.SendMessageRequest{Chat: chat, Text: "helo"})
+	if err != nil {
+		t.Fatalf("SendMessage: %+v", err)
+	}
+
+	// сообщение из чужого чата неотличимо от несуществующего
+	if _, err := messageService.EditMessage(carol, dto.EditMessageRequest{Message: messageID, Text: "x"}); !isErrorCode(err, CodeMessageNotFound) {
+		t.Errorf("Not a member edit returned %v", err)
+	}
+	if _, err := messageService.GetMessageRevisions(carol, dto.MessageRequest{Message: messageID}); !isErrorCode(err, CodeMessageNotFound) {
+		t.Errorf("Not a member GetMessageRevisions returned %v", err)
+	}
+	if _, err := messageService.EditMessage(alice, dto.EditMessageRequest{Message: messageID, Text: "x"}); !isErrorCode(err, CodeNotMessageAuthor) {
+		t.Errorf("Not an author edit returned %v", err)
+	}
+
+	edited, err := messageService.EditMessage(bob, dto.EditMessageRequest{Message: messageID, Text: "hello"})
+	if err != nil {
+		t.Fatalf("EditMessage: %+v", err)
+	}
+	if edited.Text != "hello" || edited.EditedAt == 0 {
+		t.Errorf("Unexpected edited message %s", edited)
+	}
+	revisions, err := messageService.GetMessageRevisions(alice, dto.MessageRequest{Message: messageID})
+	if err != nil {
+		t.Fatalf("GetMessageRevisions: %+v", err)
+	}
+	if len(revisions.Revisions) != 1 || revisions.Revisions[0].Text != "helo" {
+		t.Errorf("Unexpected revisions %v", revisions.Revisions)
+	}
+
+	if err := serviceAPI.GetChatService().SetMemberRole(alice, dto.SetMemberRoleRequest{Chat: chat, User: bobID, Role: dto.RoleReadOnly}); err != nil {
+		t.Fatalf("SetMemberRole: %+v", err)
+	}
+	if _, err := messageService.EditMessage(bob, dto.EditMessageRequest{Message: messageID, Text: "hello!"}); !isErrorCode(err, CodeInsufficientRole) {
+		t.Errorf("Readonly edit returned %v", err)
+	}
+}
+
+func TestSendReply(t *testing.T) {
+	serviceAPI, _ := newTestServiceAPI(t)
+	alice := newTestUser(t, serviceAPI, "alice")
+	bob := newTestUser(t, serviceAPI, "bob")
+	bobID, _ := UserFromContext(bob)
+
+	chatService, messageService := serviceAPI.GetChatService(), serviceAPI.GetMessageService()
+	chat, err := chatService.CreateChat(alice, dto.CreateChatRequest{Name: "general", Users: []uuid.UUID{bobID}})
+	if err != nil {
+		t.Fatalf("CreateChat: %+v", err)
+	}
+	other, err := chatService.CreateChat(bob, dto.CreateChatRequest{Name: "other", Users: []uuid.UUID{bobID, newTestUserID(t, serviceAPI, "carol")}})
+	if err != nil {
+		t.Fatalf("CreateChat: %+v", err)
+	}
+	root, err := messageService.SendMessage(alice, dto.SendMessageRequest{Chat: chat, Text: "root"})
+	if err != nil {
+		t.Fatalf("SendMessage: %+v", err)
+	}
+	foreign, err := messageService.SendMessage(bob, dto.SendMessageRequest{Chat: other, Text: "foreign"})
+	if err != nil {
+		t.Fatalf("SendMessage: %+v", err)
+	}
+
+	reply, err := messageService.SendMessage(bob, dto.SendMessageRequest{Chat: chat, Parent: root, Text: "reply"})
+	if err != nil {
+		t.Fatalf("SendMessage reply: %+v", err)
+	}
+	if _, err := messageService.SendMessage(alice, dto.SendMessageRequest{Chat: chat, Parent: reply, Text: "x"}); !isErrorKind(err, KindValidation) {
+		t.Errorf("Reply to reply returned %v", err)
+	}
+	// parent из другого чата неотличим от несуществующего
+	for _, parent := range []uuid.UUID{foreign, uuid.Must(uuid.NewUUID())} {
+		if _, err := messageService.SendMessage(bob, dto.SendMessageRequest{Chat: chat, Parent: parent, Text: "x"}); !isErrorCode(err, CodeMessageNotFound) {
+			t.Errorf("Reply to parent %s returned %v", parent, err)
+		}
+	}
+
+	thread, err := messageService.GetThread(alice, dto.ThreadRequest{Message: root})
+	if err != nil {
+		t.Fatalf("GetThread: %+v", err)
+	}
+	if thread.Root.ReplyCount != 1 || len(thread.Replies) != 1 || thread.Replies[0].ID != reply {
+		t.Errorf("Unexpected thread %v", thread)
+	}
+}
+
+func newTestUserID(t *testing.T, serviceAPI ServiceAPI, username string) uuid.UUID {
+	t.Helper()
+	userID, _ := UserFromContext(newTestUser(t, serviceAPI, username))
+	return userID
+}
+
+func TestReactions(t *testing.T) {
+	serviceAPI, _ := newTestServiceAPI(t)
+	alice := newTestUser(t, serviceAPI, "alice")
+	bob := newTestUser(t, serviceAPI, "bob")
+	carol := newTestUser(t, serviceAPI, "carol")
+	bobID, _ := UserFromContext(bob)
+
+	chat, err := serviceAPI.GetChatService().CreateChat(alice, dto.CreateChatRequest{Name: "general", Users: []uuid.UUID{bobID}})
+	if err != nil {
+		t.Fatalf("CreateChat: %+v", err)
+	}
+	messageService := serviceAPI.GetMessageService()
+	messageID, err := messageService.SendMessage(alice, dto.SendMessageRequest{Chat: chat, Text: "hello"})
+	if err != nil {
+		t.Fatalf("SendMessage: %+v", err)
+	}
+
+	for _, reaction := range []struct {
+		user  context.Context
+		emoji string
+	}{{alice, "👍"}, {alice, "👍"}, {bob, "❤️"}, {bob, "👍"}} {
+		if err := messageService.AddReaction(reaction.user, dto.ReactionRequest{Message: messageID, Emoji: reaction.emoji}); err != nil {
+			t.Fatalf("AddReaction %s: %+v", reaction.emoji, err)
+		}
+	}
+	if err := messageService.AddReaction(bob, dto.ReactionRequest{Message: messageID, Emoji: "a b"}); !isErrorKind(err, KindValidation) {
+		t.Errorf("Invalid emoji returned %v", err)
+	}
+	// сообщение из чужого чата неотличимо от несуществующего
+	if err := messageService.AddReaction(carol, dto.ReactionRequest{Message: messageID, Emoji: "👍"}); !isErrorCode(err, CodeMessageNotFound) {
+		t.Errorf("Not a member AddReaction returned %v", err)
+	}
+	if err := messageService.RemoveReaction(carol, dto.ReactionRequest{Message: messageID, Emoji: "👍"}); !isErrorCode(err, CodeMessageNotFound) {
+		t.Errorf("Not a member RemoveReaction returned %v", err)
+	}
+	if err := messageService.RemoveReaction(bob, dto.ReactionRequest{Message: messageID, Emoji: "❤️"}); err != nil {
+		t.Fatalf("RemoveReaction: %+v", err)
+	}
+
+	list, err := messageService.GetMessageList(bob, dto.MessageListRequest{Chat: chat})
+	if err != nil {
+		t.Fatalf("GetMessageList: %+v", err)
+	}
+	if len(list.MessageList) != 1 {
+		t.Fatalf("Unexpected messages %v", list.MessageList)
+	}
+	reactions := list.MessageList[0].Reactions
+	if len(reactions) != 1 || reactions[0].Emoji != "👍" || reactions[0].Count != 2 || !reactions[0].Me {
+		t.Errorf("Unexpected reactions %v", reactions)
+	}
+}
+
+func TestReadReceipts(t *testing.T) {
+	serviceAPI, _ := newTestServiceAPI(t)
+	alice := newTestUser(t, serviceAPI, "alice")
+	bob := newTestUser(t, serviceAPI, "bob")
+	carol := newTestUser(t, serviceAPI, "carol")
+	bobID, _ := UserFromContext(bob)
+
+	chatService, messageService := serviceAPI.GetChatService(), serviceAPI.GetMessageService()
+	chat, err := chatService.CreateChat(alice, dto.CreateChatRequest{Name: "general", Users: []uuid.UUID{bobID}})
+	if err != nil {
+		t.Fatalf("CreateChat: %+v", err)
+	}
+	messageID, err := messageService.SendMessage(alice, dto.SendMessageRequest{Chat: chat, Text: "hello"})
+	if err != nil {
+		t.Fatalf("SendMessage: %+v", err)
+	}
+
+	receipts, err := messageService.GetReadReceipts(alice, dto.MessageRequest{Message: messageID})
+	if err != nil {
+		t.Fatalf("GetReadReceipts: %+v", err)
+	}
+	// автор не попадает в список прочитавших
+	if len(receipts.Users) != 0 {
+		t.Errorf("Unexpected readers before read %v", receipts.Users)
+	}
+	if err := chatService.MarkChatRead(bob, dto.MarkChatReadRequest{Chat: chat, Message: messageID}); err != nil {
+		t.Fatalf("MarkChatRead: %+v", err)
+	}
+	receipts, err = messageService.GetReadReceipts(alice, dto.MessageRequest{Message: messageID})
+	if err != nil {
+		t.Fatalf("GetReadReceipts: %+v", err)
+	}
+	if len(receipts.Users) != 1 || receipts.Users[0].User != bobID {
+		t.Errorf("Unexpected readers %v", receipts.Users)
+	}
+
+	// сообщение из чужого чата неотличимо от несуществующего
+	if _, err := messageService.GetReadReceipts(carol, dto.MessageRequest{Message: messageID}); !isErrorCode(err, CodeMessageNotFound) {
+		t.Errorf("Not a member GetReadReceipts returned %v", err)
+	}
+}
+
+func TestDeleteMessage(t *testing.T) {
+	forEachServiceAPI(t, func(t *testing.T, serviceAPI ServiceAPI) {
+		alice := newTestUser(t, serviceAPI, "alice")
+		bob := newTestUser(t, serviceAPI, "bob")
+		carol := newTestUser(t, serviceAPI, "carol")
+		aliceID, _ := UserFromContext(alice)
+		bobID, _ := UserFromContext(bob)
+
+		chat, err := serviceAPI.GetChatService().CreateChat(alice, dto.CreateChatRequest{Name: "general", Users: []uuid.UUID{bobID}})
+		if err != nil {
+			t.Fatalf("CreateChat: %+v", err)
+		}
+		messageService := serviceAPI.GetMessageService()
+		hidden, err := messageService.SendMessage(alice, dto.SendMessageRequest{Chat: chat, Text: "hidden by bob"})
+		if err != nil {
+			t.Fatalf("SendMessage: %+v", err)
+		}
+		deleted, err := messageService.SendMessage(alice, dto.SendMessageRequest{Chat: chat, Text: "deleted by alice"})
+		if err != nil {
+			t.Fatalf("SendMessage: %+v", err)
+		}
+
+		if err := messageService.DeleteMessage(bob, dto.DeleteMessageRequest{Message: hidden}); err != nil {
+			t.Fatalf("Hide message: %+v", err)
+		}
+		if err := messageService.DeleteMessage(bob, dto.DeleteMessageRequest{Message: deleted, ForEveryone: true}); !isErrorCode(err, CodeInsufficientRole) {
+			t.Errorf("Member deleting message of other user returned %v", err)
+		}
+		if err := messageService.DeleteMessage(carol, dto.DeleteMessageRequest{Message: deleted, ForEveryone: true}); !isErrorCode(err, CodeMessageNotFound) {
+			t.Errorf("Not a member delete returned %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := messageService.DeleteMessage(alice, dto.DeleteMessageRequest{Message: deleted, ForEveryone: true}); err != nil {
+				t.Fatalf("DeleteMessage: %+v", err)
+			}
+		}
+
+		// скрытое сообщение пропадает только у bob, удаленное остается на месте с пустым текстом
+		list, err := messageService.GetMessageList(bob, dto.MessageListRequest{Chat: chat})
+		if err != nil {
+			t.Fatalf("GetMessageList: %+v", err)
+		}
+		if len(list.MessageList) != 1 {
+			t.Fatalf("Unexpected messages of bob %v", list.MessageList)
+		}
+		tombstone := list.MessageList[0]
+		if tombstone.ID != deleted || tombstone.Text != "" || tombstone.DeletedAt == 0 || tombstone.DeletedBy == nil || *tombstone.DeletedBy != aliceID {
+			t.Errorf("Unexpected tombstone %s", tombstone)
+		}
+		list, err = messageService.GetMessageList(alice, dto.MessageListRequest{Chat: chat})
+		if err != nil {
+			t.Fatalf("GetMessageList: %+v", err)
+		}
+		if len(list.MessageList) != 2 || list.MessageList[0].ID != hidden {
+			t.Errorf("Unexpected messages of alice %v", list.MessageList)
+		}
+
+		if _, err := messageService.EditMessage(alice, dto.EditMessageRequest{Message: deleted, Text: "x"}); !isErrorCode(err, CodeMessageDeleted) {
+			t.Errorf("Edit of deleted message returned %v", err)
+		}
+		if err := messageService.AddReaction(bob, dto.ReactionRequest{Message: deleted, Emoji: "👍"}); !isErrorCode(err, CodeMessageDeleted) {
+			t.Errorf("Reaction to deleted message returned %v", err)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"avito/dto"
+	"avito/storage"
+	"fmt"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+func makePageParams(limit int, direction string, cursor string) (storage.PageParams, error) {
+	if limit < 0 || limit > maxPageLimit {
+		return storage.PageParams{}, validationError("limit", FieldOutOfRange, fmt.Sprintf("Limit must be between 1 and %d", maxPageLimit))
+	}
+	if limit == 0 {
+		limit = defaultPageLimit
+	}
+
+	params := storage.PageParams{Limit: limit}
+	switch direction {
+	case dto.DirectionOlder:
+		params.Older = true
+	case dto.DirectionNewer, "":
+	default:
+		return storage.PageParams{}, validationError("direction", FieldInvalidFormat, fmt.Sprintf("Direction must be '%s' or '%s'", dto.DirectionOlder, dto.DirectionNewer))
+	}
+
+	if len(cursor) != 0 {
+		c, err := storage.DecodeCursor(cursor)
+		if err != nil {
+			return storage.PageParams{}, validationError("cursor", FieldInvalidFormat, "Invalid cursor")
+		}
+		params.Cursor = &c
+	}
+
+	return params, nil
+}
+
+// pageCursors возвращает курсоры для перехода к более поздним (next) и более ранним (prev) записям.
+// В направлении выборки курсор есть, только если записи еще остались, в обратном - если запрос был от курсора
+func pageCursors(first, last storage.Cursor, count int, hasMore bool, params storage.PageParams) (string, string) {
+	if count == 0 {
+		return "", ""
+	}
+
+	var next, prev string
+	if hasMore {
+		if params.Older {
+			prev = first.Encode()
+		} else {
+			next = last.Encode()
+		}
+	}
+	if params.Cursor != nil {
+		if params.Older {
+			next = last.Encode()
+		} else {
+			prev = first.Encode()
+		}
+	}
+
+	return next, prev
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"avito/dto"
+	"avito/storage"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+)
+
+type permission int
+
+const (
+	permissionPost permission = iota
+	permissionRename
+	permissionManageMembers
+	permissionPin
+	permissionDeleteMessages
+)
+
+var permissionNames = map[permission]string{
+	permissionPost:           "send messages",
+	permissionRename:         "rename chat",
+	permissionManageMembers:  "manage members",
+	permissionPin:            "pin messages",
+	permissionDeleteMessages: "delete messages of other users",
+}
+
+// rolePermissions - права ролей чата. Владелец и администраторы управляют чатом,
+// участники только пишут, readonly-участники (например, в каналах объявлений) только читают
+var rolePermissions = map[string]map[permission]bool{
+	dto.RoleOwner: {
+		permissionPost: true, permissionRename: true, permissionManageMembers: true,
+		permissionPin: true, permissionDeleteMessages: true,
+	},
+	dto.RoleAdmin: {
+		permissionPost: true, permissionRename: true, permissionManageMembers: true,
+		permissionPin: true, permissionDeleteMessages: true,
+	},
+	dto.RoleMember:   {permissionPost: true},
+	dto.RoleReadOnly: {},
+}
+
+// roleRanks задает старшинство ролей: участником можно управлять, только если роль выше его роли
+var roleRanks = map[string]int{
+	dto.RoleReadOnly: 0,
+	dto.RoleMember:   1,
+	dto.RoleAdmin:    2,
+	dto.RoleOwner:    3,
+}
+
+func isValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+func outranks(role string, other string) bool {
+	return roleRanks[role] > roleRanks[other]
+}
+
+// chatMemberRole возвращает роль пользователя в чате. Несуществующий чат - 404,
+// чат без пользователя - 403, чтобы участник мог отличить удаленный чат от закрытого
+func chatMemberRole(ctx context.Context, api storage.StorageAPI, log *log.Logger, user uuid.UUID, chat uuid.UUID) (string, error) {
+	role, err := api.GetChatStorage().GetChatUserRole(ctx, chat, user)
+	if err != nil {
+		log.Printf("Error while get role of user in chat, reason: %+v", err)
+		return "", internalError(err)
+	}
+	if len(role) != 0 {
+		return role, nil
+	}
+
+	ok, err := api.GetChatStorage().CheckExistChat(ctx, chat)
+	if err != nil {
+		log.Printf("Error while check exist chat, reason: %+v", err)
+		return "", internalError(err)
+	}
+	if !ok {
+		return "", notFoundError(CodeChatNotFound, "Chat doesn't exist")
+	}
+
+	return "", forbiddenError(CodeNotChatMember, "User doesn't consist in chat")
+}
+
+// checkPermission проверяет, что роль пользователя в чате дает право p, и возвращает эту роль
+func checkPermission(ctx context.Context, api storage.StorageAPI, log *log.Logger, user uuid.UUID, chat uuid.UUID, p permission) (string, error) {
+	role, err := chatMemberRole(ctx, api, log, user, chat)
+	if err != nil {
+		return "", err
+	}
+	if err := requirePermission(role, p); err != nil {
+		return "", err
+	}
+
+	return role, nil
+}
+
+// requirePermission возвращает 403, если роль не дает право p
+func requirePermission(role string, p permission) error {
+	if !rolePermissions[role][p] {
+		return forbiddenError(CodeInsufficientRole, fmt.Sprintf("Role %s is not allowed to %s", role, permissionNames[p]))
+	}
+	return nil
+}
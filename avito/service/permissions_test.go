@@ -0,0 +1,95 @@
+package service
+
+import (
+	"avito/dto"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"testing"
+)
+
+func TestRolePermissions(t *testing.T) {
+	allowed := map[string][]permission{
+		dto.RoleOwner:    {permissionPost, permissionRename, permissionManageMembers, permissionPin, permissionDeleteMessages},
+		dto.RoleAdmin:    {permissionPost, permissionRename, permissionManageMembers, permissionPin, permissionDeleteMessages},
+		dto.RoleMember:   {permissionPost},
+		dto.RoleReadOnly: {},
+		// роль, которой нет, не дает никаких прав
+		"guest": {},
+	}
+
+	for role, permissions := range allowed {
+		expected := make(map[permission]bool)
+		for _, p := range permissions {
+			expected[p] = true
+		}
+		for p := range permissionNames {
+			err := requirePermission(role, p)
+			if expected[p] && err != nil {
+				t.Errorf("Role %s is not allowed to %s: %v", role, permissionNames[p], err)
+			}
+			if !expected[p] && !isErrorCode(err, CodeInsufficientRole) {
+				t.Errorf("Role %s to %s returned %v", role, permissionNames[p], err)
+			}
+		}
+	}
+
+	for _, ranks := range [][2]string{
+		{dto.RoleOwner, dto.RoleAdmin}, {dto.RoleAdmin, dto.RoleMember}, {dto.RoleMember, dto.RoleReadOnly},
+	} {
+		if !outranks(ranks[0], ranks[1]) || outranks(ranks[1], ranks[0]) || outranks(ranks[0], ranks[0]) {
+			t.Errorf("Unexpected ranks of %s and %s", ranks[0], ranks[1])
+		}
+	}
+}
+
+func TestPermissionMatrix(t *testing.T) {
+	forEachServiceAPI(t, func(t *testing.T, serviceAPI ServiceAPI) {
+		chatService, messageService := serviceAPI.GetChatService(), serviceAPI.GetMessageService()
+		owner := newTestUser(t, serviceAPI, "owner")
+		users := map[string]context.Context{dto.RoleOwner: owner}
+		userIDs := make([]uuid.UUID, 0)
+		for _, username := range []string{dto.RoleAdmin, dto.RoleMember, dto.RoleReadOnly, "author"} {
+			users[username] = newTestUser(t, serviceAPI, username)
+			userID, _ := UserFromContext(users[username])
+			userIDs = append(userIDs, userID)
+		}
+		chat, err := chatService.CreateChat(owner, dto.CreateChatRequest{Name: "general", Users: userIDs})
+		if err != nil {
+			t.Fatalf("CreateChat: %+v", err)
+		}
+		for _, role := range []string{dto.RoleAdmin, dto.RoleReadOnly} {
+			userID, _ := UserFromContext(users[role])
+			err := chatService.SetMemberRole(owner, dto.SetMemberRoleRequest{Chat: chat, User: userID, Role: role})
+			if err != nil {
+				t.Fatalf("SetMemberRole %s: %+v", role, err)
+			}
+		}
+
+		for _, role := range []string{dto.RoleOwner, dto.RoleAdmin, dto.RoleMember, dto.RoleReadOnly} {
+			actor := users[role]
+			// сообщение другого участника для закрепления и удаления
+			message, err := messageService.SendMessage(users["author"], dto.SendMessageRequest{Chat: chat, Text: "message for " + role})
+			if err != nil {
+				t.Fatalf("SendMessage: %+v", err)
+			}
+			newcomer := newTestUserID(t, serviceAPI, "newcomer_"+role)
+
+			actions := map[permission]error{}
+			_, actions[permissionPost] = messageService.SendMessage(actor, dto.SendMessageRequest{Chat: chat, Text: "hello"})
+			actions[permissionRename] = chatService.RenameChat(actor, dto.RenameChatRequest{Chat: chat, Name: fmt.Sprintf("renamed by %s", role)})
+			_, actions[permissionManageMembers] = chatService.AddChatMembers(actor, dto.ChatMembersRequest{Chat: chat, Users: []uuid.UUID{newcomer}})
+			actions[permissionPin] = messageService.PinMessage(actor, dto.MessageRequest{Message: message})
+			actions[permissionDeleteMessages] = messageService.DeleteMessage(actor, dto.DeleteMessageRequest{Message: message, ForEveryone: true})
+
+			for p, err := range actions {
+				if rolePermissions[role][p] && err != nil {
+					t.Errorf("Role %s cannot %s: %v", role, permissionNames[p], err)
+				}
+				if !rolePermissions[role][p] && !isErrorCode(err, CodeInsufficientRole) {
+					t.Errorf("Role %s to %s returned %v", role, permissionNames[p], err)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"avito/config"
+	"context"
+	"time"
+)
+
+// RunMessagePurge периодически стирает текст удаленных сообщений, блокируется до отмены ctx
+func RunMessagePurge(ctx context.Context, messages MessageServiceAPI, messageConfig config.MessageConfig) {
+	if messageConfig.DeletedRetention <= 0 || messageConfig.PurgeInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(messageConfig.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// ошибка уже записана в лог сервисом, следующая попытка будет через интервал
+			messages.PurgeDeletedMessages(ctx)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"avito/dto"
+	"avito/storage"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ограничения поискового запроса: длина в символах и количество слов и фраз
+const (
+	maxSearchQueryLength = 256
+	maxSearchTerms       = 16
+)
+
+func (m *messageService) SearchMessages(ctx context.Context, searchRequest dto.SearchMessagesRequest) (dto.SearchMessagesResponse, error) {
+	m.log.Printf("Trying to search messages: %s", searchRequest)
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return dto.SearchMessagesResponse{}, err
+	}
+
+	params, err := makeSearchParams(searchRequest)
+	if err != nil {
+		return dto.SearchMessagesResponse{}, err
+	}
+	if params.Chat != uuid.Nil {
+		if _, err := chatMemberRole(ctx, m.storage, m.log, userID, params.Chat); err != nil {
+			return dto.SearchMessagesResponse{}, err
+		}
+	}
+
+	page, err := m.storage.GetMessageStorage().SearchMessages(ctx, userID, params)
+	if err != nil {
+		m.log.Printf("Error while search messages in DB, reason: %+v", err)
+		return dto.SearchMessagesResponse{}, internalError(err)
+	}
+
+	response := dto.SearchMessagesResponse{Results: page.Results}
+	if page.HasMore {
+		response.NextCursor = page.Last.Encode()
+	}
+
+	return response, nil
+}
+
+func makeSearchParams(searchRequest dto.SearchMessagesRequest) (storage.SearchParams, error) {
+	query := strings.TrimSpace(searchRequest.Query)
+	if len(query) == 0 {
+		return storage.SearchParams{}, validationError("query", FieldRequired, "Search query is empty")
+	}
+	if utf8.RuneCountInString(query) > maxSearchQueryLength {
+		return storage.SearchParams{}, validationError("query", FieldOutOfRange, fmt.Sprintf("Search query must be at most %d characters", maxSearchQueryLength))
+	}
+	terms := parseSearchQuery(query)
+	if len(terms) == 0 {
+		return storage.SearchParams{}, validationError("query", FieldInvalidValue, "Search query has no words")
+	}
+	if len(terms) > maxSearchTerms {
+		return storage.SearchParams{}, validationError("query", FieldOutOfRange, fmt.Sprintf("Search query must have at most %d words and phrases", maxSearchTerms))
+	}
+
+	params := storage.SearchParams{Terms: terms, Chat: searchRequest.Chat, Author: searchRequest.Author, Limit: searchRequest.Limit}
+	switch searchRequest.Order {
+	case dto.SearchOrderRelevance, "":
+		params.ByRelevance = true
+	case dto.SearchOrderTime:
+	default:
+		return storage.SearchParams{}, validationError("order", FieldInvalidFormat, fmt.Sprintf("Order must be '%s' or '%s'", dto.SearchOrderRelevance, dto.SearchOrderTime))
+	}
+	if params.Limit < 0 || params.Limit > maxPageLimit {
+		return storage.SearchParams{}, validationError("limit", FieldOutOfRange, fmt.Sprintf("Limit must be between 1 and %d", maxPageLimit))
+	}
+	if params.Limit == 0 {
+		params.Limit = defaultPageLimit
+	}
+
+	if searchRequest.From < 0 || searchRequest.To < 0 {
+		return storage.SearchParams{}, validationError("from", FieldOutOfRange, "Time must be positive")
+	}
+	if searchRequest.From != 0 {
+		params.From = fromEpoch(searchRequest.From)
+	}
+	if searchRequest.To != 0 {
+		params.To = fromEpoch(searchRequest.To)
+		if !params.From.Before(params.To) {
+			return storage.SearchParams{}, validationError("to", FieldOutOfRange, "To must be later than from")
+		}
+	}
+
+	if len(searchRequest.Cursor) != 0 {
+		cursor, err := storage.DecodeSearchCursor(searchRequest.Cursor)
+		if err != nil {
+			return storage.SearchParams{}, validationError("cursor", FieldInvalidFormat, "Invalid cursor")
+		}
+		params.Cursor = &cursor
+	}
+
+	return params, nil
+}
+
+// parseSearchQuery разбирает запрос на термы: слова через пробел, фразы в двойных кавычках,
+// звездочка после слова или фразы ищет последнее слово как начало слова.
+// Все символы, кроме букв и цифр, разделяют слова, незакрытая кавычка продолжается до конца запроса
+func parseSearchQuery(query string) []storage.SearchTerm {
+	terms := make([]storage.SearchTerm, 0)
+	var words []string
+	var word strings.Builder
+	inPhrase := false
+
+	endWord := func() {
+		if word.Len() > 0 {
+			words = append(words, strings.ToLower(word.String()))
+			word.Reset()
+		}
+	}
+	endTerm := func(prefix bool) {
+		endWord()
+		if len(words) > 0 {
+			terms = append(terms, storage.SearchTerm{Words: words, Prefix: prefix})
+		}
+		words = nil
+	}
+
+	runes := []rune(query)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		case r == '"':
+			// звездочка сразу после закрывающей кавычки относится к фразе
+			prefix := inPhrase && i+1 < len(runes) && runes[i+1] == '*'
+			if prefix {
+				i++
+			}
+			endTerm(prefix)
+			inPhrase = !inPhrase
+		case r == '*' && !inPhrase && word.Len() > 0:
+			endTerm(true)
+		case inPhrase:
+			endWord()
+		default:
+			endTerm(false)
+		}
+	}
+	endTerm(false)
+
+	return terms
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"unicode/utf8"
+)
+
+const tokenBytes = 32
+
+type contextKey int
+
+const identityContextKey contextKey = iota
+
+// Identity - аутентифицированный пользователь запроса
+type Identity struct {
+	UserID uuid.UUID
+	// SessionID - сессия, в которой выдан токен запроса, uuid.Nil для API-токенов
+	SessionID uuid.UUID
+}
+
+// WithIdentity возвращает контекст запроса, выполняемого от имени аутентифицированного пользователя
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey, identity)
+}
+
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityContextKey).(Identity)
+	return identity, ok && identity.UserID != uuid.Nil
+}
+
+// UserFromContext возвращает пользователя, от имени которого выполняется запрос
+func UserFromContext(ctx context.Context) (uuid.UUID, bool) {
+	identity, ok := IdentityFromContext(ctx)
+	return identity.UserID, ok
+}
+
+func currentUser(ctx context.Context) (uuid.UUID, error) {
+	userID, ok := UserFromContext(ctx)
+	if !ok {
+		return uuid.Nil, unauthorizedError(CodeUnauthorized, "Authentication required")
+	}
+	return userID, nil
+}
+
+// checkActingUser проверяет поле пользователя из тела запроса. Поле оставлено для совместимости
+// со старыми клиентами: если оно заполнено, оно должно совпадать с аутентифицированным пользователем
+func checkActingUser(ctx context.Context, field string, requested uuid.UUID) (uuid.UUID, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if requested != uuid.Nil && requested != userID {
+		return uuid.Nil, forbiddenError(CodeUserMismatch, "Field "+field+" must be the authenticated user")
+	}
+	return userID, nil
+}
+
+// newToken создает случайный токен. Токен отдается клиенту, в базе хранится только его хэш
+func newToken() (string, string, error) {
+	raw := make([]byte, tokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, hashToken(token), nil
+}
+
+// hashToken - токен содержит достаточно случайных байт, поэтому медленный хэш с солью не нужен
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+const (
+	minPasswordLength = 8
+	// bcrypt учитывает только первые 72 байта пароля
+	maxPasswordBytes = 72
+)
+
+// dummyPasswordHash сравнивается с паролем, когда пользователя нет или у него нет пароля,
+// чтобы время ответа не выдавало существование пользователя
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+func validatePassword(password string) error {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return validationError("password", FieldTooShort, fmt.Sprintf("Password must contain at least %d characters", minPasswordLength))
+	}
+	if len(password) > maxPasswordBytes {
+		return validationError("password", FieldOutOfRange, fmt.Sprintf("Password must not be longer than %d bytes", maxPasswordBytes))
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// checkPassword возвращает false и для пустого passwordHash, т.е. для пользователя без пароля
+func checkPassword(passwordHash string, password string) bool {
+	if len(passwordHash) == 0 {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) == nil
+}
@@ -1,76 +1,302 @@
 package service
 
 import (
-	"../dto"
-	"../storage"
+	"avito/dto"
+	"avito/storage"
 	"context"
+	"encoding/base64"
+	"fmt"
 	"github.com/google/uuid"
 	"golang.org/x/xerrors"
 	"log"
+	"net/url"
 	"os"
 	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-// третий параметр в функциях - isInternal, для определения типа ошибки в handlers
+// ограничения профиля и количества пользователей в одном запросе ResolveUsers
+const (
+	maxDisplayNameLength = 64
+	maxAvatarURLLength   = 2048
+	maxResolveUsers      = 200
+)
+
+// ошибки бизнес-логики возвращаются как *Error, handlers по ним выбирают HTTP-статус
 type UserServiceAPI interface {
-	CreateUser(createUserRequest dto.CreateUserRequest) (uuid.UUID, error, bool)
+	CreateUser(ctx context.Context, createUserRequest dto.CreateUserRequest) (dto.CreateUserResponse, error)
+	// GetUser ищет пользователя по id или по имени
+	GetUser(ctx context.Context, userRequest dto.UserRequest) (dto.User, error)
+	// ResolveUsers возвращает пользователей в порядке id из запроса, несуществующие id пропускаются
+	ResolveUsers(ctx context.Context, resolveUsersRequest dto.ResolveUsersRequest) (dto.UsersResponse, error)
+	// SearchUsers ищет пользователей по началу имени без учета регистра, в алфавитном порядке
+	SearchUsers(ctx context.Context, searchUsersRequest dto.SearchUsersRequest) (dto.UsersResponse, error)
+	// UpdateProfile меняет отображаемое имя и аватар текущего пользователя
+	UpdateProfile(ctx context.Context, updateProfileRequest dto.UpdateProfileRequest) (dto.User, error)
 }
 
 type userService struct {
 	storage storage.StorageAPI
-	ctx context.Context
 	log *log.Logger
 }
 
 func NewUserServiceAPI(api storage.StorageAPI) UserServiceAPI {
 	return &userService{
 		storage: api,
-		ctx: context.Background(),
 		log: log.New(os.Stdout, "USER-SERVICE: ", log.LstdFlags),
 	}
 }
 
-func (u *userService) CreateUser(createUserRequest dto.CreateUserRequest) (uuid.UUID, error, bool) {
+func (u *userService) CreateUser(ctx context.Context, createUserRequest dto.CreateUserRequest) (dto.CreateUserResponse, error) {
 	u.log.Printf("Trying to create user with username: %s", createUserRequest.Username)
 	if len(createUserRequest.Username) < 3 {
-		return uuid.Nil, xerrors.Errorf("Username must contain at least 3 characters"), false
+		return dto.CreateUserResponse{}, validationError("username", FieldTooShort, "Username must contain at least 3 characters")
 	}
 
 	var validLogin = regexp.MustCompile("^([a-zA-Z0-9_]+)$")
 	f := validLogin.FindStringSubmatch(createUserRequest.Username)
 	if f == nil {
-		return uuid.Nil, xerrors.Errorf("Username must contain only numbers, latin letters and '_'"), false
+		return dto.CreateUserResponse{}, validationError("username", FieldInvalidFormat, "Username must contain only numbers, latin letters and '_'")
 	}
 	u.log.Printf("Username is valid")
 
-	ok, err := u.storage.GetUserStorage().IsUserExist(createUserRequest.Username)
+	var passwordHash string
+	if len(createUserRequest.Password) != 0 {
+		if err := validatePassword(createUserRequest.Password); err != nil {
+			return dto.CreateUserResponse{}, err
+		}
+
+		var err error
+		passwordHash, err = hashPassword(createUserRequest.Password)
+		if err != nil {
+			u.log.Printf("Error while hash password, reason: %+v", err)
+			return dto.CreateUserResponse{}, internalError(err)
+		}
+	}
+
+	ok, err := u.storage.GetUserStorage().IsUserExist(ctx, createUserRequest.Username)
 	if err != nil {
 		u.log.Printf("Error while check user on exist in DB, reason: %+v", err)
-		return uuid.Nil, xerrors.Errorf("System error. Contact support"), true
+		return dto.CreateUserResponse{}, internalError(err)
 	}
 	if ok {
-		return uuid.Nil, xerrors.Errorf("User already exist"), false
+		return dto.CreateUserResponse{}, conflictError(CodeUserAlreadyExists, "User already exist")
 	}
 
-	tx, err := u.storage.GetTransaction(u.ctx)
+	token, tokenHash, err := newToken()
 	if err != nil {
-		u.log.Printf("Error while create transaction, reason: %+v", err)
-		return uuid.Nil, xerrors.Errorf("System error. Contact support"), true
+		u.log.Printf("Error while generate token, reason: %+v", err)
+		return dto.CreateUserResponse{}, internalError(err)
 	}
 
-	id, err := u.storage.GetUserStorage().CreateUser(tx, createUserRequest.Username)
+	var id uuid.UUID
+	err = u.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		var err error
+		id, err = u.storage.GetUserStorage().CreateUser(ctx, tx, createUserRequest.Username, passwordHash)
+		if err != nil {
+			return xerrors.Errorf("Cannot create user: %w", err)
+		}
+
+		err = u.storage.GetTokenStorage().CreateToken(ctx, tx, storage.Token{UserID: id, Hash: tokenHash})
+		if err != nil {
+			return xerrors.Errorf("Cannot create token: %w", err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		tx.Rollback(u.ctx)
 		u.log.Printf("Error while create user in DB, reason: %+v", err)
-		return uuid.Nil, xerrors.Errorf("System error. Contact support"), true
+		// имя могли занять параллельным запросом между проверкой и вставкой
+		if xerrors.Is(err, storage.ErrUsernameTaken) {
+			return dto.CreateUserResponse{}, conflictError(CodeUserAlreadyExists, "User already exist")
+		}
+		return dto.CreateUserResponse{}, internalError(err)
+	}
+
+	return dto.CreateUserResponse{ID: id, Token: token}, nil
+}
+
+func (u *userService) GetUser(ctx context.Context, userRequest dto.UserRequest) (dto.User, error) {
+	u.log.Printf("Trying to get user: %s", userRequest)
+	if _, err := currentUser(ctx); err != nil {
+		return dto.User{}, err
+	}
+
+	if userRequest.ID == uuid.Nil && len(userRequest.Username) == 0 {
+		return dto.User{}, validationError("id", FieldRequired, "User id or username is required")
+	}
+	if userRequest.ID != uuid.Nil && len(userRequest.Username) != 0 {
+		return dto.User{}, validationError("username", FieldInvalidValue, "Specify either id or username")
+	}
+
+	var user dto.User
+	if userRequest.ID != uuid.Nil {
+		users, err := u.storage.GetUserStorage().GetUsers(ctx, []uuid.UUID{userRequest.ID})
+		if err != nil {
+			u.log.Printf("Error while get user from DB, reason: %+v", err)
+			return dto.User{}, internalError(err)
+		}
+		if len(users) != 0 {
+			user = users[0]
+		}
+	} else {
+		var err error
+		user, err = u.storage.GetUserStorage().GetUserByUsername(ctx, userRequest.Username)
+		if err != nil {
+			u.log.Printf("Error while get user by username from DB, reason: %+v", err)
+			return dto.User{}, internalError(err)
+		}
+	}
+	if user.ID == uuid.Nil {
+		return dto.User{}, notFoundError(CodeUserNotFound, "User doesn't exist")
+	}
+
+	return user, nil
+}
+
+func (u *userService) ResolveUsers(ctx context.Context, resolveUsersRequest dto.ResolveUsersRequest) (dto.UsersResponse, error) {
+	u.log.Printf("Trying to resolve users: %s", resolveUsersRequest)
+	if _, err := currentUser(ctx); err != nil {
+		return dto.UsersResponse{}, err
+	}
+
+	ids := uniqueUUIDs(resolveUsersRequest.IDs)
+	if len(ids) == 0 {
+		return dto.UsersResponse{}, validationError("ids", FieldRequired, "User ids are required")
+	}
+	if len(ids) > maxResolveUsers {
+		return dto.UsersResponse{}, validationError("ids", FieldOutOfRange, fmt.Sprintf("At most %d users can be resolved at once", maxResolveUsers))
+	}
+
+	found, err := u.storage.GetUserStorage().GetUsers(ctx, ids)
+	if err != nil {
+		u.log.Printf("Error while get users from DB, reason: %+v", err)
+		return dto.UsersResponse{}, internalError(err)
+	}
+
+	byID := make(map[uuid.UUID]dto.User, len(found))
+	for _, user := range found {
+		byID[user.ID] = user
+	}
+	users := make([]dto.User, 0, len(found))
+	for _, id := range ids {
+		if user, ok := byID[id]; ok {
+			users = append(users, user)
+		}
+	}
+
+	return dto.UsersResponse{Users: users}, nil
+}
+
+func (u *userService) SearchUsers(ctx context.Context, searchUsersRequest dto.SearchUsersRequest) (dto.UsersResponse, error) {
+	u.log.Printf("Trying to search users: %s", searchUsersRequest)
+	if _, err := currentUser(ctx); err != nil {
+		return dto.UsersResponse{}, err
+	}
+
+	params := storage.UserSearchParams{Prefix: strings.TrimSpace(searchUsersRequest.Prefix), Limit: searchUsersRequest.Limit}
+	if len(params.Prefix) == 0 {
+		return dto.UsersResponse{}, validationError("prefix", FieldRequired, "Username prefix is empty")
+	}
+	if params.Limit < 0 || params.Limit > maxPageLimit {
+		return dto.UsersResponse{}, validationError("limit", FieldOutOfRange, fmt.Sprintf("Limit must be between 1 and %d", maxPageLimit))
+	}
+	if params.Limit == 0 {
+		params.Limit = defaultPageLimit
+	}
+	// курсор - имя последнего пользователя предыдущей страницы
+	if len(searchUsersRequest.Cursor) != 0 {
+		after, err := base64.RawURLEncoding.DecodeString(searchUsersRequest.Cursor)
+		if err != nil || len(after) == 0 {
+			return dto.UsersResponse{}, validationError("cursor", FieldInvalidFormat, "Invalid cursor")
+		}
+		params.After = string(after)
+	}
+
+	page, err := u.storage.GetUserStorage().SearchUsers(ctx, params)
+	if err != nil {
+		u.log.Printf("Error while search users in DB, reason: %+v", err)
+		return dto.UsersResponse{}, internalError(err)
+	}
+
+	response := dto.UsersResponse{Users: page.Users}
+	if page.HasMore {
+		last := page.Users[len(page.Users)-1]
+		response.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(last.Username))
+	}
+
+	return response, nil
+}
+
+func (u *userService) UpdateProfile(ctx context.Context, updateProfileRequest dto.UpdateProfileRequest) (dto.User, error) {
+	u.log.Printf("Trying to update profile: %s", updateProfileRequest)
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return dto.User{}, err
+	}
+
+	displayName, avatarURL := updateProfileRequest.DisplayName, updateProfileRequest.AvatarURL
+	if displayName != nil {
+		trimmed := strings.TrimSpace(*displayName)
+		if err := validateDisplayName(trimmed); err != nil {
+			return dto.User{}, err
+		}
+		displayName = &trimmed
+	}
+	if avatarURL != nil {
+		trimmed := strings.TrimSpace(*avatarURL)
+		if err := validateAvatarURL(trimmed); err != nil {
+			return dto.User{}, err
+		}
+		avatarURL = &trimmed
 	}
 
-	err = tx.Commit(u.ctx)
+	var user dto.User
+	err = u.storage.RunInTx(ctx, func(tx storage.Tx) error {
+		var err error
+		user, err = u.storage.GetUserStorage().UpdateProfile(ctx, tx, userID, displayName, avatarURL)
+		return err
+	})
 	if err != nil {
-		u.log.Printf("Error while commit transaction, reason: %+v", err)
-		return uuid.Nil, xerrors.Errorf("System error. Contact support"), true
+		u.log.Printf("Error while update profile in DB, reason: %+v", err)
+		return dto.User{}, internalError(err)
+	}
+	if user.ID == uuid.Nil {
+		return dto.User{}, notFoundError(CodeUserNotFound, "User doesn't exist")
+	}
+
+	return user, nil
+}
+
+// validateDisplayName допускает пустое имя (поле очищается) и только печатные символы
+func validateDisplayName(name string) error {
+	if utf8.RuneCountInString(name) > maxDisplayNameLength {
+		return validationError("display_name", FieldOutOfRange, fmt.Sprintf("Display name must be at most %d characters", maxDisplayNameLength))
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return validationError("display_name", FieldInvalidFormat, "Display name must contain only printable characters")
+		}
 	}
 
-	return id, nil, false
+	return nil
 }
 
+// validateAvatarURL допускает пустую ссылку (поле очищается) и абсолютные http(s) ссылки
+func validateAvatarURL(avatarURL string) error {
+	if len(avatarURL) == 0 {
+		return nil
+	}
+	if len(avatarURL) > maxAvatarURLLength {
+		return validationError("avatar_url", FieldOutOfRange, fmt.Sprintf("Avatar URL must be at most %d bytes", maxAvatarURLLength))
+	}
+
+	parsed, err := url.Parse(avatarURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+		return validationError("avatar_url", FieldInvalidFormat, "Avatar URL must be an absolute http or https URL")
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"avito/dto"
+	"github.com/google/uuid"
+	"testing"
+)
+
+func TestUserDirectory(t *testing.T) {
+	forEachServiceAPI(t, func(t *testing.T, serviceAPI ServiceAPI) {
+		userService := serviceAPI.GetUserService()
+		alice := newTestUser(t, serviceAPI, "alice")
+		aliceID, _ := UserFromContext(alice)
+		ids := []uuid.UUID{aliceID}
+		for _, username := range []string{"Alina", "alex", "bob", "al_5"} {
+			ids = append(ids, newTestUserID(t, serviceAPI, username))
+		}
+
+		byName, err := userService.GetUser(alice, dto.UserRequest{Username: "bob"})
+		if err != nil {
+			t.Fatalf("GetUser: %+v", err)
+		}
+		byID, err := userService.GetUser(alice, dto.UserRequest{ID: ids[3]})
+		if err != nil {
+			t.Fatalf("GetUser: %+v", err)
+		}
+		if byName.ID != ids[3] || byID.Username != "bob" {
+			t.Errorf("Unexpected users %s and %s", byName, byID)
+		}
+		if _, err := userService.GetUser(alice, dto.UserRequest{Username: "nobody"}); !isErrorCode(err, CodeUserNotFound) {
+			t.Errorf("Unknown user returned %v", err)
+		}
+
+		// порядок ответа - порядок id в запросе, несуществующие пропускаются
+		resolved, err := userService.ResolveUsers(alice, dto.ResolveUsersRequest{IDs: []uuid.UUID{ids[3], uuid.Must(uuid.NewUUID()), ids[0]}})
+		if err != nil {
+			t.Fatalf("ResolveUsers: %+v", err)
+		}
+		if len(resolved.Users) != 2 || resolved.Users[0].ID != ids[3] || resolved.Users[1].ID != ids[0] {
+			t.Errorf("Unexpected resolved users %v", resolved.Users)
+		}
+
+		// поиск по началу имени без учета регистра в алфавитном порядке, страницами
+		var found []string
+		request := dto.SearchUsersRequest{Prefix: "AL", Limit: 2}
+		for page := 0; page < 3; page++ {
+			response, err := userService.SearchUsers(alice, request)
+			if err != nil {
+				t.Fatalf("SearchUsers: %+v", err)
+			}
+			for _, user := range response.Users {
+				found = append(found, user.Username)
+			}
+			if len(response.NextCursor) == 0 {
+				break
+			}
+			request.Cursor = response.NextCursor
+		}
+		checkUsernames(t, found, "al_5", "alex", "alice", "Alina")
+
+		displayName, avatarURL := " Alice ", "https://example.com/alice.png"
+		updated, err := userService.UpdateProfile(alice, dto.UpdateProfileRequest{DisplayName: &displayName, AvatarURL: &avatarURL})
+		if err != nil {
+			t.Fatalf("UpdateProfile: %+v", err)
+		}
+		// поле, которого нет в запросе, не меняется
+		updated, err = userService.UpdateProfile(alice, dto.UpdateProfileRequest{AvatarURL: new(string)})
+		if err != nil {
+			t.Fatalf("UpdateProfile: %+v", err)
+		}
+		if updated.DisplayName != "Alice" || updated.AvatarURL != "" {
+			t.Errorf("Unexpected profile %s, avatar %q", updated, updated.AvatarURL)
+		}
+		invalid := "ftp://example.com/alice.png"
+		if _, err := userService.UpdateProfile(alice, dto.UpdateProfileRequest{AvatarURL: &invalid}); !isErrorKind(err, KindValidation) {
+			t.Errorf("Invalid avatar URL returned %v", err)
+		}
+	})
+}
+
+func checkUsernames(t *testing.T, actual []string, expected ...string) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("Usernames %v, expected %v", actual, expected)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("Usernames %v, expected %v", actual, expected)
+			return
+		}
+	}
+}
@@ -1,32 +1,30 @@
 package storage
 
 import (
-	"../db"
+	"avito/db"
 	"context"
-	"github.com/jackc/pgx"
 )
 
 type StorageAPI interface {
 	GetUserStorage() UserStorageAPI
 	GetChatStorage() ChatStorageAPI
 	GetMessageStorage() MessageStorageAPI
-	GetTransaction(ctx context.Context) (pgx.Tx, error)
+	GetTokenStorage() TokenStorageAPI
+	GetSessionStorage() SessionStorageAPI
+	RunInTx(ctx context.Context, f TxFunc) error
 }
 
 type storageAPI struct {
 	userStorage UserStorageAPI
 	chatStorage ChatStorageAPI
 	messageStorage MessageStorageAPI
+	tokenStorage TokenStorageAPI
+	sessionStorage SessionStorageAPI
 	connDB db.ConnDB
 }
 
-func (s *storageAPI) GetTransaction(ctx context.Context) (pgx.Tx, error) {
-	tx, err := s.connDB.DB.Begin(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	return tx, nil
+func (s *storageAPI) RunInTx(ctx context.Context, f TxFunc) error {
+	return runInPgTx(ctx, s.connDB.DB.Begin, f)
 }
 
 func (s *storageAPI) GetUserStorage() UserStorageAPI {
@@ -41,11 +39,21 @@ func (s *storageAPI) GetMessageStorage() MessageStorageAPI {
 	return s.messageStorage
 }
 
-func NewStorageAPI(connDB db.ConnDB, ctx context.Context) StorageAPI {
+func (s *storageAPI) GetTokenStorage() TokenStorageAPI {
+	return s.tokenStorage
+}
+
+func (s *storageAPI) GetSessionStorage() SessionStorageAPI {
+	return s.sessionStorage
+}
+
+func NewStorageAPI(connDB db.ConnDB) StorageAPI {
 	return &storageAPI{
-		userStorage: NewUserStorageAPI(connDB, ctx),
-		chatStorage: NewChatStorageAPI(connDB, ctx),
-		messageStorage: NewMessageStorageAPI(connDB, ctx),
+		userStorage: NewUserStorageAPI(connDB),
+		chatStorage: NewChatStorageAPI(connDB),
+		messageStorage: NewMessageStorageAPI(connDB),
+		tokenStorage: NewTokenStorageAPI(connDB),
+		sessionStorage: NewSessionStorageAPI(connDB),
 		connDB: connDB,
 	}
 }
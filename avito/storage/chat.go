@@ -1,55 +1,245 @@
 package storage
 
 import (
-	"../db"
-	"../dto"
+	"avito/db"
+	"avito/dto"
+	"bytes"
 	"context"
 	"fmt"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/xerrors"
 	"strings"
+	"time"
 )
 
+// maxUnreadCount - предел подсчета непрочитанных сообщений: клиенту достаточно показать "99+",
+// а подсчет не просматривает всю историю давно не открытого чата
+const maxUnreadCount = 100
+
+// chatNameIndex - уникальный индекс имен групповых чатов без учета регистра
+const chatNameIndex = "chats_lower_name_idx"
+
+// ErrChatNameTaken возвращается при создании и переименовании чата в занятое имя,
+// в том числе когда имя заняли параллельным запросом
+var ErrChatNameTaken = xerrors.New("Chat name is already taken")
+
 type ChatStorageAPI interface {
-	CreateChat(tx pgx.Tx, chatname string) (uuid.UUID, error)
-	CreateRecordChatsUsers(tx pgx.Tx, chatID uuid.UUID, users ...uuid.UUID) error
-	GetChatList(userId uuid.UUID) ([]dto.Chat, error)
-	CheckExistChat(chat uuid.UUID) (bool, error)
+	// CreateChat создает групповой чат без участников. Занятое имя - ErrChatNameTaken
+	CreateChat(ctx context.Context, tx Tx, chatname string) (dto.Chat, error)
+	// CreateDirectChat создает личный чат пары пользователей без участников. ID в ответе равен uuid.Nil,
+	// если чат этой пары уже создан параллельным запросом
+	CreateDirectChat(ctx context.Context, tx Tx, first uuid.UUID, second uuid.UUID) (dto.Chat, error)
+	// GetDirectChat возвращает uuid.Nil, если у пары пользователей нет личного чата
+	GetDirectChat(ctx context.Context, first uuid.UUID, second uuid.UUID) (uuid.UUID, error)
+	// GetChatType возвращает пустую строку, если чата нет
+	GetChatType(ctx context.Context, chat uuid.UUID) (string, error)
+	CreateRecordChatsUsers(ctx context.Context, tx Tx, chatID uuid.UUID, role string, users ...uuid.UUID) error
+	// AddChatUsers добавляет участников с ролью role и возвращает тех, кого в чате еще не было.
+	// Новым участникам вся прежняя история чата засчитывается прочитанной
+	AddChatUsers(ctx context.Context, tx Tx, chatID uuid.UUID, role string, users ...uuid.UUID) ([]uuid.UUID, error)
+	// RemoveChatUser возвращает false, если пользователь не состоит в чате
+	RemoveChatUser(ctx context.Context, tx Tx, chatID uuid.UUID, user uuid.UUID) (bool, error)
+	// GetChatUserRole возвращает роль участника или пустую строку, если пользователь не состоит в чате
+	GetChatUserRole(ctx context.Context, chatID uuid.UUID, user uuid.UUID) (string, error)
+	// SetChatUserRole возвращает false, если пользователь не состоит в чате
+	SetChatUserRole(ctx context.Context, tx Tx, chatID uuid.UUID, user uuid.UUID, role string) (bool, error)
+	// GetChatList заполняет UnreadCount и LastReadMessageID для пользователя userId
+	GetChatList(ctx context.Context, userId uuid.UUID, params ChatListParams) (ChatPage, error)
+	// GetChat возвращает чат со всеми участниками и их ролями, ID равен uuid.Nil, если чата нет
+	GetChat(ctx context.Context, chat uuid.UUID) (dto.Chat, error)
+	GetChatUsers(ctx context.Context, chat uuid.UUID) ([]uuid.UUID, error)
+	CheckExistChat(ctx context.Context, chat uuid.UUID) (bool, error)
+	// IsChatNameTaken проверяет имя без учета регистра среди групповых чатов, чат except не учитывается
+	IsChatNameTaken(ctx context.Context, name string, except uuid.UUID) (bool, error)
+	// RenameChat меняет имя и записывает его в историю переименований. Chat в ответе равен uuid.Nil, если чата нет,
+	// OldName совпадает с NewName, если имя не изменилось и в историю ничего не записано. Занятое имя - ErrChatNameTaken
+	RenameChat(ctx context.Context, tx Tx, chatID uuid.UUID, name string, renamedBy uuid.UUID) (dto.ChatRename, error)
+	GetChatRenames(ctx context.Context, chatID uuid.UUID) ([]dto.ChatRename, error)
+	// MarkChatRead передвигает указатель прочтения участника на сообщение message этого чата. Возвращает false,
+	// если сообщения нет в чате, пользователь не участник или указатель уже на этом сообщении или дальше
+	MarkChatRead(ctx context.Context, tx Tx, chatID uuid.UUID, user uuid.UUID, message uuid.UUID) (bool, error)
+	// GetMessageReaders возвращает участников, кроме автора, чей указатель прочтения на сообщении или дальше
+	GetMessageReaders(ctx context.Context, message uuid.UUID) ([]dto.ReadReceipt, error)
+}
+
+// ChatListParams - параметры выборки чатов пользователя. Чаты выбираются от курсора
+// в сторону более ранней последней активности
+type ChatListParams struct {
+	Page       PageParams
+	NamePrefix string
+	UsersLimit int
+}
+
+// ChatPage - страница чатов, отсортированная по последней активности (от поздней к ранней)
+type ChatPage struct {
+	Chats   []dto.Chat
+	Last    Cursor
+	HasMore bool
 }
 
 type chatStorage struct {
 	db db.ConnDB
-	ctx context.Context
 }
 
-func NewChatStorageAPI(connDB db.ConnDB, ctx context.Context) ChatStorageAPI {
+func NewChatStorageAPI(connDB db.ConnDB) ChatStorageAPI {
 	return &chatStorage{
 		db: connDB,
-		ctx: ctx,
 	}
 }
 
-func (c *chatStorage) CreateChat(tx pgx.Tx, chatname string) (uuid.UUID, error) {
-	chatID := uuid.Must(uuid.NewUUID())
-	if _, err := tx.Exec(c.ctx, `insert into chats (id, name) values ($1, $2)`, chatID, chatname); err != nil {
+func (c *chatStorage) CreateChat(ctx context.Context, tx Tx, chatname string) (dto.Chat, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return dto.Chat{}, err
+	}
+
+	chat := dto.Chat{ID: uuid.Must(uuid.NewUUID()), Name: chatname, Type: dto.ChatGroup}
+	err = ptx.QueryRow(ctx, `insert into chats (id, name, type) values ($1, $2, $3) returning extract(epoch from created_at)`,
+		chat.ID, chatname, chat.Type).Scan(&chat.CreatedAt)
+	if err != nil {
+		return dto.Chat{}, pgChatNameError(err)
+	}
+
+	return chat, nil
+}
+
+func (c *chatStorage) CreateDirectChat(ctx context.Context, tx Tx, first uuid.UUID, second uuid.UUID) (dto.Chat, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return dto.Chat{}, err
+	}
+
+	chat := dto.Chat{ID: uuid.Must(uuid.NewUUID()), Type: dto.ChatDirect}
+	err = ptx.QueryRow(ctx, `insert into chats (id, name, type, direct_key) values ($1, '', $2, $3) 
+on conflict (direct_key) do nothing returning extract(epoch from created_at)`,
+		chat.ID, chat.Type, directChatKey(first, second)).Scan(&chat.CreatedAt)
+	if xerrors.Is(err, pgx.ErrNoRows) {
+		return dto.Chat{}, nil
+	}
+	if err != nil {
+		return dto.Chat{}, err
+	}
+
+	return chat, nil
+}
+
+func (c *chatStorage) GetDirectChat(ctx context.Context, first uuid.UUID, second uuid.UUID) (uuid.UUID, error) {
+	var chatID uuid.UUID
+	err := c.db.DB.QueryRow(ctx, `select id from chats where direct_key=$1`, directChatKey(first, second)).Scan(&chatID)
+	if xerrors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, nil
+	}
+	if err != nil {
 		return uuid.Nil, err
 	}
 
 	return chatID, nil
 }
 
-func (c *chatStorage) CreateRecordChatsUsers(tx pgx.Tx, chatID uuid.UUID, users ...uuid.UUID) error {
+func (c *chatStorage) GetChatType(ctx context.Context, chat uuid.UUID) (string, error) {
+	var chatType string
+	err := c.db.DB.QueryRow(ctx, `select type from chats where id=$1`, chat).Scan(&chatType)
+	if xerrors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return chatType, nil
+}
+
+// directChatKey не зависит от порядка пользователей, уникальный индекс по нему
+// гарантирует единственный личный чат на пару
+func directChatKey(first uuid.UUID, second uuid.UUID) string {
+	if bytes.Compare(first[:], second[:]) > 0 {
+		first, second = second, first
+	}
+	return first.String() + ":" + second.String()
+}
+
+func (c *chatStorage) IsChatNameTaken(ctx context.Context, name string, except uuid.UUID) (bool, error) {
+	var result int
+	err := c.db.DB.QueryRow(ctx, `select count(*) from chats where type='group' and lower(name)=lower($1) and id<>$2`, name, except).Scan(&result)
+	if err != nil {
+		return false, err
+	}
+
+	return result != 0, nil
+}
+
+func (c *chatStorage) RenameChat(ctx context.Context, tx Tx, chatID uuid.UUID, name string, renamedBy uuid.UUID) (dto.ChatRename, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return dto.ChatRename{}, err
+	}
+
+	rename := dto.ChatRename{Chat: chatID, NewName: name, RenamedBy: renamedBy}
+	err = ptx.QueryRow(ctx, `select name from chats where id=$1 for update`, chatID).Scan(&rename.OldName)
+	if xerrors.Is(err, pgx.ErrNoRows) {
+		return dto.ChatRename{}, nil
+	}
+	if err != nil {
+		return dto.ChatRename{}, err
+	}
+	if rename.OldName == name {
+		return rename, nil
+	}
+
+	_, err = ptx.Exec(ctx, `update chats set name=$2 where id=$1`, chatID, name)
+	if err != nil {
+		return dto.ChatRename{}, pgChatNameError(err)
+	}
+
+	err = ptx.QueryRow(ctx, `insert into chat_renames (id, chat_id, old_name, new_name, renamed_by) values ($1, $2, $3, $4, $5) 
+returning extract(epoch from created_at)`, uuid.Must(uuid.NewUUID()), chatID, rename.OldName, name, renamedBy).Scan(&rename.CreatedAt)
+	if err != nil {
+		return dto.ChatRename{}, err
+	}
+
+	return rename, nil
+}
+
+func (c *chatStorage) GetChatRenames(ctx context.Context, chatID uuid.UUID) ([]dto.ChatRename, error) {
+	rows, err := c.db.DB.Query(ctx, `select old_name, new_name, renamed_by, extract(epoch from created_at) from chat_renames 
+where chat_id=$1 order by created_at, id`, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	renames := make([]dto.ChatRename, 0)
+	for rows.Next() {
+		rename := dto.ChatRename{Chat: chatID}
+		if err := rows.Scan(&rename.OldName, &rename.NewName, &rename.RenamedBy, &rename.CreatedAt); err != nil {
+			return nil, err
+		}
+		renames = append(renames, rename)
+	}
+
+	return renames, rows.Err()
+}
+
+func (c *chatStorage) CreateRecordChatsUsers(ctx context.Context, tx Tx, chatID uuid.UUID, role string, users ...uuid.UUID) error {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return err
+	}
+
 	valueString := make([]string, 0, len(users))
-	valueArgs := make([]interface{}, 0, len(users) * 3)
+	valueArgs := make([]interface{}, 0, len(users) * 4)
 	for idx, user := range users {
 		recordID := uuid.Must(uuid.NewUUID())
-		valueString = append(valueString, fmt.Sprintf("($%d,$%d,$%d)", idx*3+1, idx*3+2, idx*3+3))
+		valueString = append(valueString, fmt.Sprintf("($%d,$%d,$%d,$%d)", idx*4+1, idx*4+2, idx*4+3, idx*4+4))
 		valueArgs = append(valueArgs, recordID)
 		valueArgs = append(valueArgs, user)
 		valueArgs = append(valueArgs, chatID)
+		valueArgs = append(valueArgs, role)
 	}
 
-	_, err := tx.Exec(c.ctx, fmt.Sprintf(`insert into chats_users (id, user_id, chat_id) values %s`, strings.Join(valueString, ",")), valueArgs...)
+	_, err = ptx.Exec(ctx, fmt.Sprintf(`insert into chats_users (id, user_id, chat_id, role) values %s`, strings.Join(valueString, ",")), valueArgs...)
 	if err != nil {
 		return err
 	}
@@ -57,63 +247,434 @@ func (c *chatStorage) CreateRecordChatsUsers(tx pgx.Tx, chatID uuid.UUID, users
 	return nil
 }
 
-func (c *chatStorage) GetChatList(userId uuid.UUID) ([]dto.Chat, error) {
-	rows, err := c.db.DB.Query(c.ctx, `select t1.chat_id as chat_id, t1.name as name, extract(epoch from coalesce(t2.created_at, t1.created_at)) as created_at 
-from (select u.chat_id, c.name, c.created_at from chats_users u join chats c 
-	on u.chat_id = c.id where user_id=$1) t1 
-left join (select chat, created_at from messages order by created_at desc limit 1) t2 
-	on t1.chat_id = t2.chat 
-order by created_at desc`, userId)
+func (c *chatStorage) AddChatUsers(ctx context.Context, tx Tx, chatID uuid.UUID, role string, users ...uuid.UUID) ([]uuid.UUID, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	valueString := make([]string, 0, len(users))
+	valueArgs := make([]interface{}, 0, len(users) * 4)
+	for idx, user := range users {
+		valueString = append(valueString, fmt.Sprintf("($%d,$%d,$%d,$%d)", idx*4+1, idx*4+2, idx*4+3, idx*4+4))
+		valueArgs = append(valueArgs, uuid.Must(uuid.NewUUID()), user, chatID, role)
+	}
+
+	rows, err := ptx.Query(ctx, fmt.Sprintf(`insert into chats_users (id, user_id, chat_id, role) values %s 
+on conflict (chat_id, user_id) do nothing returning user_id`, strings.Join(valueString, ",")), valueArgs...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
+	added := make([]uuid.UUID, 0, len(users))
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		added = append(added, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(added) == 0 {
+		return added, nil
+	}
+
+	// указатель прочтения новых участников - последнее сообщение чата
+	paramsString, parsedIDs := makeParamsFromUUID(added)
+	_, err = ptx.Exec(ctx, fmt.Sprintf(`update chats_users cu set last_read_message_id=c.last_message_id, 
+	last_read_message_at=c.last_message_at, read_at=c.last_message_at from chats c 
+where c.id = cu.chat_id and cu.chat_id=$%d and cu.user_id in (%s)`, len(parsedIDs)+1, paramsString), append(parsedIDs, chatID)...)
 	if err != nil {
 		return nil, err
 	}
 
-	chats := make([]dto.Chat, 0)
-	chatIDs := make([]uuid.UUID, 0)
+	return added, nil
+}
+
+func (c *chatStorage) RemoveChatUser(ctx context.Context, tx Tx, chatID uuid.UUID, user uuid.UUID) (bool, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := ptx.Exec(ctx, `delete from chats_users where chat_id=$1 and user_id=$2`, chatID, user)
+	if err != nil {
+		return false, err
+	}
 
+	return tag.RowsAffected() == 1, nil
+}
+
+func (c *chatStorage) GetChatUserRole(ctx context.Context, chatID uuid.UUID, user uuid.UUID) (string, error) {
+	var role string
+	err := c.db.DB.QueryRow(ctx, `select role from chats_users where chat_id=$1 and user_id=$2`, chatID, user).Scan(&role)
+	if xerrors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return role, nil
+}
+
+func (c *chatStorage) SetChatUserRole(ctx context.Context, tx Tx, chatID uuid.UUID, user uuid.UUID, role string) (bool, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := ptx.Exec(ctx, `update chats_users set role=$3 where chat_id=$1 and user_id=$2`, chatID, user, role)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (c *chatStorage) GetChatList(ctx context.Context, userId uuid.UUID, params ChatListParams) (ChatPage, error) {
+	args := []interface{}{userId, params.Page.Limit + 1}
+	conditions := make([]string, 0, 2)
+	if len(params.NamePrefix) != 0 {
+		args = append(args, escapeLike(strings.ToLower(params.NamePrefix))+"%")
+		conditions = append(conditions, fmt.Sprintf("lower(name) like $%d", len(args)))
+	}
+	if params.Page.Cursor != nil {
+		args = append(args, params.Page.Cursor.pgTime(), params.Page.Cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(activity, chat_id) < ($%d::timestamp, $%d::uuid)", len(args)-1, len(args)))
+	}
+	where := ""
+	if len(conditions) != 0 {
+		where = "where " + strings.Join(conditions, " and ")
+	}
+
+	// последняя активность чата - время последнего сообщения или время создания, если сообщений нет
+	rows, err := c.db.DB.Query(ctx, fmt.Sprintf(`select chat_id, name, type, created_at, activity, 
+	last_message_id, last_message_author, last_message_text, last_message_type, last_message_target, last_message_at, 
+	last_message_edited_at, last_message_deleted_at, last_message_deleted_by, 
+	last_message_parent, last_message_reply_count, last_message_last_reply_at from (
+	select c.id as chat_id, c.name, c.type, c.created_at, coalesce(c.last_message_at, c.created_at) as activity, 
+		m.id as last_message_id, m.author as last_message_author, 
+		case when m.deleted_at is null then m.text else '' end as last_message_text, 
+		m.type as last_message_type, m.target as last_message_target, c.last_message_at, 
+		m.edited_at as last_message_edited_at, m.deleted_at as last_message_deleted_at, 
+		m.deleted_by as last_message_deleted_by, m.parent as last_message_parent, m.reply_count as last_message_reply_count, 
+		m.last_reply_at as last_message_last_reply_at 
+	from chats_users u join chats c on u.chat_id = c.id 
+	left join messages m on m.id = c.last_message_id 
+	where u.user_id=$1) t 
+%s 
+order by activity desc, chat_id desc limit $2`, where), args...)
+	if err != nil {
+		return ChatPage{}, err
+	}
+	defer rows.Close()
+
+	chats := make([]dto.Chat, 0, params.Page.Limit+1)
+	cursors := make([]Cursor, 0, params.Page.Limit+1)
 	for rows.Next() {
 		var chat dto.Chat
-		err := rows.Scan(&chat.ID, &chat.Name, &chat.CreatedAt)
+		var createdAt, activity time.Time
+		var lastMessageID, lastMessageAuthor *uuid.UUID
+		var lastMessageText, lastMessageType *string
+		var lastMessageTarget, lastMessageDeletedBy, lastMessageParent *uuid.UUID
+		var lastMessageReplyCount *int
+		var lastMessageAt, lastMessageEditedAt, lastMessageDeletedAt, lastMessageLastReplyAt *time.Time
+		err := rows.Scan(&chat.ID, &chat.Name, &chat.Type, &createdAt, &activity,
+			&lastMessageID, &lastMessageAuthor, &lastMessageText, &lastMessageType, &lastMessageTarget, &lastMessageAt,
+			&lastMessageEditedAt, &lastMessageDeletedAt, &lastMessageDeletedBy, &lastMessageParent, &lastMessageReplyCount, &lastMessageLastReplyAt)
 		if err != nil {
-			return nil, err
+			return ChatPage{}, err
+		}
+		chat.CreatedAt = epoch(createdAt)
+		if lastMessageID != nil && lastMessageAt != nil {
+			chat.LastMessage = &dto.Message{
+				ID:          *lastMessageID,
+				Chat:        chat.ID,
+				Author:      *lastMessageAuthor,
+				Text:        *lastMessageText,
+				Type:        *lastMessageType,
+				Target:      lastMessageTarget,
+				CreatedAt:   epoch(*lastMessageAt),
+				EditedAt:    nullEpoch(lastMessageEditedAt),
+				DeletedAt:   nullEpoch(lastMessageDeletedAt),
+				DeletedBy:   lastMessageDeletedBy,
+				Parent:      lastMessageParent,
+				LastReplyAt: nullEpoch(lastMessageLastReplyAt),
+			}
+			if lastMessageReplyCount != nil {
+				chat.LastMessage.ReplyCount = *lastMessageReplyCount
+			}
+			chat.LastMessageAt = chat.LastMessage.CreatedAt
 		}
-
-		chatIDs = append(chatIDs, chat.ID)
 
 		chats = append(chats, chat)
+		cursors = append(cursors, Cursor{Time: activity, ID: chat.ID})
+	}
+	if err := rows.Err(); err != nil {
+		return ChatPage{}, err
+	}
+
+	page := ChatPage{Chats: chats}
+	if len(chats) > params.Page.Limit {
+		page.Chats = chats[:params.Page.Limit]
+		page.Last = cursors[params.Page.Limit-1]
+		page.HasMore = true
+	}
+
+	if err := c.fillChatUsers(ctx, page.Chats, params.UsersLimit); err != nil {
+		return ChatPage{}, err
+	}
+	if err := c.fillReadState(ctx, page.Chats, userId); err != nil {
+		return ChatPage{}, err
+	}
+
+	return page, nil
+}
+
+// fillReadState заполняет указатель прочтения и количество непрочитанных сообщений для пользователя.
+// Подсчет идет по индексу (chat, created_at, id) только по сообщениям после указателя и не больше maxUnreadCount
+func (c *chatStorage) fillReadState(ctx context.Context, chats []dto.Chat, user uuid.UUID) error {
+	if len(chats) == 0 {
+		return nil
+	}
+
+	chatIDs := make([]uuid.UUID, 0, len(chats))
+	for _, chat := range chats {
+		chatIDs = append(chatIDs, chat.ID)
 	}
 
-	usersByChatID := make(map[uuid.UUID][]uuid.UUID)
 	paramsString, parsedIDs := makeParamsFromUUID(chatIDs)
-	rows, err = c.db.DB.Query(c.ctx, fmt.Sprintf(`select chat_id, user_id from chats_users where chat_id in (%s)`, paramsString), parsedIDs...)
+	rows, err := c.db.DB.Query(ctx, fmt.Sprintf(`select cu.chat_id, cu.last_read_message_id, (select count(*) from (select 1 from messages m 
+	where m.chat = cu.chat_id and (m.created_at, m.id) > (coalesce(cu.last_read_message_at, '-infinity'::timestamp), 
+		coalesce(cu.last_read_message_id, '00000000-0000-0000-0000-000000000000'::uuid))
+		and not exists (select 1 from hidden_messages h where h.user_id = cu.user_id and h.message_id = m.id) limit %d) unread) 
+from chats_users cu where cu.user_id=$%d and cu.chat_id in (%s)`, maxUnreadCount, len(parsedIDs)+1, paramsString), append(parsedIDs, user)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	unreadByChatID := make(map[uuid.UUID]int)
+	lastReadByChatID := make(map[uuid.UUID]*uuid.UUID)
+	for rows.Next() {
+		var chatID uuid.UUID
+		var lastRead *uuid.UUID
+		var unread int
+		if err := rows.Scan(&chatID, &lastRead, &unread); err != nil {
+			return err
+		}
+		unreadByChatID[chatID] = unread
+		lastReadByChatID[chatID] = lastRead
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range chats {
+		chats[i].UnreadCount = unreadByChatID[chats[i].ID]
+		chats[i].LastReadMessageID = lastReadByChatID[chats[i].ID]
+	}
+
+	return nil
+}
+
+func (c *chatStorage) MarkChatRead(ctx context.Context, tx Tx, chatID uuid.UUID, user uuid.UUID, message uuid.UUID) (bool, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	// указатель двигается только вперед, поэтому отметка старого сообщения ничего не меняет
+	tag, err := ptx.Exec(ctx, `update chats_users cu set last_read_message_id=m.id, last_read_message_at=m.created_at, 
+	read_at=CURRENT_TIMESTAMP from messages m 
+where m.id=$3 and m.chat=$1 and cu.chat_id=$1 and cu.user_id=$2 
+	and (cu.last_read_message_at is null or (cu.last_read_message_at, cu.last_read_message_id) < (m.created_at, m.id))`,
+		chatID, user, message)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (c *chatStorage) GetMessageReaders(ctx context.Context, message uuid.UUID) ([]dto.ReadReceipt, error) {
+	rows, err := c.db.DB.Query(ctx, `select cu.user_id, cu.read_at from chats_users cu join messages m on m.chat = cu.chat_id 
+where m.id=$1 and cu.user_id <> m.author and (cu.last_read_message_at, cu.last_read_message_id) >= (m.created_at, m.id) 
+order by cu.read_at, cu.user_id`, message)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
+	receipts := make([]dto.ReadReceipt, 0)
+	for rows.Next() {
+		var receipt dto.ReadReceipt
+		var readAt time.Time
+		if err := rows.Scan(&receipt.User, &readAt); err != nil {
+			return nil, err
+		}
+		receipt.ReadAt = epoch(readAt)
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, rows.Err()
+}
+
+// fillChatUsers заполняет участников чатов страницы. usersLimit < 0 - только количество участников,
+// 0 - все участники, иначе не больше usersLimit участников на чат
+func (c *chatStorage) fillChatUsers(ctx context.Context, chats []dto.Chat, usersLimit int) error {
+	if len(chats) == 0 {
+		return nil
+	}
+
+	chatIDs := make([]uuid.UUID, 0, len(chats))
+	for _, chat := range chats {
+		chatIDs = append(chatIDs, chat.ID)
+	}
+
+	paramsString, parsedIDs := makeParamsFromUUID(chatIDs)
+	limitParam := len(parsedIDs) + 1
+	rows, err := c.db.DB.Query(ctx, fmt.Sprintf(`select chat_id, user_id, total, rn from (
+	select chat_id, user_id, count(*) over (partition by chat_id) as total, 
+		row_number() over (partition by chat_id order by id) as rn 
+	from chats_users where chat_id in (%s)) t 
+where $%d::int = 0 or rn <= greatest($%d::int, 1)`, paramsString, limitParam, limitParam), append(parsedIDs, usersLimit)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	usersByChatID := make(map[uuid.UUID][]uuid.UUID)
+	countByChatID := make(map[uuid.UUID]int)
 	for rows.Next() {
 		var chatID, userID uuid.UUID
-		err := rows.Scan(&chatID, &userID)
+		var total, rn int
+		err := rows.Scan(&chatID, &userID, &total, &rn)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		countByChatID[chatID] = total
+		if usersLimit == 0 || rn <= usersLimit {
+			usersByChatID[chatID] = append(usersByChatID[chatID], userID)
 		}
-		usersByChatID[chatID] = append(usersByChatID[chatID], userID)
+	}
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
 	for i := range chats {
 		chats[i].Users = usersByChatID[chats[i].ID]
+		chats[i].UsersCount = countByChatID[chats[i].ID]
 	}
 
-	return chats, nil
+	return nil
 }
 
-func (c *chatStorage) CheckExistChat(chat uuid.UUID) (bool, error) {
+func (c *chatStorage) GetChat(ctx context.Context, chatID uuid.UUID) (dto.Chat, error) {
+	var chat dto.Chat
+	var createdAt time.Time
+	var lastMessageID, lastMessageAuthor *uuid.UUID
+	var lastMessageText, lastMessageType *string
+	var lastMessageTarget, lastMessageDeletedBy, lastMessageParent *uuid.UUID
+	var lastMessageReplyCount *int
+	var lastMessageAt, lastMessageEditedAt, lastMessageDeletedAt, lastMessageLastReplyAt *time.Time
+	err := c.db.DB.QueryRow(ctx, `select c.id, c.name, c.type, c.created_at, 
+	m.id, m.author, case when m.deleted_at is null then m.text else '' end, m.type, m.target, 
+	c.last_message_at, m.edited_at, m.deleted_at, m.deleted_by, m.parent, m.reply_count, m.last_reply_at 
+from chats c left join messages m on m.id = c.last_message_id 
+where c.id=$1`, chatID).Scan(&chat.ID, &chat.Name, &chat.Type, &createdAt,
+		&lastMessageID, &lastMessageAuthor, &lastMessageText, &lastMessageType, &lastMessageTarget, &lastMessageAt,
+		&lastMessageEditedAt, &lastMessageDeletedAt, &lastMessageDeletedBy, &lastMessageParent, &lastMessageReplyCount, &lastMessageLastReplyAt)
+	if xerrors.Is(err, pgx.ErrNoRows) {
+		return dto.Chat{}, nil
+	}
+	if err != nil {
+		return dto.Chat{}, err
+	}
+	chat.CreatedAt = epoch(createdAt)
+	if lastMessageID != nil && lastMessageAt != nil {
+		chat.LastMessage = &dto.Message{
+			ID:          *lastMessageID,
+			Chat:        chat.ID,
+			Author:      *lastMessageAuthor,
+			Text:        *lastMessageText,
+			Type:        *lastMessageType,
+			Target:      lastMessageTarget,
+			CreatedAt:   epoch(*lastMessageAt),
+			EditedAt:    nullEpoch(lastMessageEditedAt),
+			DeletedAt:   nullEpoch(lastMessageDeletedAt),
+			DeletedBy:   lastMessageDeletedBy,
+			Parent:      lastMessageParent,
+			LastReplyAt: nullEpoch(lastMessageLastReplyAt),
+		}
+		if lastMessageReplyCount != nil {
+			chat.LastMessage.ReplyCount = *lastMessageReplyCount
+		}
+		chat.LastMessageAt = chat.LastMessage.CreatedAt
+	}
+
+	rows, err := c.db.DB.Query(ctx, `select user_id, role from chats_users where chat_id=$1 order by id`, chat.ID)
+	if err != nil {
+		return dto.Chat{}, err
+	}
+	defer rows.Close()
+
+	chat.Users = make([]uuid.UUID, 0)
+	chat.Members = make([]dto.ChatMember, 0)
+	for rows.Next() {
+		var member dto.ChatMember
+		if err := rows.Scan(&member.User, &member.Role); err != nil {
+			return dto.Chat{}, err
+		}
+		chat.Users = append(chat.Users, member.User)
+		chat.Members = append(chat.Members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return dto.Chat{}, err
+	}
+	chat.UsersCount = len(chat.Users)
+
+	return chat, nil
+}
+
+func (c *chatStorage) GetChatUsers(ctx context.Context, chat uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := c.db.DB.Query(ctx, `select user_id from chats_users where chat_id=$1`, chat)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		users = append(users, userID)
+	}
+
+	return users, rows.Err()
+}
+
+func (c *chatStorage) CheckExistChat(ctx context.Context, chat uuid.UUID) (bool, error) {
 	var result int
-	err := c.db.DB.QueryRow(context.Background(), `select count(*) from chats where id=$1`, chat).Scan(&result)
+	err := c.db.DB.QueryRow(ctx, `select count(*) from chats where id=$1`, chat).Scan(&result)
 	if err != nil {
 		return false, err
 	}
 
-	return true, nil
-}
\ No newline at end of file
+	return result == 1, nil
+}
+// pgChatNameError заменяет нарушение уникальности имени чата на ErrChatNameTaken
+func pgChatNameError(err error) error {
+	var pgErr *pgconn.PgError
+	if xerrors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation && pgErr.ConstraintName == chatNameIndex {
+		return ErrChatNameTaken
+	}
+	return err
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"avito/dto"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"testing"
+)
+
+func TestChatNameTaken(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, api StorageAPI) {
+		ctx := context.Background()
+		createChat := func(name string) (dto.Chat, error) {
+			var chat dto.Chat
+			err := api.RunInTx(ctx, func(tx Tx) error {
+				var err error
+				chat, err = api.GetChatStorage().CreateChat(ctx, tx, name)
+				return err
+			})
+			return chat, err
+		}
+
+		if _, err := createChat("General"); err != nil {
+			t.Fatalf("CreateChat: %+v", err)
+		}
+		// имя уникально без учета регистра
+		if _, err := createChat("general"); !xerrors.Is(err, ErrChatNameTaken) {
+			t.Errorf("CreateChat with taken name returned %v, expected %v", err, ErrChatNameTaken)
+		}
+
+		random, err := createChat("random")
+		if err != nil {
+			t.Fatalf("CreateChat: %+v", err)
+		}
+		user, err := createTestUser(ctx, api, "alice")
+		if err != nil {
+			t.Fatalf("CreateUser: %+v", err)
+		}
+		err = api.RunInTx(ctx, func(tx Tx) error {
+			_, err := api.GetChatStorage().RenameChat(ctx, tx, random.ID, "GENERAL", user)
+			return err
+		})
+		if !xerrors.Is(err, ErrChatNameTaken) {
+			t.Errorf("RenameChat to taken name returned %v, expected %v", err, ErrChatNameTaken)
+		}
+	})
+}
+
+func TestUnreadCountIsCapped(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, api StorageAPI) {
+		ctx := context.Background()
+		alice, err := createTestUser(ctx, api, "alice")
+		if err != nil {
+			t.Fatalf("CreateUser: %+v", err)
+		}
+		bob, err := createTestUser(ctx, api, "bob")
+		if err != nil {
+			t.Fatalf("CreateUser: %+v", err)
+		}
+
+		var chat dto.Chat
+		messages := make([]uuid.UUID, 0, maxUnreadCount+10)
+		err = api.RunInTx(ctx, func(tx Tx) error {
+			var err error
+			chat, err = api.GetChatStorage().CreateChat(ctx, tx, "general")
+			if err != nil {
+				return err
+			}
+			if err := api.GetChatStorage().CreateRecordChatsUsers(ctx, tx, chat.ID, dto.RoleOwner, alice); err != nil {
+				return err
+			}
+			if err := api.GetChatStorage().CreateRecordChatsUsers(ctx, tx, chat.ID, dto.RoleMember, bob); err != nil {
+				return err
+			}
+			for i := 0; i < maxUnreadCount+10; i++ {
+				message, err := api.GetMessageStorage().CreateMessage(ctx, tx, alice, chat.ID, uuid.Nil, fmt.Sprintf("message %d", i))
+				if err != nil {
+					return err
+				}
+				messages = append(messages, message.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Cannot prepare chat: %+v", err)
+		}
+
+		unread := func() int {
+			t.Helper()
+			page, err := api.GetChatStorage().GetChatList(ctx, bob, ChatListParams{Page: PageParams{Limit: 10}})
+			if err != nil {
+				t.Fatalf("GetChatList: %+v", err)
+			}
+			if len(page.Chats) != 1 {
+				t.Fatalf("Unexpected chats %v", page.Chats)
+			}
+			return page.Chats[0].UnreadCount
+		}
+		if count := unread(); count != maxUnreadCount {
+			t.Errorf("Unread count is %d, expected %d", count, maxUnreadCount)
+		}
+
+		err = api.RunInTx(ctx, func(tx Tx) error {
+			_, err := api.GetChatStorage().MarkChatRead(ctx, tx, chat.ID, bob, messages[19])
+			return err
+		})
+		if err != nil {
+			t.Fatalf("MarkChatRead: %+v", err)
+		}
+		if count := unread(); count != 90 {
+			t.Errorf("Unread count after read is %d, expected 90", count)
+		}
+	})
+}
+
+func TestChatListOrderAndPagination(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, api StorageAPI) {
+		ctx := context.Background()
+		alice, err := createTestUser(ctx, api, "alice")
+		if err != nil {
+			t.Fatalf("CreateUser: %+v", err)
+		}
+		bob, err := createTestUser(ctx, api, "bob")
+		if err != nil {
+			t.Fatalf("CreateUser: %+v", err)
+		}
+		general := createTestChat(t, api, "general", alice, bob)
+		random := createTestChat(t, api, "random", alice, bob)
+		games := createTestChat(t, api, "games", alice, bob)
+		createTestChat(t, api, "other", bob)
+		// чат без сообщений упорядочен по времени создания, с сообщениями - по последнему сообщению
+		createTestMessages(t, api, general, bob, "hello")
+
+		getPage := func(params ChatListParams) ChatPage {
+			t.Helper()
+			page, err := api.GetChatStorage().GetChatList(ctx, alice, params)
+			if err != nil {
+				t.Fatalf("GetChatList: %+v", err)
+			}
+			return page
+		}
+		names := func(page ChatPage) []string {
+			result := make([]string, 0, len(page.Chats))
+			for _, chat := range page.Chats {
+				result = append(result, chat.Name)
+			}
+			return result
+		}
+
+		first := getPage(ChatListParams{Page: PageParams{Limit: 2}})
+		checkTexts(t, names(first), "general", "games")
+		if !first.HasMore || first.Chats[0].LastMessage == nil || first.Chats[0].LastMessage.Text != "hello" {
+			t.Errorf("Unexpected first page %v, HasMore %t", first.Chats, first.HasMore)
+		}
+		second := getPage(ChatListParams{Page: PageParams{Cursor: &first.Last, Limit: 2}})
+		checkTexts(t, names(second), "random")
+		if second.HasMore {
+			t.Errorf("Last page has more chats")
+		}
+
+		// новое сообщение поднимает чат наверх
+		createTestMessages(t, api, random, alice, "bump")
+		checkTexts(t, names(getPage(ChatListParams{Page: PageParams{Limit: 10}})), "random", "general", "games")
+
+		// фильтр по началу имени без учета регистра
+		filtered := getPage(ChatListParams{Page: PageParams{Limit: 10}, NamePrefix: "GA"})
+		checkTexts(t, names(filtered), "games")
+		if filtered.Chats[0].ID != games {
+			t.Errorf("Unexpected chat %s", filtered.Chats[0].ID)
+		}
+	})
+}
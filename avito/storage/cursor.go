@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pgTimestampLayout - формат передачи времени в параметр с приведением к timestamp
+const pgTimestampLayout = "2006-01-02 15:04:05.999999"
+
+// Cursor - позиция в выборке, упорядоченной по паре (время, id).
+// id нужен для стабильного порядка записей с одинаковым временем
+type Cursor struct {
+	Time time.Time
+	ID   uuid.UUID
+}
+
+func (c Cursor) Encode() string {
+	raw := fmt.Sprintf("%d:%s", c.Time.UnixNano()/int64(time.Microsecond), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(cursor string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Cursor{}, xerrors.Errorf("Invalid cursor: %v", err)
+	}
+
+	return parseCursor(string(raw))
+}
+
+// parseCursor разбирает курсор без base64: время в микросекундах и id через двоеточие
+func parseCursor(raw string) (Cursor, error) {
+	parts := strings.SplitN(raw, ":", 2)
+	if len(parts) != 2 {
+		return Cursor{}, xerrors.Errorf("Invalid cursor format")
+	}
+
+	micro, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Cursor{}, xerrors.Errorf("Invalid cursor time: %v", err)
+	}
+
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return Cursor{}, xerrors.Errorf("Invalid cursor id: %v", err)
+	}
+
+	return Cursor{Time: time.Unix(0, micro*int64(time.Microsecond)).UTC(), ID: id}, nil
+}
+
+// SearchCursor - позиция в результатах поиска, упорядоченных по убыванию (релевантность, время, id).
+// При поиске по времени Rank равен 0
+type SearchCursor struct {
+	Rank float64
+	Cursor
+}
+
+func (c SearchCursor) Encode() string {
+	raw := fmt.Sprintf("%s:%d:%s", strconv.FormatFloat(c.Rank, 'g', -1, 64), c.Time.UnixNano()/int64(time.Microsecond), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeSearchCursor(cursor string) (SearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return SearchCursor{}, xerrors.Errorf("Invalid cursor: %v", err)
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return SearchCursor{}, xerrors.Errorf("Invalid cursor format")
+	}
+
+	rank, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return SearchCursor{}, xerrors.Errorf("Invalid cursor rank: %v", err)
+	}
+
+	c, err := parseCursor(parts[1])
+	if err != nil {
+		return SearchCursor{}, err
+	}
+
+	return SearchCursor{Rank: rank, Cursor: c}, nil
+}
+
+func (c Cursor) pgTime() string {
+	return c.Time.UTC().Format(pgTimestampLayout)
+}
+
+// PageParams - параметры выборки страницы: от курсора (или с края выборки, если курсора нет)
+// в сторону более ранних (Older) или более поздних записей
+type PageParams struct {
+	Cursor *Cursor
+	Older  bool
+	Limit  int
+}
+
+func epoch(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// nullEpoch возвращает 0 для NULL
+func nullEpoch(t *time.Time) float64 {
+	if t == nil {
+		return 0
+	}
+	return epoch(*t)
+}
@@ -4,8 +4,24 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"strings"
+	"time"
 )
 
+// rowScanner - строка результата pgx или database/sql
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// extraScanner дописывает к полям, которые сканирует вызывающий, дополнительные колонки выборки
+type extraScanner struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (s extraScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
 func makeParamsFromUUID(paramIDs []uuid.UUID) (string, []interface{}) {
 	params := make([]string, 0, len(paramIDs))
 	result := make([]interface{}, 0, len(paramIDs))
@@ -16,3 +32,46 @@ func makeParamsFromUUID(paramIDs []uuid.UUID) (string, []interface{}) {
 
 	return strings.Join(params, ","), result
 }
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// escapeLike экранирует спецсимволы шаблона like, чтобы искать строку как префикс
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// nullUUID передает uuid.Nil в запрос как NULL
+func nullUUID(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
+
+// nullString передает пустую строку в запрос как NULL
+func nullString(s string) *string {
+	if len(s) == 0 {
+		return nil
+	}
+	return &s
+}
+
+// fromNullString возвращает пустую строку для NULL
+func fromNullString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func pgTimestamp(t time.Time) string {
+	return t.UTC().Format(pgTimestampLayout)
+}
+
+func pgNullTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	result := pgTimestamp(*t)
+	return &result
+}
@@ -0,0 +1,331 @@
+package storage
+
+import (
+	"avito/dto"
+	"bytes"
+	"context"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"sync"
+	"time"
+)
+
+type memUser struct {
+	ID           uuid.UUID
+	Username     string
+	PasswordHash string
+	DisplayName  string
+	AvatarURL    string
+	CreatedAt    time.Time
+}
+
+type memChat struct {
+	ID            uuid.UUID
+	Name          string
+	Type          string
+	CreatedAt     time.Time
+	LastMessageID uuid.UUID
+	LastMessageAt time.Time
+}
+
+func (c *memChat) activity() time.Time {
+	if c.LastMessageID == uuid.Nil {
+		return c.CreatedAt
+	}
+	return c.LastMessageAt
+}
+
+type memMessage struct {
+	ID        uuid.UUID
+	Chat      uuid.UUID
+	Author    uuid.UUID
+	Text      string
+	CreatedAt time.Time
+	Type      string
+	Target    uuid.UUID
+	// нулевое время - сообщение не редактировалось или не удалялось
+	EditedAt  time.Time
+	DeletedAt time.Time
+	DeletedBy uuid.UUID
+	// uuid.Nil - сообщение в ленте чата, иначе корень треда
+	Parent      uuid.UUID
+	ReplyCount  int
+	LastReplyAt time.Time
+}
+
+type memReaction struct {
+	User  uuid.UUID
+	Emoji string
+}
+
+type memPin struct {
+	Chat     uuid.UUID
+	PinnedBy uuid.UUID
+	PinnedAt time.Time
+}
+
+// memReadPointer - последнее прочитанное сообщение и время, когда участник его прочитал
+type memReadPointer struct {
+	MessageID uuid.UUID
+	MessageAt time.Time
+	ReadAt    time.Time
+}
+
+// memoryDB - таблицы хранилища в памяти, все обращения под mu
+type memoryDB struct {
+	mu sync.RWMutex
+	// транзакции выполняются по одной, поэтому результаты операций, вычисленные при вызове,
+	// остаются верными при коммите
+	txMu      sync.Mutex
+	users     map[uuid.UUID]*memUser
+	usernames map[string]uuid.UUID
+	chats     map[uuid.UUID]*memChat
+	// имя группового чата в нижнем регистре -> чат
+	chatNames map[string]uuid.UUID
+	// directChatKey пары пользователей -> личный чат
+	directChats map[string]uuid.UUID
+	// история переименований чата от ранних к поздним
+	chatRenames map[uuid.UUID][]dto.ChatRename
+	// участники чата в порядке добавления
+	chatUsers map[uuid.UUID][]uuid.UUID
+	// чаты пользователя с его ролью в каждом
+	userChats map[uuid.UUID]map[uuid.UUID]string
+	messages  map[uuid.UUID]*memMessage
+	// сообщения чата, отсортированные по (created_at, id)
+	chatMessages map[uuid.UUID][]*memMessage
+	// прежние версии текста сообщения от ранних к поздним
+	messageRevisions map[uuid.UUID][]dto.MessageRevision
+	// сообщения, скрытые пользователем
+	hiddenMessages map[uuid.UUID]map[uuid.UUID]struct{}
+	// реакции на сообщение в порядке добавления
+	messageReactions map[uuid.UUID][]memReaction
+	// закрепленные сообщения
+	pinnedMessages map[uuid.UUID]memPin
+	// указатели прочтения: чат -> участник -> последнее прочитанное сообщение
+	readPointers map[uuid.UUID]map[uuid.UUID]memReadPointer
+	// токены по хэшу
+	tokens   map[string]Token
+	sessions map[uuid.UUID]*Session
+	// хэш refresh token -> сессия
+	refreshTokens map[string]uuid.UUID
+}
+
+func newMemoryDB() *memoryDB {
+	return &memoryDB{
+		users:            make(map[uuid.UUID]*memUser),
+		usernames:        make(map[string]uuid.UUID),
+		chats:            make(map[uuid.UUID]*memChat),
+		chatNames:        make(map[string]uuid.UUID),
+		directChats:      make(map[string]uuid.UUID),
+		chatRenames:      make(map[uuid.UUID][]dto.ChatRename),
+		chatUsers:        make(map[uuid.UUID][]uuid.UUID),
+		userChats:        make(map[uuid.UUID]map[uuid.UUID]string),
+		messages:         make(map[uuid.UUID]*memMessage),
+		chatMessages:     make(map[uuid.UUID][]*memMessage),
+		messageRevisions: make(map[uuid.UUID][]dto.MessageRevision),
+		hiddenMessages:   make(map[uuid.UUID]map[uuid.UUID]struct{}),
+		messageReactions: make(map[uuid.UUID][]memReaction),
+		pinnedMessages:   make(map[uuid.UUID]memPin),
+		readPointers:     make(map[uuid.UUID]map[uuid.UUID]memReadPointer),
+		tokens:           make(map[string]Token),
+		sessions:         make(map[uuid.UUID]*Session),
+		refreshTokens:    make(map[string]uuid.UUID),
+	}
+}
+
+// memOp - изменение, отложенное до коммита. Возвращает функцию отмены изменения,
+// чтобы при ошибке одной из операций откатить уже примененные
+type memOp func(db *memoryDB) (func(), error)
+
+// memTx копит изменения и применяет их атомарно при коммите,
+// до коммита изменения видны только операциям этой транзакции
+type memTx struct {
+	txHooks
+	db       *memoryDB
+	ops      []memOp
+	finished bool
+}
+
+func (t *memTx) storageTx() {}
+
+func (t *memTx) add(op memOp) error {
+	if t.finished {
+		return xerrors.Errorf("Transaction is already finished")
+	}
+	t.ops = append(t.ops, op)
+	return nil
+}
+
+func (t *memTx) commit() error {
+	if t.finished {
+		return xerrors.Errorf("Transaction is already finished")
+	}
+	t.finished = true
+
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	_, err := t.apply()
+	return err
+}
+
+// view выполняет f над таблицами, к которым временно применены изменения транзакции, чтобы операция
+// видела предыдущие изменения своей транзакции. Изменения отменяются до снятия блокировки,
+// поэтому другие запросы их не видят
+func (t *memTx) view(f func(db *memoryDB)) error {
+	if t.finished {
+		return xerrors.Errorf("Transaction is already finished")
+	}
+
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	undo, err := t.apply()
+	if err != nil {
+		return err
+	}
+	defer undo()
+
+	f(t.db)
+	return nil
+}
+
+// apply применяет изменения транзакции и возвращает их отмену. Если операция вернула ошибку,
+// уже примененные отменяются
+func (t *memTx) apply() (func(), error) {
+	undos := make([]func(), 0, len(t.ops))
+	undo := func() {
+		for i := len(undos) - 1; i >= 0; i-- {
+			undos[i]()
+		}
+	}
+	for _, op := range t.ops {
+		opUndo, err := op(t.db)
+		if err != nil {
+			undo()
+			return nil, err
+		}
+		undos = append(undos, opUndo)
+	}
+
+	return undo, nil
+}
+
+func (t *memTx) rollback() {
+	t.finished = true
+	t.ops = nil
+}
+
+func asMemTx(tx Tx) (*memTx, error) {
+	mtx, ok := tx.(*memTx)
+	if !ok {
+		return nil, xerrors.Errorf("Transaction is not created by memory storage")
+	}
+	return mtx, nil
+}
+
+// memNow - текущее время с точностью timestamp в postgres, чтобы курсоры совпадали
+func memNow() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// memSetReadPointer передвигает указатель прочтения вперед и возвращает отмену изменения,
+// nil - указатель уже на этом сообщении или дальше
+func memSetReadPointer(db *memoryDB, chatID uuid.UUID, user uuid.UUID, pointer memReadPointer) func() {
+	prev, ok := db.readPointers[chatID][user]
+	if ok && !memLess(prev.MessageAt, prev.MessageID, pointer.MessageAt, pointer.MessageID) {
+		return nil
+	}
+	if db.readPointers[chatID] == nil {
+		db.readPointers[chatID] = make(map[uuid.UUID]memReadPointer)
+	}
+	db.readPointers[chatID][user] = pointer
+
+	return func() {
+		if ok {
+			db.readPointers[chatID][user] = prev
+		} else {
+			delete(db.readPointers[chatID], user)
+		}
+	}
+}
+
+// memLess - порядок (время, id), как в запросах к postgres
+func memLess(t1 time.Time, id1 uuid.UUID, t2 time.Time, id2 uuid.UUID) bool {
+	if !t1.Equal(t2) {
+		return t1.Before(t2)
+	}
+	return bytes.Compare(id1[:], id2[:]) < 0
+}
+
+type memoryStorageAPI struct {
+	db             *memoryDB
+	userStorage    UserStorageAPI
+	chatStorage    ChatStorageAPI
+	messageStorage MessageStorageAPI
+	tokenStorage   TokenStorageAPI
+	sessionStorage SessionStorageAPI
+}
+
+// NewMemoryStorageAPI - хранилище в памяти для тестов и локальной разработки,
+// данные не сохраняются между запусками
+func NewMemoryStorageAPI() StorageAPI {
+	db := newMemoryDB()
+	return &memoryStorageAPI{
+		db:             db,
+		userStorage:    &memoryUserStorage{db: db},
+		chatStorage:    &memoryChatStorage{db: db},
+		messageStorage: &memoryMessageStorage{db: db},
+		tokenStorage:   &memoryTokenStorage{db: db},
+		sessionStorage: &memorySessionStorage{db: db},
+	}
+}
+
+func (s *memoryStorageAPI) RunInTx(ctx context.Context, f TxFunc) error {
+	tx := &memTx{db: s.db}
+	if err := s.runInTx(tx, f); err != nil {
+		return err
+	}
+	tx.runHooks()
+
+	return nil
+}
+
+// runInTx держит txMu до коммита или отката: транзакции не пересекаются и не конфликтуют при коммите
+func (s *memoryStorageAPI) runInTx(tx *memTx, f TxFunc) error {
+	s.db.txMu.Lock()
+	defer s.db.txMu.Unlock()
+	defer func() {
+		if p := recover(); p != nil {
+			tx.rollback()
+			panic(p)
+		}
+	}()
+
+	if err := f(tx); err != nil {
+		tx.rollback()
+		return err
+	}
+
+	return tx.commit()
+}
+
+func (s *memoryStorageAPI) GetUserStorage() UserStorageAPI {
+	return s.userStorage
+}
+
+func (s *memoryStorageAPI) GetChatStorage() ChatStorageAPI {
+	return s.chatStorage
+}
+
+func (s *memoryStorageAPI) GetMessageStorage() MessageStorageAPI {
+	return s.messageStorage
+}
+
+func (s *memoryStorageAPI) GetTokenStorage() TokenStorageAPI {
+	return s.tokenStorage
+}
+
+func (s *memoryStorageAPI) GetSessionStorage() SessionStorageAPI {
+	return s.sessionStorage
+}
@@ -0,0 +1,552 @@
+package storage
+
+import (
+	"avito/dto"
+	"context"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"sort"
+	"strings"
+)
+
+type memoryChatStorage struct {
+	db *memoryDB
+}
+
+func (c *memoryChatStorage) CreateChat(ctx context.Context, tx Tx, chatname string) (dto.Chat, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return dto.Chat{}, err
+	}
+
+	chat := &memChat{ID: uuid.Must(uuid.NewUUID()), Name: chatname, Type: dto.ChatGroup, CreatedAt: memNow()}
+	nameKey := strings.ToLower(chatname)
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		if _, ok := db.chatNames[nameKey]; ok {
+			return nil, ErrChatNameTaken
+		}
+		db.chats[chat.ID] = chat
+		db.chatNames[nameKey] = chat.ID
+
+		return func() {
+			delete(db.chats, chat.ID)
+			delete(db.chatNames, nameKey)
+		}, nil
+	})
+	if err != nil {
+		return dto.Chat{}, err
+	}
+
+	return dto.Chat{ID: chat.ID, Name: chat.Name, Type: chat.Type, CreatedAt: epoch(chat.CreatedAt)}, nil
+}
+
+func (c *memoryChatStorage) CreateDirectChat(ctx context.Context, tx Tx, first uuid.UUID, second uuid.UUID) (dto.Chat, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return dto.Chat{}, err
+	}
+
+	key := directChatKey(first, second)
+	var exists bool
+	err = mtx.view(func(db *memoryDB) {
+		_, exists = db.directChats[key]
+	})
+	if err != nil || exists {
+		return dto.Chat{}, err
+	}
+
+	chat := &memChat{ID: uuid.Must(uuid.NewUUID()), Type: dto.ChatDirect, CreatedAt: memNow()}
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		if _, ok := db.directChats[key]; ok {
+			return nil, xerrors.Errorf("Direct chat %s was created concurrently", key)
+		}
+		db.chats[chat.ID] = chat
+		db.directChats[key] = chat.ID
+
+		return func() {
+			delete(db.chats, chat.ID)
+			delete(db.directChats, key)
+		}, nil
+	})
+	if err != nil {
+		return dto.Chat{}, err
+	}
+
+	return dto.Chat{ID: chat.ID, Type: chat.Type, CreatedAt: epoch(chat.CreatedAt)}, nil
+}
+
+func (c *memoryChatStorage) GetDirectChat(ctx context.Context, first uuid.UUID, second uuid.UUID) (uuid.UUID, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	return c.db.directChats[directChatKey(first, second)], nil
+}
+
+func (c *memoryChatStorage) GetChatType(ctx context.Context, chat uuid.UUID) (string, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	if item, ok := c.db.chats[chat]; ok {
+		return item.Type, nil
+	}
+	return "", nil
+}
+
+func (c *memoryChatStorage) IsChatNameTaken(ctx context.Context, name string, except uuid.UUID) (bool, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	chatID, ok := c.db.chatNames[strings.ToLower(name)]
+	return ok && chatID != except, nil
+}
+
+func (c *memoryChatStorage) RenameChat(ctx context.Context, tx Tx, chatID uuid.UUID, name string, renamedBy uuid.UUID) (dto.ChatRename, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return dto.ChatRename{}, err
+	}
+
+	var chat *memChat
+	var oldName string
+	err = mtx.view(func(db *memoryDB) {
+		if chat = db.chats[chatID]; chat != nil {
+			oldName = chat.Name
+		}
+	})
+	if err != nil || chat == nil {
+		return dto.ChatRename{}, err
+	}
+	if oldName == name {
+		return dto.ChatRename{Chat: chatID, OldName: oldName, NewName: name, RenamedBy: renamedBy}, nil
+	}
+
+	rename := dto.ChatRename{Chat: chatID, OldName: oldName, NewName: name, RenamedBy: renamedBy, CreatedAt: epoch(memNow())}
+	oldKey, newKey := strings.ToLower(oldName), strings.ToLower(name)
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		if chat.Name != oldName {
+			return nil, xerrors.Errorf("Chat %s was renamed concurrently", chatID)
+		}
+		if owner, ok := db.chatNames[newKey]; ok && owner != chatID {
+			return nil, ErrChatNameTaken
+		}
+		if _, ok := db.users[renamedBy]; !ok {
+			return nil, xerrors.Errorf("User %s is not exist", renamedBy)
+		}
+
+		prevRenames := db.chatRenames[chatID]
+		delete(db.chatNames, oldKey)
+		db.chatNames[newKey] = chatID
+		chat.Name = name
+		db.chatRenames[chatID] = append(append([]dto.ChatRename(nil), prevRenames...), rename)
+
+		return func() {
+			chat.Name = oldName
+			delete(db.chatNames, newKey)
+			db.chatNames[oldKey] = chatID
+			db.chatRenames[chatID] = prevRenames
+		}, nil
+	})
+	if err != nil {
+		return dto.ChatRename{}, err
+	}
+
+	return rename, nil
+}
+
+func (c *memoryChatStorage) GetChatRenames(ctx context.Context, chatID uuid.UUID) ([]dto.ChatRename, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	return append(make([]dto.ChatRename, 0), c.db.chatRenames[chatID]...), nil
+}
+
+func (c *memoryChatStorage) CreateRecordChatsUsers(ctx context.Context, tx Tx, chatID uuid.UUID, role string, users ...uuid.UUID) error {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return err
+	}
+
+	users = append([]uuid.UUID(nil), users...)
+	return mtx.add(func(db *memoryDB) (func(), error) {
+		if _, ok := db.chats[chatID]; !ok {
+			return nil, xerrors.Errorf("Chat %s is not exist", chatID)
+		}
+		for _, user := range users {
+			if _, ok := db.users[user]; !ok {
+				return nil, xerrors.Errorf("User %s is not exist", user)
+			}
+		}
+
+		prevUsers := db.chatUsers[chatID]
+		db.chatUsers[chatID] = append(append([]uuid.UUID(nil), prevUsers...), users...)
+		added := make([]uuid.UUID, 0, len(users))
+		for _, user := range users {
+			if db.userChats[user] == nil {
+				db.userChats[user] = make(map[uuid.UUID]string)
+			}
+			if _, ok := db.userChats[user][chatID]; !ok {
+				db.userChats[user][chatID] = role
+				added = append(added, user)
+			}
+		}
+
+		return func() {
+			db.chatUsers[chatID] = prevUsers
+			for _, user := range added {
+				delete(db.userChats[user], chatID)
+			}
+		}, nil
+	})
+}
+
+func (c *memoryChatStorage) AddChatUsers(ctx context.Context, tx Tx, chatID uuid.UUID, role string, users ...uuid.UUID) ([]uuid.UUID, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	added := make([]uuid.UUID, 0, len(users))
+	err = mtx.view(func(db *memoryDB) {
+		seen := make(map[uuid.UUID]struct{}, len(users))
+		for _, user := range users {
+			if _, ok := seen[user]; ok {
+				continue
+			}
+			seen[user] = struct{}{}
+			if _, ok := db.userChats[user][chatID]; !ok {
+				added = append(added, user)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(added) == 0 {
+		return added, nil
+	}
+
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		if _, ok := db.chats[chatID]; !ok {
+			return nil, xerrors.Errorf("Chat %s is not exist", chatID)
+		}
+		for _, user := range added {
+			if _, ok := db.users[user]; !ok {
+				return nil, xerrors.Errorf("User %s is not exist", user)
+			}
+			if _, ok := db.userChats[user][chatID]; ok {
+				return nil, xerrors.Errorf("User %s was added to chat %s concurrently", user, chatID)
+			}
+		}
+
+		prevUsers := db.chatUsers[chatID]
+		db.chatUsers[chatID] = append(append([]uuid.UUID(nil), prevUsers...), added...)
+		chatRow := db.chats[chatID]
+		for _, user := range added {
+			if db.userChats[user] == nil {
+				db.userChats[user] = make(map[uuid.UUID]string)
+			}
+			db.userChats[user][chatID] = role
+			// указатель прочтения новых участников - последнее сообщение чата
+			if chatRow.LastMessageID != uuid.Nil {
+				memSetReadPointer(db, chatID, user, memReadPointer{
+					MessageID: chatRow.LastMessageID, MessageAt: chatRow.LastMessageAt, ReadAt: chatRow.LastMessageAt,
+				})
+			}
+		}
+
+		return func() {
+			db.chatUsers[chatID] = prevUsers
+			for _, user := range added {
+				delete(db.userChats[user], chatID)
+				delete(db.readPointers[chatID], user)
+			}
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return added, nil
+}
+
+func (c *memoryChatStorage) RemoveChatUser(ctx context.Context, tx Tx, chatID uuid.UUID, user uuid.UUID) (bool, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	var member bool
+	err = mtx.view(func(db *memoryDB) {
+		_, member = db.userChats[user][chatID]
+	})
+	if err != nil || !member {
+		return false, err
+	}
+
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		role, ok := db.userChats[user][chatID]
+		if !ok {
+			return nil, xerrors.Errorf("User %s was removed from chat %s concurrently", user, chatID)
+		}
+
+		prevUsers := db.chatUsers[chatID]
+		users := make([]uuid.UUID, 0, len(prevUsers))
+		for _, item := range prevUsers {
+			if item != user {
+				users = append(users, item)
+			}
+		}
+		db.chatUsers[chatID] = users
+		delete(db.userChats[user], chatID)
+		pointer, hasPointer := db.readPointers[chatID][user]
+		delete(db.readPointers[chatID], user)
+
+		return func() {
+			db.chatUsers[chatID] = prevUsers
+			db.userChats[user][chatID] = role
+			if hasPointer {
+				db.readPointers[chatID][user] = pointer
+			}
+		}, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c *memoryChatStorage) GetChatUserRole(ctx context.Context, chatID uuid.UUID, user uuid.UUID) (string, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	return c.db.userChats[user][chatID], nil
+}
+
+func (c *memoryChatStorage) SetChatUserRole(ctx context.Context, tx Tx, chatID uuid.UUID, user uuid.UUID, role string) (bool, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	var member bool
+	err = mtx.view(func(db *memoryDB) {
+		_, member = db.userChats[user][chatID]
+	})
+	if err != nil || !member {
+		return false, err
+	}
+
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		prevRole, ok := db.userChats[user][chatID]
+		if !ok {
+			return nil, xerrors.Errorf("User %s was removed from chat %s concurrently", user, chatID)
+		}
+		db.userChats[user][chatID] = role
+
+		return func() {
+			db.userChats[user][chatID] = prevRole
+		}, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c *memoryChatStorage) GetChatList(ctx context.Context, userId uuid.UUID, params ChatListParams) (ChatPage, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	prefix := strings.ToLower(params.NamePrefix)
+	chats := make([]*memChat, 0)
+	for chatID := range c.db.userChats[userId] {
+		chat := c.db.chats[chatID]
+		if !strings.HasPrefix(strings.ToLower(chat.Name), prefix) {
+			continue
+		}
+		if params.Page.Cursor != nil && !memLess(chat.activity(), chat.ID, params.Page.Cursor.Time, params.Page.Cursor.ID) {
+			continue
+		}
+		chats = append(chats, chat)
+	}
+
+	sort.Slice(chats, func(i, j int) bool {
+		return memLess(chats[j].activity(), chats[j].ID, chats[i].activity(), chats[i].ID)
+	})
+
+	page := ChatPage{Chats: make([]dto.Chat, 0, params.Page.Limit)}
+	if len(chats) > params.Page.Limit {
+		chats = chats[:params.Page.Limit]
+		page.Last = Cursor{Time: chats[len(chats)-1].activity(), ID: chats[len(chats)-1].ID}
+		page.HasMore = true
+	}
+
+	for _, chat := range chats {
+		result := c.toChat(chat, params.UsersLimit)
+		c.fillReadState(&result, userId)
+		page.Chats = append(page.Chats, result)
+	}
+
+	return page, nil
+}
+
+func (c *memoryChatStorage) GetChat(ctx context.Context, chatID uuid.UUID) (dto.Chat, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	chat, ok := c.db.chats[chatID]
+	if !ok {
+		return dto.Chat{}, nil
+	}
+
+	result := c.toChat(chat, 0)
+	result.Members = make([]dto.ChatMember, 0, len(result.Users))
+	for _, user := range result.Users {
+		result.Members = append(result.Members, dto.ChatMember{User: user, Role: c.db.userChats[user][chatID]})
+	}
+
+	return result, nil
+}
+
+// toChat собирает dto.Chat с последним сообщением, usersLimit как в fillChatUsers.
+// Вызывается под блокировкой db.mu
+func (c *memoryChatStorage) toChat(chat *memChat, usersLimit int) dto.Chat {
+	result := dto.Chat{ID: chat.ID, Name: chat.Name, Type: chat.Type, CreatedAt: epoch(chat.CreatedAt)}
+	if message, ok := c.db.messages[chat.LastMessageID]; ok {
+		result.LastMessage = memToMessage(message)
+		result.LastMessageAt = result.LastMessage.CreatedAt
+	}
+
+	users := c.db.chatUsers[chat.ID]
+	result.UsersCount = len(users)
+	switch {
+	case usersLimit == 0:
+		result.Users = append([]uuid.UUID(nil), users...)
+	case usersLimit > 0:
+		if len(users) > usersLimit {
+			users = users[:usersLimit]
+		}
+		result.Users = append([]uuid.UUID(nil), users...)
+	}
+
+	return result
+}
+
+// fillReadState повторяет chatStorage.fillReadState, вызывается под блокировкой db.mu
+func (c *memoryChatStorage) fillReadState(chat *dto.Chat, user uuid.UUID) {
+	messages := c.db.chatMessages[chat.ID]
+	pointer, ok := c.db.readPointers[chat.ID][user]
+
+	// скрытые пользователем сообщения не считаются непрочитанными
+	hidden := 0
+	for messageID := range c.db.hiddenMessages[user] {
+		message := c.db.messages[messageID]
+		if message != nil && message.Chat == chat.ID &&
+			(!ok || memLess(pointer.MessageAt, pointer.MessageID, message.CreatedAt, message.ID)) {
+			hidden++
+		}
+	}
+	read := 0
+	if ok {
+		read = sort.Search(len(messages), func(i int) bool {
+			return memLess(pointer.MessageAt, pointer.MessageID, messages[i].CreatedAt, messages[i].ID)
+		})
+		chat.LastReadMessageID = nullUUID(pointer.MessageID)
+	}
+	chat.UnreadCount = len(messages) - read - hidden
+	if chat.UnreadCount > maxUnreadCount {
+		chat.UnreadCount = maxUnreadCount
+	}
+}
+
+func (c *memoryChatStorage) MarkChatRead(ctx context.Context, tx Tx, chatID uuid.UUID, user uuid.UUID, messageID uuid.UUID) (bool, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	var message *memMessage
+	var member, hasPointer bool
+	var pointer memReadPointer
+	err = mtx.view(func(db *memoryDB) {
+		message = db.messages[messageID]
+		_, member = db.userChats[user][chatID]
+		pointer, hasPointer = db.readPointers[chatID][user]
+	})
+	if err != nil {
+		return false, err
+	}
+	if message == nil || message.Chat != chatID || !member {
+		return false, nil
+	}
+	if hasPointer && !memLess(pointer.MessageAt, pointer.MessageID, message.CreatedAt, message.ID) {
+		return false, nil
+	}
+
+	readAt := memNow()
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		if _, ok := db.userChats[user][chatID]; !ok {
+			return nil, xerrors.Errorf("User %s was removed from chat %s concurrently", user, chatID)
+		}
+		undo := memSetReadPointer(db, chatID, user, memReadPointer{MessageID: message.ID, MessageAt: message.CreatedAt, ReadAt: readAt})
+		if undo == nil {
+			return nil, xerrors.Errorf("Read pointer of user %s in chat %s was moved concurrently", user, chatID)
+		}
+		return undo, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c *memoryChatStorage) GetMessageReaders(ctx context.Context, messageID uuid.UUID) ([]dto.ReadReceipt, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	receipts := make([]dto.ReadReceipt, 0)
+	message, ok := c.db.messages[messageID]
+	if !ok {
+		return receipts, nil
+	}
+
+	pointers := make([]memReadPointer, 0)
+	users := make([]uuid.UUID, 0)
+	for user, pointer := range c.db.readPointers[message.Chat] {
+		if user == message.Author || memLess(pointer.MessageAt, pointer.MessageID, message.CreatedAt, message.ID) {
+			continue
+		}
+		pointers = append(pointers, pointer)
+		users = append(users, user)
+	}
+	order := make([]int, len(users))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return memLess(pointers[order[i]].ReadAt, users[order[i]], pointers[order[j]].ReadAt, users[order[j]])
+	})
+	for _, i := range order {
+		receipts = append(receipts, dto.ReadReceipt{User: users[i], ReadAt: epoch(pointers[i].ReadAt)})
+	}
+
+	return receipts, nil
+}
+
+func (c *memoryChatStorage) GetChatUsers(ctx context.Context, chat uuid.UUID) ([]uuid.UUID, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	return append(make([]uuid.UUID, 0), c.db.chatUsers[chat]...), nil
+}
+
+func (c *memoryChatStorage) CheckExistChat(ctx context.Context, chat uuid.UUID) (bool, error) {
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+
+	_, ok := c.db.chats[chat]
+	return ok, nil
+}
@@ -0,0 +1,758 @@
+package storage
+
+import (
+	"avito/dto"
+	"bytes"
+	"context"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type memoryMessageStorage struct {
+	db *memoryDB
+}
+
+func memToMessage(message *memMessage) *dto.Message {
+	result := &dto.Message{
+		ID:         message.ID,
+		Chat:       message.Chat,
+		Author:     message.Author,
+		Text:       message.Text,
+		CreatedAt:  epoch(message.CreatedAt),
+		Type:       message.Type,
+		Target:     nullUUID(message.Target),
+		Parent:     nullUUID(message.Parent),
+		ReplyCount: message.ReplyCount,
+	}
+	if !message.LastReplyAt.IsZero() {
+		result.LastReplyAt = epoch(message.LastReplyAt)
+	}
+	if !message.EditedAt.IsZero() {
+		result.EditedAt = epoch(message.EditedAt)
+	}
+	if !message.DeletedAt.IsZero() {
+		result.Text = ""
+		result.DeletedAt = epoch(message.DeletedAt)
+		result.DeletedBy = nullUUID(message.DeletedBy)
+	}
+	return result
+}
+
+func (m *memoryMessageStorage) CreateMessage(ctx context.Context, tx Tx, author uuid.UUID, chat uuid.UUID, parent uuid.UUID, text string) (dto.Message, error) {
+	message := &memMessage{ID: uuid.Must(uuid.NewUUID()), Chat: chat, Author: author, Text: text, Type: dto.MessageText, Parent: parent}
+	return m.insertMessage(tx, message)
+}
+
+func (m *memoryMessageStorage) CreateSystemMessage(ctx context.Context, tx Tx, author uuid.UUID, chat uuid.UUID, messageType string, target uuid.UUID, text string) (dto.Message, error) {
+	message := &memMessage{ID: uuid.Must(uuid.NewUUID()), Chat: chat, Author: author, Text: text, Type: messageType, Target: target}
+	return m.insertMessage(tx, message)
+}
+
+func (m *memoryMessageStorage) insertMessage(tx Tx, message *memMessage) (dto.Message, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	message.CreatedAt = memNow()
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		chatRow, ok := db.chats[message.Chat]
+		if !ok {
+			return nil, xerrors.Errorf("Chat %s is not exist", message.Chat)
+		}
+		if _, ok := db.users[message.Author]; !ok {
+			return nil, xerrors.Errorf("User %s is not exist", message.Author)
+		}
+		var root *memMessage
+		if message.Parent != uuid.Nil {
+			if root, ok = db.messages[message.Parent]; !ok {
+				return nil, xerrors.Errorf("Message %s is not exist", message.Parent)
+			}
+		}
+
+		// новое сообщение почти всегда последнее: добавление в конец не трогает первые len(prevMessages)
+		// элементов, и откат просто возвращает старый срез. Вставка в середину сдвигает элементы, поэтому на копии
+		prevMessages := db.chatMessages[message.Chat]
+		idx := sort.Search(len(prevMessages), func(i int) bool {
+			return memLess(message.CreatedAt, message.ID, prevMessages[i].CreatedAt, prevMessages[i].ID)
+		})
+		var messages []*memMessage
+		if idx == len(prevMessages) {
+			messages = append(prevMessages, message)
+		} else {
+			messages = make([]*memMessage, 0, len(prevMessages)+1)
+			messages = append(append(append(messages, prevMessages[:idx]...), message), prevMessages[idx:]...)
+		}
+
+		db.messages[message.ID] = message
+		db.chatMessages[message.Chat] = messages
+
+		prevLastID, prevLastAt := chatRow.LastMessageID, chatRow.LastMessageAt
+		if chatRow.LastMessageID == uuid.Nil || !message.CreatedAt.Before(chatRow.LastMessageAt) {
+			chatRow.LastMessageID, chatRow.LastMessageAt = message.ID, message.CreatedAt
+		}
+
+		// свое сообщение автор уже прочитал
+		undoRead := func() {}
+		if _, ok := db.userChats[message.Author][message.Chat]; ok {
+			pointer := memReadPointer{MessageID: message.ID, MessageAt: message.CreatedAt, ReadAt: message.CreatedAt}
+			if undo := memSetReadPointer(db, message.Chat, message.Author, pointer); undo != nil {
+				undoRead = undo
+			}
+		}
+
+		var prevLastReplyAt time.Time
+		if root != nil {
+			prevLastReplyAt = root.LastReplyAt
+			root.ReplyCount++
+			if message.CreatedAt.After(root.LastReplyAt) {
+				root.LastReplyAt = message.CreatedAt
+			}
+		}
+
+		return func() {
+			delete(db.messages, message.ID)
+			db.chatMessages[message.Chat] = prevMessages
+			chatRow.LastMessageID, chatRow.LastMessageAt = prevLastID, prevLastAt
+			undoRead()
+			if root != nil {
+				root.ReplyCount--
+				root.LastReplyAt = prevLastReplyAt
+			}
+		}, nil
+	})
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	return *memToMessage(message), nil
+}
+
+func (m *memoryMessageStorage) GetMessage(ctx context.Context, messageID uuid.UUID) (dto.Message, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	message, ok := m.db.messages[messageID]
+	if !ok {
+		return dto.Message{}, nil
+	}
+	return *memToMessage(message), nil
+}
+
+func (m *memoryMessageStorage) EditMessage(ctx context.Context, tx Tx, messageID uuid.UUID, text string) (dto.Message, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	var message *memMessage
+	var result dto.Message
+	var oldEditedAt time.Time
+	err = mtx.view(func(db *memoryDB) {
+		var ok bool
+		message, ok = db.messages[messageID]
+		if ok && message.DeletedAt.IsZero() {
+			result, oldEditedAt = *memToMessage(message), message.EditedAt
+		}
+	})
+	if err != nil || result.ID == uuid.Nil || result.Text == text {
+		return result, err
+	}
+
+	oldText := result.Text
+	editedAt := memNow()
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		if message.Text != oldText || !message.DeletedAt.IsZero() {
+			return nil, xerrors.Errorf("Message %s was edited concurrently", messageID)
+		}
+
+		prevRevisions := db.messageRevisions[messageID]
+		revision := dto.MessageRevision{Message: messageID, Text: oldText, EditedAt: epoch(editedAt)}
+		db.messageRevisions[messageID] = append(append([]dto.MessageRevision(nil), prevRevisions...), revision)
+		message.Text, message.EditedAt = text, editedAt
+
+		return func() {
+			message.Text, message.EditedAt = oldText, oldEditedAt
+			db.messageRevisions[messageID] = prevRevisions
+		}, nil
+	})
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	result.Text, result.EditedAt = text, epoch(editedAt)
+	return result, nil
+}
+
+func (m *memoryMessageStorage) GetMessageRevisions(ctx context.Context, messageID uuid.UUID) ([]dto.MessageRevision, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	return append(make([]dto.MessageRevision, 0), m.db.messageRevisions[messageID]...), nil
+}
+
+func (m *memoryMessageStorage) DeleteMessage(ctx context.Context, tx Tx, messageID uuid.UUID, deletedBy uuid.UUID) (dto.Message, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	var message *memMessage
+	var result dto.Message
+	err = mtx.view(func(db *memoryDB) {
+		var ok bool
+		if message, ok = db.messages[messageID]; ok {
+			result = *memToMessage(message)
+		}
+	})
+	if err != nil || result.ID == uuid.Nil || result.DeletedAt != 0 {
+		return result, err
+	}
+
+	deletedAt := memNow()
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		if !message.DeletedAt.IsZero() {
+			return nil, xerrors.Errorf("Message %s was deleted concurrently", messageID)
+		}
+		if _, ok := db.users[deletedBy]; !ok {
+			return nil, xerrors.Errorf("User %s is not exist", deletedBy)
+		}
+		message.DeletedAt, message.DeletedBy = deletedAt, deletedBy
+
+		return func() {
+			message.DeletedAt, message.DeletedBy = time.Time{}, uuid.Nil
+		}, nil
+	})
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	result.Text, result.DeletedAt, result.DeletedBy = "", epoch(deletedAt), nullUUID(deletedBy)
+	return result, nil
+}
+
+func (m *memoryMessageStorage) HideMessage(ctx context.Context, tx Tx, user uuid.UUID, messageID uuid.UUID) error {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return err
+	}
+
+	return mtx.add(func(db *memoryDB) (func(), error) {
+		if _, ok := db.messages[messageID]; !ok {
+			return nil, xerrors.Errorf("Message %s is not exist", messageID)
+		}
+		if _, ok := db.hiddenMessages[user][messageID]; ok {
+			return func() {}, nil
+		}
+		if db.hiddenMessages[user] == nil {
+			db.hiddenMessages[user] = make(map[uuid.UUID]struct{})
+		}
+		db.hiddenMessages[user][messageID] = struct{}{}
+
+		return func() {
+			delete(db.hiddenMessages[user], messageID)
+		}, nil
+	})
+}
+
+func (m *memoryMessageStorage) PurgeDeletedMessages(ctx context.Context, tx Tx, before time.Time) (int, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := make([]*memMessage, 0)
+	err = mtx.view(func(db *memoryDB) {
+		for _, message := range db.messages {
+			if !message.DeletedAt.IsZero() && message.DeletedAt.Before(before) && (message.Text != "" || len(db.messageRevisions[message.ID]) != 0) {
+				purged = append(purged, message)
+			}
+		}
+	})
+	if err != nil || len(purged) == 0 {
+		return 0, err
+	}
+
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		texts := make([]string, len(purged))
+		revisions := make([][]dto.MessageRevision, len(purged))
+		for i, message := range purged {
+			texts[i], revisions[i] = message.Text, db.messageRevisions[message.ID]
+			message.Text = ""
+			delete(db.messageRevisions, message.ID)
+		}
+
+		return func() {
+			for i, message := range purged {
+				message.Text = texts[i]
+				if revisions[i] != nil {
+					db.messageRevisions[message.ID] = revisions[i]
+				}
+			}
+		}, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(purged), nil
+}
+
+func (m *memoryMessageStorage) AddReaction(ctx context.Context, tx Tx, messageID uuid.UUID, user uuid.UUID, emoji string) (bool, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	err = mtx.view(func(db *memoryDB) {
+		exists = memHasReaction(db, messageID, user, emoji)
+	})
+	if err != nil || exists {
+		return false, err
+	}
+
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		if _, ok := db.messages[messageID]; !ok {
+			return nil, xerrors.Errorf("Message %s is not exist", messageID)
+		}
+		if _, ok := db.users[user]; !ok {
+			return nil, xerrors.Errorf("User %s is not exist", user)
+		}
+		if memHasReaction(db, messageID, user, emoji) {
+			return nil, xerrors.Errorf("Reaction %s of user %s to message %s already exists", emoji, user, messageID)
+		}
+		prev := db.messageReactions[messageID]
+		db.messageReactions[messageID] = append(prev[:len(prev):len(prev)], memReaction{User: user, Emoji: emoji})
+
+		return func() {
+			db.messageReactions[messageID] = prev
+		}, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (m *memoryMessageStorage) RemoveReaction(ctx context.Context, tx Tx, messageID uuid.UUID, user uuid.UUID, emoji string) (bool, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	err = mtx.view(func(db *memoryDB) {
+		exists = memHasReaction(db, messageID, user, emoji)
+	})
+	if err != nil || !exists {
+		return false, err
+	}
+
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		prev := db.messageReactions[messageID]
+		reactions := make([]memReaction, 0, len(prev))
+		for _, reaction := range prev {
+			if reaction.User != user || reaction.Emoji != emoji {
+				reactions = append(reactions, reaction)
+			}
+		}
+		if len(reactions) == len(prev) {
+			return nil, xerrors.Errorf("Reaction %s of user %s to message %s was removed concurrently", emoji, user, messageID)
+		}
+		db.messageReactions[messageID] = reactions
+
+		return func() {
+			db.messageReactions[messageID] = prev
+		}, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (m *memoryMessageStorage) GetReactions(ctx context.Context, messageIDs []uuid.UUID, viewer uuid.UUID) (map[uuid.UUID][]dto.Reaction, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	result := make(map[uuid.UUID][]dto.Reaction)
+	for _, messageID := range messageIDs {
+		if reactions := memReactions(m.db, messageID, viewer); reactions != nil {
+			result[messageID] = reactions
+		}
+	}
+
+	return result, nil
+}
+
+func (m *memoryMessageStorage) PinMessage(ctx context.Context, tx Tx, chat uuid.UUID, messageID uuid.UUID, pinnedBy uuid.UUID) (bool, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	err = mtx.view(func(db *memoryDB) {
+		_, exists = db.pinnedMessages[messageID]
+	})
+	if err != nil || exists {
+		return false, err
+	}
+
+	pin := memPin{Chat: chat, PinnedBy: pinnedBy, PinnedAt: time.Now()}
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		if _, ok := db.messages[messageID]; !ok {
+			return nil, xerrors.Errorf("Message %s is not exist", messageID)
+		}
+		if _, ok := db.pinnedMessages[messageID]; ok {
+			return nil, xerrors.Errorf("Message %s is already pinned", messageID)
+		}
+		db.pinnedMessages[messageID] = pin
+
+		return func() {
+			delete(db.pinnedMessages, messageID)
+		}, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (m *memoryMessageStorage) UnpinMessage(ctx context.Context, tx Tx, messageID uuid.UUID) (bool, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	err = mtx.view(func(db *memoryDB) {
+		_, exists = db.pinnedMessages[messageID]
+	})
+	if err != nil || !exists {
+		return false, err
+	}
+
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		pin, ok := db.pinnedMessages[messageID]
+		if !ok {
+			return nil, xerrors.Errorf("Message %s is not pinned", messageID)
+		}
+		delete(db.pinnedMessages, messageID)
+
+		return func() {
+			db.pinnedMessages[messageID] = pin
+		}, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (m *memoryMessageStorage) GetPinnedMessages(ctx context.Context, chat uuid.UUID, viewer uuid.UUID) ([]dto.PinnedMessage, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	type pinned struct {
+		id  uuid.UUID
+		pin memPin
+	}
+	hidden := m.db.hiddenMessages[viewer]
+	found := make([]pinned, 0)
+	for id, pin := range m.db.pinnedMessages {
+		if _, ok := hidden[id]; pin.Chat != chat || ok || !m.db.messages[id].DeletedAt.IsZero() {
+			continue
+		}
+		found = append(found, pinned{id: id, pin: pin})
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if !found[i].pin.PinnedAt.Equal(found[j].pin.PinnedAt) {
+			return found[i].pin.PinnedAt.After(found[j].pin.PinnedAt)
+		}
+		return bytes.Compare(found[i].id[:], found[j].id[:]) > 0
+	})
+
+	pins := make([]dto.PinnedMessage, len(found))
+	for i, p := range found {
+		pins[i] = dto.PinnedMessage{Message: *memToMessage(m.db.messages[p.id]), PinnedBy: p.pin.PinnedBy, PinnedAt: epoch(p.pin.PinnedAt)}
+	}
+
+	return pins, nil
+}
+
+func memHasReaction(db *memoryDB, messageID uuid.UUID, user uuid.UUID, emoji string) bool {
+	for _, reaction := range db.messageReactions[messageID] {
+		if reaction.User == user && reaction.Emoji == emoji {
+			return true
+		}
+	}
+	return false
+}
+
+// memReactions группирует реакции на сообщение по emoji в порядке первой реакции
+func memReactions(db *memoryDB, messageID uuid.UUID, viewer uuid.UUID) []dto.Reaction {
+	var result []dto.Reaction
+	index := make(map[string]int)
+	for _, reaction := range db.messageReactions[messageID] {
+		i, ok := index[reaction.Emoji]
+		if !ok {
+			i = len(result)
+			index[reaction.Emoji] = i
+			result = append(result, dto.Reaction{Emoji: reaction.Emoji})
+		}
+		result[i].Count++
+		if reaction.User == viewer {
+			result[i].Me = true
+		}
+	}
+	return result
+}
+
+func (m *memoryMessageStorage) GetMessageList(ctx context.Context, chat uuid.UUID, viewer uuid.UUID, listParams MessageListParams) (MessagePage, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	params := listParams.Page
+	all := m.db.chatMessages[chat]
+	// границы выборки в отсортированном списке: [from, to)
+	from, to := 0, len(all)
+	if params.Cursor != nil {
+		cursor := *params.Cursor
+		if params.Older {
+			to = sort.Search(len(all), func(i int) bool {
+				return !memLess(all[i].CreatedAt, all[i].ID, cursor.Time, cursor.ID)
+			})
+		} else {
+			from = sort.Search(len(all), func(i int) bool {
+				return memLess(cursor.Time, cursor.ID, all[i].CreatedAt, all[i].ID)
+			})
+		}
+	}
+
+	hidden := m.db.hiddenMessages[viewer]
+	visible := make([]*memMessage, 0, to-from)
+	for _, message := range all[from:to] {
+		if listParams.Parent != uuid.Nil && message.Parent != listParams.Parent {
+			continue
+		}
+		if listParams.Parent == uuid.Nil && listParams.RootsOnly && message.Parent != uuid.Nil {
+			continue
+		}
+		if _, ok := hidden[message.ID]; !ok {
+			visible = append(visible, message)
+		}
+	}
+
+	page := MessagePage{}
+	if len(visible) > params.Limit {
+		page.HasMore = true
+		if params.Older {
+			visible = visible[len(visible)-params.Limit:]
+		} else {
+			visible = visible[:params.Limit]
+		}
+	}
+
+	page.Messages = make([]dto.Message, 0, len(visible))
+	for _, message := range visible {
+		result := memToMessage(message)
+		if message.DeletedAt.IsZero() {
+			result.Reactions = memReactions(m.db, message.ID, viewer)
+		}
+		page.Messages = append(page.Messages, *result)
+	}
+	if len(visible) > 0 {
+		page.First = Cursor{Time: visible[0].CreatedAt, ID: visible[0].ID}
+		page.Last = Cursor{Time: visible[len(visible)-1].CreatedAt, ID: visible[len(visible)-1].ID}
+	}
+
+	return page, nil
+}
+
+// memSearchHit - найденное сообщение и его позиция в результатах поиска
+type memSearchHit struct {
+	result dto.SearchResult
+	cursor SearchCursor
+}
+
+// SearchMessages перебирает сообщения чатов пользователя. Релевантность - количество вхождений термов,
+// слова сравниваются без учета регистра и без морфологии
+func (m *memoryMessageStorage) SearchMessages(ctx context.Context, viewer uuid.UUID, params SearchParams) (SearchPage, error) {
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	hidden := m.db.hiddenMessages[viewer]
+	hits := make([]memSearchHit, 0)
+	for chat := range m.db.userChats[viewer] {
+		if params.Chat != uuid.Nil && chat != params.Chat {
+			continue
+		}
+		for _, message := range m.db.chatMessages[chat] {
+			if message.Type != dto.MessageText || !message.DeletedAt.IsZero() {
+				continue
+			}
+			if _, ok := hidden[message.ID]; ok {
+				continue
+			}
+			if params.Author != uuid.Nil && message.Author != params.Author {
+				continue
+			}
+			if (!params.From.IsZero() && message.CreatedAt.Before(params.From)) || (!params.To.IsZero() && !message.CreatedAt.Before(params.To)) {
+				continue
+			}
+
+			tokens := memTokenize(message.Text)
+			matched := make([]bool, len(tokens))
+			rank := 0
+			for _, term := range params.Terms {
+				count := memMatchTerm(tokens, term, matched)
+				if count == 0 {
+					rank = 0
+					break
+				}
+				rank += count
+			}
+			if rank == 0 {
+				continue
+			}
+
+			cursor := SearchCursor{Rank: float64(rank), Cursor: Cursor{Time: message.CreatedAt, ID: message.ID}}
+			if params.Cursor != nil && !memSearchBefore(*params.Cursor, cursor, params.ByRelevance) {
+				continue
+			}
+			hits = append(hits, memSearchHit{
+				result: dto.SearchResult{Message: *memToMessage(message), Snippet: memSnippet(message.Text, tokens, matched), Rank: cursor.Rank},
+				cursor: cursor,
+			})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return memSearchBefore(hits[i].cursor, hits[j].cursor, params.ByRelevance)
+	})
+
+	results := make([]dto.SearchResult, 0, len(hits))
+	cursors := make([]SearchCursor, 0, len(hits))
+	for _, hit := range hits {
+		results = append(results, hit.result)
+		cursors = append(cursors, hit.cursor)
+	}
+
+	return makeSearchPage(results, cursors, params), nil
+}
+
+// memSearchBefore - порядок результатов поиска: по убыванию релевантности (если сортировка по ней), времени и id
+func memSearchBefore(a SearchCursor, b SearchCursor, byRelevance bool) bool {
+	if byRelevance && a.Rank != b.Rank {
+		return a.Rank > b.Rank
+	}
+	return memLess(b.Time, b.ID, a.Time, a.ID)
+}
+
+// memToken - слово текста в нижнем регистре и его границы в исходной строке
+type memToken struct {
+	Word  string
+	Start int
+	End   int
+}
+
+// memTokenize разбивает текст на слова из букв и цифр, остальные символы - разделители
+func memTokenize(text string) []memToken {
+	tokens := make([]memToken, 0)
+	start := -1
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, memToken{Word: strings.ToLower(text[start:i]), Start: start, End: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, memToken{Word: strings.ToLower(text[start:]), Start: start, End: len(text)})
+	}
+
+	return tokens
+}
+
+// memMatchTerm отмечает в matched слова всех вхождений терма и возвращает количество вхождений
+func memMatchTerm(tokens []memToken, term SearchTerm, matched []bool) int {
+	count := 0
+	for i := 0; i+len(term.Words) <= len(tokens); i++ {
+		found := true
+		for j, word := range term.Words {
+			if term.Prefix && j == len(term.Words)-1 {
+				found = strings.HasPrefix(tokens[i+j].Word, word)
+			} else {
+				found = tokens[i+j].Word == word
+			}
+			if !found {
+				break
+			}
+		}
+		if found {
+			count++
+			for j := range term.Words {
+				matched[i+j] = true
+			}
+		}
+	}
+
+	return count
+}
+
+// memSnippet возвращает до searchSnippetWords слов, начиная незадолго до первого совпадения,
+// и выделяет совпавшие слова так же, как ts_headline
+func memSnippet(text string, tokens []memToken, matched []bool) string {
+	first := 0
+	for first < len(matched) && !matched[first] {
+		first++
+	}
+	from := first - searchSnippetWords/4
+	if from < 0 {
+		from = 0
+	}
+	to := from + searchSnippetWords
+	if to > len(tokens) {
+		to = len(tokens)
+	}
+
+	var b strings.Builder
+	pos, end := 0, len(text)
+	if from > 0 {
+		b.WriteString("…")
+		pos = tokens[from].Start
+	}
+	if to < len(tokens) {
+		end = tokens[to-1].End
+	}
+	for i := from; i < to; i++ {
+		if !matched[i] {
+			continue
+		}
+		b.WriteString(text[pos:tokens[i].Start])
+		b.WriteString(searchHighlightStart)
+		b.WriteString(text[tokens[i].Start:tokens[i].End])
+		b.WriteString(searchHighlightStop)
+		pos = tokens[i].End
+	}
+	b.WriteString(text[pos:end])
+	if to < len(tokens) {
+		b.WriteString("…")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"sort"
+	"time"
+)
+
+type memorySessionStorage struct {
+	db *memoryDB
+}
+
+func (s *memorySessionStorage) CreateSession(ctx context.Context, tx Tx, session Session) error {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return err
+	}
+
+	return mtx.add(func(db *memoryDB) (func(), error) {
+		if _, ok := db.users[session.UserID]; !ok {
+			return nil, xerrors.Errorf("User %s is not exist", session.UserID)
+		}
+		if _, ok := db.refreshTokens[session.RefreshTokenHash]; ok {
+			return nil, xerrors.Errorf("Duplicate refresh token hash")
+		}
+		db.sessions[session.ID] = &session
+		db.refreshTokens[session.RefreshTokenHash] = session.ID
+
+		return func() {
+			delete(db.sessions, session.ID)
+			delete(db.refreshTokens, session.RefreshTokenHash)
+		}, nil
+	})
+}
+
+func (s *memorySessionStorage) GetSessionByRefreshToken(ctx context.Context, refreshTokenHash string) (Session, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	session, ok := s.db.sessions[s.db.refreshTokens[refreshTokenHash]]
+	if !ok {
+		return Session{}, nil
+	}
+
+	return *session, nil
+}
+
+// canRotate и canRevoke проверяют условия update из postgres: при вызове для результата
+// и повторно при коммите, когда изменение применяется
+func canRotate(db *memoryDB, sessionID uuid.UUID, oldHash string) bool {
+	session, ok := db.sessions[sessionID]
+	return ok && session.RefreshTokenHash == oldHash && session.RevokedAt == nil
+}
+
+func canRevoke(db *memoryDB, userID uuid.UUID, sessionID uuid.UUID) bool {
+	session, ok := db.sessions[sessionID]
+	return ok && session.UserID == userID && session.RevokedAt == nil
+}
+
+func (s *memorySessionStorage) RotateRefreshToken(ctx context.Context, tx Tx, sessionID uuid.UUID, oldHash string, newHash string, expiresAt time.Time) (bool, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	var ok bool
+	err = mtx.view(func(db *memoryDB) {
+		ok = canRotate(db, sessionID, oldHash)
+	})
+	if err != nil || !ok {
+		return false, err
+	}
+
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		if !canRotate(db, sessionID, oldHash) {
+			return nil, xerrors.Errorf("Session %s was changed concurrently", sessionID)
+		}
+		if _, ok := db.refreshTokens[newHash]; ok {
+			return nil, xerrors.Errorf("Duplicate refresh token hash")
+		}
+
+		session := db.sessions[sessionID]
+		prevExpiresAt := session.ExpiresAt
+		session.RefreshTokenHash, session.ExpiresAt = newHash, expiresAt
+		delete(db.refreshTokens, oldHash)
+		db.refreshTokens[newHash] = sessionID
+
+		return func() {
+			session.RefreshTokenHash, session.ExpiresAt = oldHash, prevExpiresAt
+			delete(db.refreshTokens, newHash)
+			db.refreshTokens[oldHash] = sessionID
+		}, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *memorySessionStorage) GetUserSessions(ctx context.Context, userID uuid.UUID, now time.Time) ([]Session, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	sessions := make([]Session, 0)
+	for _, session := range s.db.sessions {
+		if session.UserID == userID && session.RevokedAt == nil && session.ExpiresAt.After(now) {
+			sessions = append(sessions, *session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return memLess(sessions[j].CreatedAt, sessions[j].ID, sessions[i].CreatedAt, sessions[i].ID)
+	})
+
+	return sessions, nil
+}
+
+func (s *memorySessionStorage) RevokeSession(ctx context.Context, tx Tx, userID uuid.UUID, sessionID uuid.UUID, now time.Time) (bool, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	var ok bool
+	err = mtx.view(func(db *memoryDB) {
+		ok = canRevoke(db, userID, sessionID)
+	})
+	if err != nil || !ok {
+		return false, err
+	}
+
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		if !canRevoke(db, userID, sessionID) {
+			return nil, xerrors.Errorf("Session %s was changed concurrently", sessionID)
+		}
+
+		session := db.sessions[sessionID]
+		revokedAt := now
+		session.RevokedAt = &revokedAt
+		removed := make(map[string]Token)
+		for hash, token := range db.tokens {
+			if token.SessionID == sessionID {
+				removed[hash] = token
+				delete(db.tokens, hash)
+			}
+		}
+
+		return func() {
+			session.RevokedAt = nil
+			for hash, token := range removed {
+				db.tokens[hash] = token
+			}
+		}, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
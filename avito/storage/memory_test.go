@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"avito/dto"
+	"context"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"testing"
+)
+
+func newTestMemoryStorage(t *testing.T) (*memoryStorageAPI, uuid.UUID, uuid.UUID) {
+	t.Helper()
+	api := NewMemoryStorageAPI().(*memoryStorageAPI)
+	ctx := context.Background()
+
+	var user, chat uuid.UUID
+	err := api.RunInTx(ctx, func(tx Tx) error {
+		var err error
+		user, err = api.GetUserStorage().CreateUser(ctx, tx, "alice", "")
+		if err != nil {
+			return err
+		}
+		created, err := api.GetChatStorage().CreateChat(ctx, tx, "general")
+		if err != nil {
+			return err
+		}
+		chat = created.ID
+		return api.GetChatStorage().CreateRecordChatsUsers(ctx, tx, chat, dto.RoleOwner, user)
+	})
+	if err != nil {
+		t.Fatalf("Cannot prepare storage: %+v", err)
+	}
+
+	return api, user, chat
+}
+
+func TestMemTxCommit(t *testing.T) {
+	api := NewMemoryStorageAPI()
+	ctx := context.Background()
+
+	err := api.RunInTx(ctx, func(tx Tx) error {
+		if _, err := api.GetUserStorage().CreateUser(ctx, tx, "alice", ""); err != nil {
+			return err
+		}
+		// до коммита изменения не видны
+		exist, err := api.GetUserStorage().IsUserExist(ctx, "alice")
+		if err != nil {
+			return err
+		}
+		if exist {
+			t.Errorf("User is visible before commit")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunInTx: %+v", err)
+	}
+
+	exist, err := api.GetUserStorage().IsUserExist(ctx, "alice")
+	if err != nil {
+		t.Fatalf("IsUserExist: %+v", err)
+	}
+	if !exist {
+		t.Errorf("User is not visible after commit")
+	}
+}
+
+func TestMemTxRollback(t *testing.T) {
+	api := NewMemoryStorageAPI()
+	ctx := context.Background()
+
+	errAbort := xerrors.New("abort")
+	err := api.RunInTx(ctx, func(tx Tx) error {
+		if _, err := api.GetUserStorage().CreateUser(ctx, tx, "alice", ""); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !xerrors.Is(err, errAbort) {
+		t.Fatalf("RunInTx returned %v, expected %v", err, errAbort)
+	}
+
+	exist, err := api.GetUserStorage().IsUserExist(ctx, "alice")
+	if err != nil {
+		t.Fatalf("IsUserExist: %+v", err)
+	}
+	if exist {
+		t.Errorf("User is created by rolled back transaction")
+	}
+}
+
+func TestMemTxFailedOpUndoesAppliedOps(t *testing.T) {
+	api, user, chat := newTestMemoryStorage(t)
+	ctx := context.Background()
+
+	// ошибки операций проявляются только при коммите, когда часть операций уже применена
+	err := api.RunInTx(ctx, func(tx Tx) error {
+		if _, err := api.GetUserStorage().CreateUser(ctx, tx, "bob", ""); err != nil {
+			return err
+		}
+		if _, err := api.GetMessageStorage().CreateMessage(ctx, tx, user, chat, uuid.Nil, "hello"); err != nil {
+			return err
+		}
+		if _, err := api.GetChatStorage().RenameChat(ctx, tx, chat, "renamed", user); err != nil {
+			return err
+		}
+		_, err := api.GetUserStorage().CreateUser(ctx, tx, "alice", "")
+		return err
+	})
+	if !xerrors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("Commit with duplicate username returned %v, expected %v", err, ErrUsernameTaken)
+	}
+
+	exist, err := api.GetUserStorage().IsUserExist(ctx, "bob")
+	if err != nil {
+		t.Fatalf("IsUserExist: %+v", err)
+	}
+	if exist {
+		t.Errorf("User created before failed op is not undone")
+	}
+	if messages := api.db.chatMessages[chat]; len(messages) != 0 {
+		t.Errorf("Message created before failed op is not undone: %d messages", len(messages))
+	}
+	if row := api.db.chats[chat]; row.Name != "general" || row.LastMessageID != uuid.Nil {
+		t.Errorf("Chat is not restored: name %s, last message %s", row.Name, row.LastMessageID)
+	}
+}
+
+func TestMemInsertMessageKeepsOrder(t *testing.T) {
+	api, user, chat := newTestMemoryStorage(t)
+	ctx := context.Background()
+
+	send := func(tx Tx, text string) {
+		if _, err := api.GetMessageStorage().CreateMessage(ctx, tx, user, chat, uuid.Nil, text); err != nil {
+			t.Fatalf("CreateMessage: %+v", err)
+		}
+	}
+	commit := func(tx *memTx) {
+		if err := tx.commit(); err != nil {
+			t.Fatalf("Commit: %+v", err)
+		}
+	}
+	texts := func() []string {
+		result := make([]string, 0)
+		for _, message := range api.db.chatMessages[chat] {
+			result = append(result, message.Text)
+		}
+		return result
+	}
+
+	// время сообщения фиксируется при вызове, а вставка происходит при коммите:
+	// second коммитится после third и встает в середину
+	first, second, third := &memTx{db: api.db}, &memTx{db: api.db}, &memTx{db: api.db}
+	send(first, "first")
+	send(second, "second")
+	send(third, "third")
+	commit(first)
+	commit(third)
+	commit(second)
+	checkTexts(t, texts(), "first", "second", "third")
+
+	// вставка в середину откатывается вместе с остальными операциями транзакции
+	middle, last := &memTx{db: api.db}, &memTx{db: api.db}
+	send(middle, "middle")
+	send(last, "last")
+	commit(last)
+	if err := middle.add(func(db *memoryDB) (func(), error) {
+		return nil, xerrors.New("fail")
+	}); err != nil {
+		t.Fatalf("Add op: %+v", err)
+	}
+	if err := middle.commit(); err == nil {
+		t.Fatalf("Commit with failing op succeeded")
+	}
+	checkTexts(t, texts(), "first", "second", "third", "last")
+}
+
+func checkTexts(t *testing.T, actual []string, expected ...string) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("Messages %v, expected %v", actual, expected)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("Messages %v, expected %v", actual, expected)
+		}
+	}
+}
+
+func TestMemTxSeesOwnChanges(t *testing.T) {
+	api, user, chat := newTestMemoryStorage(t)
+	ctx := context.Background()
+	messages := api.GetMessageStorage()
+
+	var message dto.Message
+	err := api.RunInTx(ctx, func(tx Tx) error {
+		var err error
+		message, err = messages.CreateMessage(ctx, tx, user, chat, uuid.Nil, "hello")
+		if err != nil {
+			return err
+		}
+
+		// операции транзакции видят ее предыдущие изменения
+		if added, err := messages.AddReaction(ctx, tx, message.ID, user, "👍"); err != nil || !added {
+			t.Errorf("First AddReaction returned %v, %v", added, err)
+		}
+		if added, err := messages.AddReaction(ctx, tx, message.ID, user, "👍"); err != nil || added {
+			t.Errorf("Repeated AddReaction returned %v, %v", added, err)
+		}
+		edited, err := messages.EditMessage(ctx, tx, message.ID, "hello again")
+		if err != nil || edited.Text != "hello again" {
+			t.Errorf("EditMessage returned %s, %v", edited.Text, err)
+		}
+		if edited, err := messages.EditMessage(ctx, tx, message.ID, "hello again"); err != nil || edited.EditedAt == 0 {
+			t.Errorf("EditMessage with the same text returned %v, %v", edited, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunInTx: %+v", err)
+	}
+
+	reactions, err := messages.GetReactions(ctx, []uuid.UUID{message.ID}, user)
+	if err != nil {
+		t.Fatalf("GetReactions: %+v", err)
+	}
+	if got := reactions[message.ID]; len(got) != 1 || got[0].Count != 1 || !got[0].Me {
+		t.Errorf("Unexpected reactions %v", got)
+	}
+	revisions, err := messages.GetMessageRevisions(ctx, message.ID)
+	if err != nil {
+		t.Fatalf("GetMessageRevisions: %+v", err)
+	}
+	if len(revisions) != 1 || revisions[0].Text != "hello" {
+		t.Errorf("Unexpected revisions %v", revisions)
+	}
+}
+
+func TestMemTxConcurrentAddReaction(t *testing.T) {
+	api, user, chat := newTestMemoryStorage(t)
+	ctx := context.Background()
+	messages := api.GetMessageStorage()
+
+	var message dto.Message
+	err := api.RunInTx(ctx, func(tx Tx) error {
+		var err error
+		message, err = messages.CreateMessage(ctx, tx, user, chat, uuid.Nil, "hello")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("RunInTx: %+v", err)
+	}
+
+	// как в postgres, реакцию добавляет ровно один из одновременных запросов, остальные ничего не меняют
+	const workers = 8
+	results := make(chan bool, workers)
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			var added bool
+			errs <- api.RunInTx(ctx, func(tx Tx) error {
+				var err error
+				added, err = messages.AddReaction(ctx, tx, message.ID, user, "👍")
+				return err
+			})
+			results <- added
+		}()
+	}
+
+	addedCount := 0
+	for i := 0; i < workers; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("AddReaction: %+v", err)
+		}
+		if <-results {
+			addedCount++
+		}
+	}
+	if addedCount != 1 {
+		t.Errorf("Reaction is added %d times", addedCount)
+	}
+}
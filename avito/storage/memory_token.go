@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"time"
+)
+
+type memoryTokenStorage struct {
+	db *memoryDB
+}
+
+func (t *memoryTokenStorage) CreateToken(ctx context.Context, tx Tx, token Token) error {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return err
+	}
+
+	return mtx.add(func(db *memoryDB) (func(), error) {
+		if _, ok := db.users[token.UserID]; !ok {
+			return nil, xerrors.Errorf("User %s is not exist", token.UserID)
+		}
+		if _, ok := db.tokens[token.Hash]; ok {
+			return nil, xerrors.Errorf("Duplicate token hash")
+		}
+		db.tokens[token.Hash] = token
+
+		return func() {
+			delete(db.tokens, token.Hash)
+		}, nil
+	})
+}
+
+func (t *memoryTokenStorage) GetToken(ctx context.Context, tokenHash string) (Token, error) {
+	t.db.mu.RLock()
+	defer t.db.mu.RUnlock()
+
+	return t.db.tokens[tokenHash], nil
+}
+
+func (t *memoryTokenStorage) DeleteExpiredTokens(ctx context.Context, tx Tx, sessionID uuid.UUID, now time.Time) error {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return err
+	}
+
+	return mtx.add(func(db *memoryDB) (func(), error) {
+		removed := make(map[string]Token)
+		for hash, token := range db.tokens {
+			if token.SessionID == sessionID && token.ExpiresAt != nil && !token.ExpiresAt.After(now) {
+				removed[hash] = token
+				delete(db.tokens, hash)
+			}
+		}
+
+		return func() {
+			for hash, token := range removed {
+				db.tokens[hash] = token
+			}
+		}, nil
+	})
+}
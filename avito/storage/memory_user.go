@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"avito/dto"
+	"context"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"sort"
+	"strings"
+)
+
+type memoryUserStorage struct {
+	db *memoryDB
+}
+
+func (u *memoryUserStorage) IsUserExist(ctx context.Context, username string) (bool, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	_, ok := u.db.usernames[username]
+	return ok, nil
+}
+
+func (u *memoryUserStorage) CreateUser(ctx context.Context, tx Tx, username string, passwordHash string) (uuid.UUID, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	user := &memUser{ID: uuid.Must(uuid.NewUUID()), Username: username, PasswordHash: passwordHash, CreatedAt: memNow()}
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		if _, ok := db.usernames[user.Username]; ok {
+			return nil, ErrUsernameTaken
+		}
+		db.users[user.ID] = user
+		db.usernames[user.Username] = user.ID
+
+		return func() {
+			delete(db.users, user.ID)
+			delete(db.usernames, user.Username)
+		}, nil
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return user.ID, nil
+}
+
+func (u *memoryUserStorage) GetUserCredentials(ctx context.Context, username string) (uuid.UUID, string, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	user, ok := u.db.users[u.db.usernames[username]]
+	if !ok {
+		return uuid.Nil, "", nil
+	}
+
+	return user.ID, user.PasswordHash, nil
+}
+
+func (u *memoryUserStorage) CheckExistUsers(ctx context.Context, ids ...uuid.UUID) (bool, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	// как и в postgres, повторяющиеся id считаются несуществующими пользователями
+	found := make(map[uuid.UUID]struct{}, len(ids))
+	for _, id := range ids {
+		if _, ok := u.db.users[id]; ok {
+			found[id] = struct{}{}
+		}
+	}
+
+	return len(found) == len(ids), nil
+}
+
+func memToUser(user *memUser) dto.User {
+	return dto.User{
+		ID:          user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarURL,
+		CreatedAt:   epoch(user.CreatedAt),
+	}
+}
+
+func (u *memoryUserStorage) GetUsers(ctx context.Context, ids []uuid.UUID) ([]dto.User, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	users := make([]dto.User, 0, len(ids))
+	found := make(map[uuid.UUID]struct{}, len(ids))
+	for _, id := range ids {
+		user, ok := u.db.users[id]
+		if _, dup := found[id]; !ok || dup {
+			continue
+		}
+		found[id] = struct{}{}
+		users = append(users, memToUser(user))
+	}
+
+	return users, nil
+}
+
+func (u *memoryUserStorage) GetUserByUsername(ctx context.Context, username string) (dto.User, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	user, ok := u.db.users[u.db.usernames[username]]
+	if !ok {
+		return dto.User{}, nil
+	}
+
+	return memToUser(user), nil
+}
+
+func (u *memoryUserStorage) SearchUsers(ctx context.Context, params UserSearchParams) (UserPage, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	prefix := strings.ToLower(params.Prefix)
+	found := make([]*memUser, 0)
+	for username, id := range u.db.usernames {
+		if !strings.HasPrefix(strings.ToLower(username), prefix) {
+			continue
+		}
+		if len(params.After) != 0 && !memUsernameLess(params.After, username) {
+			continue
+		}
+		found = append(found, u.db.users[id])
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return memUsernameLess(found[i].Username, found[j].Username)
+	})
+
+	users := make([]dto.User, 0, len(found))
+	for _, user := range found {
+		users = append(users, memToUser(user))
+	}
+
+	return makeUserPage(users, params.Limit), nil
+}
+
+// memUsernameLess - порядок имен в поиске: в нижнем регистре, затем с учетом регистра, как collate "C" в postgres
+func memUsernameLess(a string, b string) bool {
+	if la, lb := strings.ToLower(a), strings.ToLower(b); la != lb {
+		return la < lb
+	}
+	return a < b
+}
+
+func (u *memoryUserStorage) UpdateProfile(ctx context.Context, tx Tx, userID uuid.UUID, displayName *string, avatarURL *string) (dto.User, error) {
+	mtx, err := asMemTx(tx)
+	if err != nil {
+		return dto.User{}, err
+	}
+
+	var updated memUser
+	var ok bool
+	err = mtx.view(func(db *memoryDB) {
+		var user *memUser
+		if user, ok = db.users[userID]; ok {
+			updated = *user
+		}
+	})
+	if err != nil || !ok {
+		return dto.User{}, err
+	}
+
+	if displayName != nil {
+		updated.DisplayName = *displayName
+	}
+	if avatarURL != nil {
+		updated.AvatarURL = *avatarURL
+	}
+	err = mtx.add(func(db *memoryDB) (func(), error) {
+		user, ok := db.users[userID]
+		if !ok {
+			return nil, xerrors.Errorf("User %s was removed concurrently", userID)
+		}
+		prevName, prevAvatar := user.DisplayName, user.AvatarURL
+		if displayName != nil {
+			user.DisplayName = *displayName
+		}
+		if avatarURL != nil {
+			user.AvatarURL = *avatarURL
+		}
+
+		return func() {
+			user.DisplayName, user.AvatarURL = prevName, prevAvatar
+		}, nil
+	})
+	if err != nil {
+		return dto.User{}, err
+	}
+
+	return memToUser(&updated), nil
+}
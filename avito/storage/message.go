@@ -1,73 +1,635 @@
 package storage
 
 import (
-	"../dto"
-	"../db"
+	"avito/dto"
+	"avito/db"
 	"context"
+	"fmt"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/xerrors"
+	"strings"
+	"time"
 )
 
 type MessageStorageAPI interface {
-	CreateMessage(tx pgx.Tx, author uuid.UUID, chat uuid.UUID, text string) (uuid.UUID, error)
-	CheckExistUserChats(author uuid.UUID, chat uuid.UUID) (bool, error)
-	GetMessageList(chat uuid.UUID) ([]dto.Message, error)
+	// CreateMessage записывает сообщение пользователя, parent - корень треда для ответа или uuid.Nil.
+	// У корня в той же транзакции обновляются счетчик и время последнего ответа
+	CreateMessage(ctx context.Context, tx Tx, author uuid.UUID, chat uuid.UUID, parent uuid.UUID, text string) (dto.Message, error)
+	// CreateSystemMessage записывает в чат системное сообщение вида messageType о действии author над target,
+	// target равен uuid.Nil, если действие не касается участника
+	CreateSystemMessage(ctx context.Context, tx Tx, author uuid.UUID, chat uuid.UUID, messageType string, target uuid.UUID, text string) (dto.Message, error)
+	// GetMessageList не возвращает сообщения, скрытые пользователем viewer, реакции заполняются для viewer
+	GetMessageList(ctx context.Context, chat uuid.UUID, viewer uuid.UUID, params MessageListParams) (MessagePage, error)
+	// GetMessage возвращает сообщение, ID равен uuid.Nil, если сообщения нет
+	GetMessage(ctx context.Context, message uuid.UUID) (dto.Message, error)
+	// EditMessage заменяет текст сообщения и сохраняет прежний в истории правок. ID в ответе равен uuid.Nil,
+	// если сообщения нет или оно удалено. Если текст не изменился, сообщение возвращается без правки
+	EditMessage(ctx context.Context, tx Tx, message uuid.UUID, text string) (dto.Message, error)
+	GetMessageRevisions(ctx context.Context, message uuid.UUID) ([]dto.MessageRevision, error)
+	// DeleteMessage помечает сообщение удаленным для всех, текст остается в базе до PurgeDeletedMessages.
+	// ID в ответе равен uuid.Nil, если сообщения нет, уже удаленное сообщение возвращается без изменений
+	DeleteMessage(ctx context.Context, tx Tx, message uuid.UUID, deletedBy uuid.UUID) (dto.Message, error)
+	// HideMessage скрывает сообщение только у пользователя user, повторный вызов ничего не меняет
+	HideMessage(ctx context.Context, tx Tx, user uuid.UUID, message uuid.UUID) error
+	// PurgeDeletedMessages стирает текст и историю правок сообщений, удаленных раньше before,
+	// и возвращает количество очищенных сообщений
+	PurgeDeletedMessages(ctx context.Context, tx Tx, before time.Time) (int, error)
+	// AddReaction и RemoveReaction возвращают false, если реакция уже была или ее не было
+	AddReaction(ctx context.Context, tx Tx, message uuid.UUID, user uuid.UUID, emoji string) (bool, error)
+	RemoveReaction(ctx context.Context, tx Tx, message uuid.UUID, user uuid.UUID, emoji string) (bool, error)
+	// PinMessage и UnpinMessage возвращают false, если сообщение уже закреплено или не было закреплено
+	PinMessage(ctx context.Context, tx Tx, chat uuid.UUID, message uuid.UUID, pinnedBy uuid.UUID) (bool, error)
+	UnpinMessage(ctx context.Context, tx Tx, message uuid.UUID) (bool, error)
+	// GetPinnedMessages возвращает закрепленные сообщения чата от последних закрепленных к ранним,
+	// без удаленных и скрытых пользователем viewer
+	GetPinnedMessages(ctx context.Context, chat uuid.UUID, viewer uuid.UUID) ([]dto.PinnedMessage, error)
+	// GetReactions возвращает реакции сообщений в порядке первой реакции каждым emoji,
+	// Me отмечает реакции пользователя viewer
+	GetReactions(ctx context.Context, messages []uuid.UUID, viewer uuid.UUID) (map[uuid.UUID][]dto.Reaction, error)
+	// SearchMessages ищет обычные сообщения в чатах, где состоит viewer, без удаленных и скрытых им
+	SearchMessages(ctx context.Context, viewer uuid.UUID, params SearchParams) (SearchPage, error)
+}
+
+// messageColumns - поля сообщения в порядке сканирования, у удаленного сообщения текст не выбирается
+const messageColumns = `id, chat, author, case when deleted_at is null then text else '' end, type, target, 
+created_at, edited_at, deleted_at, deleted_by, parent, reply_count, last_reply_at`
+
+// MessageListParams - параметры выборки сообщений чата. Если Parent задан, выбираются только ответы
+// в его треде, иначе RootsOnly исключает ответы из выборки
+type MessageListParams struct {
+	Page      PageParams
+	Parent    uuid.UUID
+	RootsOnly bool
+}
+
+// SearchTerm - слово или фраза поискового запроса, слова в нижнем регистре и состоят только из букв и цифр.
+// Prefix - последнее слово ищется как начало слова
+type SearchTerm struct {
+	Words  []string
+	Prefix bool
+}
+
+// SearchParams - параметры поиска, в тексте должны встретиться все Terms. Фильтр не задан,
+// если Chat и Author равны uuid.Nil, а From и To - нулевые. To не входит в интервал
+type SearchParams struct {
+	Terms       []SearchTerm
+	Chat        uuid.UUID
+	Author      uuid.UUID
+	From        time.Time
+	To          time.Time
+	ByRelevance bool
+	Cursor      *SearchCursor
+	Limit       int
+}
+
+// SearchPage - найденные сообщения по убыванию релевантности или времени, Last - курсор последнего из них
+type SearchPage struct {
+	Results []dto.SearchResult
+	Last    SearchCursor
+	HasMore bool
+}
+
+// выделение совпадений во фрагменте текста и примерная длина фрагмента в словах
+const (
+	searchHighlightStart = "<mark>"
+	searchHighlightStop  = "</mark>"
+	searchSnippetWords   = 20
+)
+
+// pgSearchConfig - конфигурация текстового поиска Postgres, та же, что у колонки text_tsv
+const pgSearchConfig = "russian"
+
+// MessagePage - страница сообщений, отсортированная от раннего к позднему.
+// HasMore показывает, есть ли еще сообщения в направлении выборки
+type MessagePage struct {
+	Messages []dto.Message
+	First    Cursor
+	Last     Cursor
+	HasMore  bool
 }
 
 type messageStorage struct {
 	db db.ConnDB
-	ctx context.Context
 }
 
-func NewMessageStorageAPI(connDB db.ConnDB, ctx context.Context) MessageStorageAPI {
+func NewMessageStorageAPI(connDB db.ConnDB) MessageStorageAPI {
 	return &messageStorage{
 		db: connDB,
-		ctx: ctx,
 	}
 }
 
-func (m *messageStorage) GetMessageList(chat uuid.UUID) ([]dto.Message, error) {
-	rows, err := m.db.DB.Query(context.Background(), `select id, chat, author, text, extract(epoch from created_at) as created_at from messages where chat=$1 order by created_at asc`, chat)
+func (m *messageStorage) GetMessageList(ctx context.Context, chat uuid.UUID, viewer uuid.UUID, params MessageListParams) (MessagePage, error) {
+	// выборка идет по индексу (chat, created_at, id) или (parent, created_at, id) для треда,
+	// для более ранних сообщений - в обратном порядке
+	compare, order := ">", "asc"
+	if params.Page.Older {
+		compare, order = "<", "desc"
+	}
+
+	args := []interface{}{chat, params.Page.Limit + 1, viewer}
+	conditions := make([]string, 0, 2)
+	if params.Parent != uuid.Nil {
+		args = append(args, params.Parent)
+		conditions = append(conditions, fmt.Sprintf("and parent=$%d", len(args)))
+	} else if params.RootsOnly {
+		conditions = append(conditions, "and parent is null")
+	}
+	if params.Page.Cursor != nil {
+		args = append(args, params.Page.Cursor.pgTime(), params.Page.Cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("and (created_at, id) %s ($%d::timestamp, $%d::uuid)", compare, len(args)-1, len(args)))
+	}
+
+	rows, err := m.db.DB.Query(ctx, fmt.Sprintf(`select %s from messages 
+where chat=$1 %s and not exists (select 1 from hidden_messages h where h.message_id = messages.id and h.user_id = $3) 
+order by created_at %s, id %s limit $2`, messageColumns, strings.Join(conditions, " "), order, order), args...)
+	if err != nil {
+		return MessagePage{}, err
+	}
 	defer rows.Close()
 
+	messages := make([]dto.Message, 0, params.Page.Limit+1)
+	cursors := make([]Cursor, 0, params.Page.Limit+1)
+	for rows.Next() {
+		message, createdAt, err := scanPgMessage(rows)
+		if err != nil {
+			return MessagePage{}, err
+		}
+		messages = append(messages, message)
+		cursors = append(cursors, Cursor{Time: createdAt, ID: message.ID})
+	}
+	if err := rows.Err(); err != nil {
+		return MessagePage{}, err
+	}
+
+	page := makeMessagePage(messages, cursors, params.Page)
+	if err := fillMessageReactions(ctx, m, page.Messages, viewer); err != nil {
+		return MessagePage{}, err
+	}
+
+	return page, nil
+}
+
+func (m *messageStorage) GetMessage(ctx context.Context, messageID uuid.UUID) (dto.Message, error) {
+	message, _, err := scanPgMessage(m.db.DB.QueryRow(ctx, fmt.Sprintf(`select %s from messages where id=$1`, messageColumns), messageID))
+	if xerrors.Is(err, pgx.ErrNoRows) {
+		return dto.Message{}, nil
+	}
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	return message, nil
+}
+
+func scanPgMessage(row rowScanner) (dto.Message, time.Time, error) {
+	var message dto.Message
+	var createdAt time.Time
+	var editedAt, deletedAt, lastReplyAt *time.Time
+	err := row.Scan(&message.ID, &message.Chat, &message.Author, &message.Text, &message.Type, &message.Target,
+		&createdAt, &editedAt, &deletedAt, &message.DeletedBy, &message.Parent, &message.ReplyCount, &lastReplyAt)
+	if err != nil {
+		return dto.Message{}, time.Time{}, err
+	}
+	message.CreatedAt = epoch(createdAt)
+	message.EditedAt = nullEpoch(editedAt)
+	message.DeletedAt = nullEpoch(deletedAt)
+	message.LastReplyAt = nullEpoch(lastReplyAt)
+
+	return message, createdAt, nil
+}
+
+func (m *messageStorage) EditMessage(ctx context.Context, tx Tx, messageID uuid.UUID, text string) (dto.Message, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	message, _, err := scanPgMessage(ptx.QueryRow(ctx, fmt.Sprintf(`select %s from messages where id=$1 and deleted_at is null for update`,
+		messageColumns), messageID))
+	if xerrors.Is(err, pgx.ErrNoRows) {
+		return dto.Message{}, nil
+	}
+	if err != nil {
+		return dto.Message{}, err
+	}
+	if message.Text == text {
+		return message, nil
+	}
+
+	// время правки в истории и в сообщении совпадает: CURRENT_TIMESTAMP - время начала транзакции
+	_, err = ptx.Exec(ctx, `insert into message_revisions (id, message_id, text) values ($1, $2, $3)`,
+		uuid.Must(uuid.NewUUID()), messageID, message.Text)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	var updatedAt time.Time
+	err = ptx.QueryRow(ctx, `update messages set text=$2, edited_at=CURRENT_TIMESTAMP where id=$1 returning edited_at`,
+		messageID, text).Scan(&updatedAt)
+	if err != nil {
+		return dto.Message{}, err
+	}
+	message.Text = text
+	message.EditedAt = epoch(updatedAt)
+
+	return message, nil
+}
+
+func (m *messageStorage) GetMessageRevisions(ctx context.Context, messageID uuid.UUID) ([]dto.MessageRevision, error) {
+	rows, err := m.db.DB.Query(ctx, `select text, edited_at from message_revisions where message_id=$1 order by edited_at, id`, messageID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	messages := make([]dto.Message, 0)
+	revisions := make([]dto.MessageRevision, 0)
 	for rows.Next() {
-		var message dto.Message
-		err := rows.Scan(&message.ID, &message.Chat, &message.Author, &message.Text, &message.CreatedAt)
-		if err != nil {
+		revision := dto.MessageRevision{Message: messageID}
+		var editedAt time.Time
+		if err := rows.Scan(&revision.Text, &editedAt); err != nil {
 			return nil, err
 		}
-		messages = append(messages, message)
+		revision.EditedAt = epoch(editedAt)
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (m *messageStorage) DeleteMessage(ctx context.Context, tx Tx, messageID uuid.UUID, deletedBy uuid.UUID) (dto.Message, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	_, err = ptx.Exec(ctx, `update messages set deleted_at=CURRENT_TIMESTAMP, deleted_by=$2 where id=$1 and deleted_at is null`,
+		messageID, deletedBy)
+	if err != nil {
+		return dto.Message{}, err
 	}
 
-	return messages, nil
+	message, _, err := scanPgMessage(ptx.QueryRow(ctx, fmt.Sprintf(`select %s from messages where id=$1`, messageColumns), messageID))
+	if xerrors.Is(err, pgx.ErrNoRows) {
+		return dto.Message{}, nil
+	}
+	if err != nil {
+		return dto.Message{}, err
+	}
 
+	return message, nil
 }
 
-func (m *messageStorage) CreateMessage(tx pgx.Tx, author uuid.UUID, chat uuid.UUID, text string) (uuid.UUID, error) {
-	messageID := uuid.Must(uuid.NewUUID())
-	if _, err := tx.Exec(context.Background(), `insert into messages (id, chat, author, text) values ($1, $2, $3, $4)`,
-		messageID, chat, author, text); err != nil {
-		return uuid.Nil, err
+func (m *messageStorage) HideMessage(ctx context.Context, tx Tx, user uuid.UUID, messageID uuid.UUID) error {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return err
 	}
 
-	return messageID, nil
+	_, err = ptx.Exec(ctx, `insert into hidden_messages (user_id, message_id) values ($1, $2) on conflict do nothing`, user, messageID)
+	return err
 }
 
-func (m *messageStorage) CheckExistUserChats(author uuid.UUID, chat uuid.UUID) (bool, error) {
-	var result int
-	err := m.db.DB.QueryRow(context.Background(), `select count(*) from chats_users where user_id=$1 and chat_id=$2`, author, chat).Scan(&result)
+func (m *messageStorage) PurgeDeletedMessages(ctx context.Context, tx Tx, before time.Time) (int, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = ptx.Exec(ctx, `delete from message_revisions 
+where message_id in (select id from messages where deleted_at < $1::timestamp)`, pgTimestamp(before))
+	if err != nil {
+		return 0, err
+	}
+
+	tag, err := ptx.Exec(ctx, `update messages set text='' where deleted_at < $1::timestamp and text <> ''`, pgTimestamp(before))
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+func (m *messageStorage) AddReaction(ctx context.Context, tx Tx, messageID uuid.UUID, user uuid.UUID, emoji string) (bool, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := ptx.Exec(ctx, `insert into message_reactions (message_id, user_id, emoji) values ($1, $2, $3) on conflict do nothing`,
+		messageID, user, emoji)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() != 0, nil
+}
+
+func (m *messageStorage) RemoveReaction(ctx context.Context, tx Tx, messageID uuid.UUID, user uuid.UUID, emoji string) (bool, error) {
+	ptx, err := asPgTx(tx)
 	if err != nil {
 		return false, err
 	}
 
-	if result != 1 {
-		return false, nil
+	tag, err := ptx.Exec(ctx, `delete from message_reactions where message_id=$1 and user_id=$2 and emoji=$3`, messageID, user, emoji)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() != 0, nil
+}
+
+func (m *messageStorage) PinMessage(ctx context.Context, tx Tx, chat uuid.UUID, messageID uuid.UUID, pinnedBy uuid.UUID) (bool, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := ptx.Exec(ctx, `insert into pinned_messages (message_id, chat_id, pinned_by) values ($1, $2, $3) on conflict do nothing`,
+		messageID, chat, pinnedBy)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() != 0, nil
+}
+
+func (m *messageStorage) UnpinMessage(ctx context.Context, tx Tx, messageID uuid.UUID) (bool, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := ptx.Exec(ctx, `delete from pinned_messages where message_id=$1`, messageID)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() != 0, nil
+}
+
+func (m *messageStorage) GetPinnedMessages(ctx context.Context, chat uuid.UUID, viewer uuid.UUID) ([]dto.PinnedMessage, error) {
+	rows, err := m.db.DB.Query(ctx, fmt.Sprintf(`select %s, p.pinned_by, p.pinned_at from pinned_messages p 
+join messages on messages.id = p.message_id 
+where p.chat_id=$1 and deleted_at is null 
+and not exists (select 1 from hidden_messages h where h.message_id = messages.id and h.user_id = $2) 
+order by p.pinned_at desc, p.message_id desc`, messageColumns), chat, viewer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pins := make([]dto.PinnedMessage, 0)
+	for rows.Next() {
+		var pin dto.PinnedMessage
+		var pinnedAt time.Time
+		pin.Message, _, err = scanPgMessage(extraScanner{row: rows, extra: []interface{}{&pin.PinnedBy, &pinnedAt}})
+		if err != nil {
+			return nil, err
+		}
+		pin.PinnedAt = epoch(pinnedAt)
+		pins = append(pins, pin)
+	}
+
+	return pins, rows.Err()
+}
+
+func (m *messageStorage) GetReactions(ctx context.Context, messageIDs []uuid.UUID, viewer uuid.UUID) (map[uuid.UUID][]dto.Reaction, error) {
+	result := make(map[uuid.UUID][]dto.Reaction)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	paramsString, parsedIDs := makeParamsFromUUID(messageIDs)
+	rows, err := m.db.DB.Query(ctx, fmt.Sprintf(`select message_id, emoji, count(*), bool_or(user_id = $%d) from message_reactions 
+where message_id in (%s) group by message_id, emoji order by min(created_at), emoji`, len(parsedIDs)+1, paramsString),
+		append(parsedIDs, viewer)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID uuid.UUID
+		var reaction dto.Reaction
+		if err := rows.Scan(&messageID, &reaction.Emoji, &reaction.Count, &reaction.Me); err != nil {
+			return nil, err
+		}
+		result[messageID] = append(result[messageID], reaction)
+	}
+
+	return result, rows.Err()
+}
+
+// fillMessageReactions заполняет реакции сообщений страницы, у удаленных сообщений реакции не показываются
+func fillMessageReactions(ctx context.Context, storage MessageStorageAPI, messages []dto.Message, viewer uuid.UUID) error {
+	messageIDs := make([]uuid.UUID, 0, len(messages))
+	for _, message := range messages {
+		if message.DeletedAt == 0 {
+			messageIDs = append(messageIDs, message.ID)
+		}
+	}
+
+	reactions, err := storage.GetReactions(ctx, messageIDs, viewer)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Reactions = reactions[messages[i].ID]
+	}
+
+	return nil
+}
+
+func (m *messageStorage) SearchMessages(ctx context.Context, viewer uuid.UUID, params SearchParams) (SearchPage, error) {
+	args := []interface{}{viewer, params.Limit + 1,
+		fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=%d, MinWords=%d, MaxFragments=2, FragmentDelimiter=\" … \"",
+			searchHighlightStart, searchHighlightStop, searchSnippetWords, searchSnippetWords/4)}
+	queries := make([]string, 0, len(params.Terms))
+	for _, term := range params.Terms {
+		queries = append(queries, pgTermQuery(term, &args))
+	}
+
+	conditions := make([]string, 0, 5)
+	if params.Chat != uuid.Nil {
+		args = append(args, params.Chat)
+		conditions = append(conditions, fmt.Sprintf("and chat=$%d", len(args)))
+	}
+	if params.Author != uuid.Nil {
+		args = append(args, params.Author)
+		conditions = append(conditions, fmt.Sprintf("and author=$%d", len(args)))
+	}
+	if !params.From.IsZero() {
+		args = append(args, pgTimestamp(params.From))
+		conditions = append(conditions, fmt.Sprintf("and created_at >= $%d::timestamp", len(args)))
+	}
+	if !params.To.IsZero() {
+		args = append(args, pgTimestamp(params.To))
+		conditions = append(conditions, fmt.Sprintf("and created_at < $%d::timestamp", len(args)))
+	}
+	rank, order := "ts_rank(text_tsv, q.query)::float8", "created_at desc, id desc"
+	if params.ByRelevance {
+		order = "search_rank desc, " + order
+	}
+	if params.Cursor != nil {
+		args = append(args, params.Cursor.pgTime(), params.Cursor.ID)
+		if params.ByRelevance {
+			args = append(args, params.Cursor.Rank)
+			conditions = append(conditions, fmt.Sprintf("and (%s, created_at, id) < ($%d::float8, $%d::timestamp, $%d::uuid)",
+				rank, len(args), len(args)-2, len(args)-1))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("and (created_at, id) < ($%d::timestamp, $%d::uuid)", len(args)-1, len(args)))
+		}
+	}
+
+	// индекс по text_tsv отбирает совпадения, фрагменты строятся только для строк страницы
+	rows, err := m.db.DB.Query(ctx, fmt.Sprintf(`with q as (select %s as query)
+select %s, %s as search_rank, ts_headline('%s', text, q.query, $3) from messages, q 
+where text_tsv @@ q.query and deleted_at is null and type = '%s' 
+and chat in (select chat_id from chats_users where user_id = $1) 
+and not exists (select 1 from hidden_messages h where h.message_id = messages.id and h.user_id = $1) %s 
+order by %s limit $2`, strings.Join(queries, " && "), messageColumns, rank, pgSearchConfig, dto.MessageText,
+		strings.Join(conditions, " "), order), args...)
+	if err != nil {
+		return SearchPage{}, err
+	}
+	defer rows.Close()
+
+	results := make([]dto.SearchResult, 0, params.Limit+1)
+	cursors := make([]SearchCursor, 0, params.Limit+1)
+	for rows.Next() {
+		var result dto.SearchResult
+		message, createdAt, err := scanPgMessage(extraScanner{row: rows, extra: []interface{}{&result.Rank, &result.Snippet}})
+		if err != nil {
+			return SearchPage{}, err
+		}
+		result.Message = message
+		results = append(results, result)
+		cursors = append(cursors, SearchCursor{Rank: result.Rank, Cursor: Cursor{Time: createdAt, ID: message.ID}})
+	}
+	if err := rows.Err(); err != nil {
+		return SearchPage{}, err
+	}
+
+	return makeSearchPage(results, cursors, params), nil
+}
+
+// pgTermQuery добавляет слова терма в args и возвращает выражение tsquery:
+// фраза из слов, у префиксного терма последнее слово ищется как начало слова
+func pgTermQuery(term SearchTerm, args *[]interface{}) string {
+	words, prefix := term.Words, ""
+	if term.Prefix {
+		*args = append(*args, words[len(words)-1])
+		prefix = fmt.Sprintf("to_tsquery('%s', $%d::text || ':*')", pgSearchConfig, len(*args))
+		words = words[:len(words)-1]
+		if len(words) == 0 {
+			return prefix
+		}
+	}
+
+	*args = append(*args, strings.Join(words, " "))
+	phrase := fmt.Sprintf("phraseto_tsquery('%s', $%d)", pgSearchConfig, len(*args))
+	if len(prefix) == 0 {
+		return phrase
+	}
+	return fmt.Sprintf("(%s <-> %s)", phrase, prefix)
+}
+
+// makeSearchPage обрезает лишнюю запись, по которой определяется, есть ли следующая страница.
+// При поиске по времени релевантность в ответе и курсоре не возвращается
+func makeSearchPage(results []dto.SearchResult, cursors []SearchCursor, params SearchParams) SearchPage {
+	page := SearchPage{Results: results}
+	if len(results) > params.Limit {
+		page.HasMore = true
+		page.Results = results[:params.Limit]
+		cursors = cursors[:params.Limit]
+	}
+	if !params.ByRelevance {
+		for i := range page.Results {
+			page.Results[i].Rank = 0
+			cursors[i].Rank = 0
+		}
+	}
+	if len(cursors) > 0 {
+		page.Last = cursors[len(cursors)-1]
+	}
+
+	return page
+}
+
+func makeMessagePage(messages []dto.Message, cursors []Cursor, params PageParams) MessagePage {
+	page := MessagePage{Messages: messages}
+	if len(messages) > params.Limit {
+		page.HasMore = true
+		page.Messages = messages[:params.Limit]
+		cursors = cursors[:params.Limit]
+	}
+
+	if params.Older {
+		for i, j := 0, len(page.Messages)-1; i < j; i, j = i+1, j-1 {
+			page.Messages[i], page.Messages[j] = page.Messages[j], page.Messages[i]
+			cursors[i], cursors[j] = cursors[j], cursors[i]
+		}
+	}
+
+	if len(cursors) > 0 {
+		page.First = cursors[0]
+		page.Last = cursors[len(cursors)-1]
+	}
+
+	return page
+}
+
+func (m *messageStorage) CreateMessage(ctx context.Context, tx Tx, author uuid.UUID, chat uuid.UUID, parent uuid.UUID, text string) (dto.Message, error) {
+	message := dto.Message{ID: uuid.Must(uuid.NewUUID()), Chat: chat, Author: author, Text: text, Type: dto.MessageText, Parent: nullUUID(parent)}
+	return m.insertMessage(ctx, tx, message)
+}
+
+func (m *messageStorage) CreateSystemMessage(ctx context.Context, tx Tx, author uuid.UUID, chat uuid.UUID, messageType string, target uuid.UUID, text string) (dto.Message, error) {
+	message := dto.Message{ID: uuid.Must(uuid.NewUUID()), Chat: chat, Author: author, Text: text, Type: messageType, Target: nullUUID(target)}
+	return m.insertMessage(ctx, tx, message)
+}
+
+func (m *messageStorage) insertMessage(ctx context.Context, tx Tx, message dto.Message) (dto.Message, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	chat := message.Chat
+	var createdAt time.Time
+	err = ptx.QueryRow(ctx, `insert into messages (id, chat, author, text, type, target, parent) values ($1, $2, $3, $4, $5, $6, $7) 
+returning created_at`, message.ID, chat, message.Author, message.Text, message.Type, message.Target, message.Parent).Scan(&createdAt)
+	if err != nil {
+		return dto.Message{}, err
+	}
+	message.CreatedAt = epoch(createdAt)
+
+	if message.Parent != nil {
+		// greatest пропускает null, поэтому первый ответ просто записывает свое время
+		_, err = ptx.Exec(ctx, `update messages set reply_count=reply_count+1, last_reply_at=greatest(last_reply_at, $2::timestamp) 
+where id=$1`, *message.Parent, pgTimestamp(createdAt))
+		if err != nil {
+			return dto.Message{}, err
+		}
+	}
+
+	// последнее сообщение чата обновляется в той же транзакции, условие защищает
+	// от перезаписи более поздним по времени, но раньше закоммиченным сообщением
+	_, err = ptx.Exec(ctx, `update chats set last_message_id=$1, last_message_at=$2::timestamp 
+where id=$3 and (last_message_at is null or last_message_at <= $2::timestamp)`,
+		message.ID, createdAt.UTC().Format(pgTimestampLayout), chat)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	// свое сообщение автор уже прочитал
+	_, err = ptx.Exec(ctx, `update chats_users set last_read_message_id=$1, last_read_message_at=$2::timestamp, read_at=$2::timestamp 
+where chat_id=$3 and user_id=$4 and (last_read_message_at is null or (last_read_message_at, last_read_message_id) < ($2::timestamp, $1))`,
+		message.ID, pgTimestamp(createdAt), chat, message.Author)
+	if err != nil {
+		return dto.Message{}, err
 	}
 
-	return true, nil
+	return message, nil
 }
@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"avito/dto"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMessageListPagination(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, api StorageAPI) {
+		ctx := context.Background()
+		alice, err := createTestUser(ctx, api, "alice")
+		if err != nil {
+			t.Fatalf("CreateUser: %+v", err)
+		}
+		chat := createTestChat(t, api, "general", alice)
+		createTestMessages(t, api, chat, alice, "m0", "m1", "m2", "m3", "m4", "m5", "m6")
+
+		getPage := func(cursor *Cursor, older bool) MessagePage {
+			t.Helper()
+			page, err := api.GetMessageStorage().GetMessageList(ctx, chat, alice, MessageListParams{Page: PageParams{Cursor: cursor, Older: older, Limit: 3}})
+			if err != nil {
+				t.Fatalf("GetMessageList: %+v", err)
+			}
+			return page
+		}
+		texts := func(page MessagePage) []string {
+			result := make([]string, 0, len(page.Messages))
+			for _, message := range page.Messages {
+				result = append(result, message.Text)
+			}
+			return result
+		}
+
+		// вперед от начала истории
+		first := getPage(nil, false)
+		checkTexts(t, texts(first), "m0", "m1", "m2")
+		second := getPage(&first.Last, false)
+		checkTexts(t, texts(second), "m3", "m4", "m5")
+		last := getPage(&second.Last, false)
+		checkTexts(t, texts(last), "m6")
+		if !first.HasMore || !second.HasMore || last.HasMore {
+			t.Errorf("Unexpected HasMore %t, %t, %t", first.HasMore, second.HasMore, last.HasMore)
+		}
+
+		// назад от курсора страницы сообщения идут в том же порядке, от ранних к поздним
+		back := getPage(&last.First, true)
+		checkTexts(t, texts(back), "m3", "m4", "m5")
+		start := getPage(&back.First, true)
+		checkTexts(t, texts(start), "m0", "m1", "m2")
+		if !back.HasMore || start.HasMore {
+			t.Errorf("Unexpected HasMore %t, %t", back.HasMore, start.HasMore)
+		}
+
+		// без курсора в сторону ранних - последние сообщения
+		checkTexts(t, texts(getPage(nil, true)), "m4", "m5", "m6")
+	})
+}
+
+func TestMessageListSkipsHiddenMessages(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, api StorageAPI) {
+		ctx := context.Background()
+		alice, err := createTestUser(ctx, api, "alice")
+		if err != nil {
+			t.Fatalf("CreateUser: %+v", err)
+		}
+		bob, err := createTestUser(ctx, api, "bob")
+		if err != nil {
+			t.Fatalf("CreateUser: %+v", err)
+		}
+		chat := createTestChat(t, api, "general", alice, bob)
+		ids := createTestMessages(t, api, chat, alice, "m0", "m1", "m2", "m3")
+		err = api.RunInTx(ctx, func(tx Tx) error {
+			return api.GetMessageStorage().HideMessage(ctx, tx, bob, ids[1])
+		})
+		if err != nil {
+			t.Fatalf("HideMessage: %+v", err)
+		}
+
+		// скрытые сообщения не занимают места на странице
+		page, err := api.GetMessageStorage().GetMessageList(ctx, chat, bob, MessageListParams{Page: PageParams{Limit: 3}})
+		if err != nil {
+			t.Fatalf("GetMessageList: %+v", err)
+		}
+		if len(page.Messages) != 3 || page.HasMore || page.Messages[1].ID != ids[2] {
+			t.Errorf("Unexpected page %v, HasMore %t", page.Messages, page.HasMore)
+		}
+		page, err = api.GetMessageStorage().GetMessageList(ctx, chat, alice, MessageListParams{Page: PageParams{Limit: 3}})
+		if err != nil {
+			t.Fatalf("GetMessageList: %+v", err)
+		}
+		if len(page.Messages) != 3 || !page.HasMore || page.Messages[1].ID != ids[1] {
+			t.Errorf("Hidden message is hidden from other member: %v", page.Messages)
+		}
+	})
+}
+
+func TestPurgeDeletedMessages(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, api StorageAPI) {
+		ctx := context.Background()
+		alice, err := createTestUser(ctx, api, "alice")
+		if err != nil {
+			t.Fatalf("CreateUser: %+v", err)
+		}
+		chat := createTestChat(t, api, "general", alice)
+		ids := createTestMessages(t, api, chat, alice, "deleted", "kept")
+
+		err = api.RunInTx(ctx, func(tx Tx) error {
+			if _, err := api.GetMessageStorage().EditMessage(ctx, tx, ids[0], "deleted after edit"); err != nil {
+				return err
+			}
+			deleted, err := api.GetMessageStorage().DeleteMessage(ctx, tx, ids[0], alice)
+			if err == nil && (deleted.DeletedAt == 0 || deleted.Text != "") {
+				t.Errorf("Unexpected deleted message %s", deleted)
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Cannot delete message: %+v", err)
+		}
+
+		purge := func(before time.Time) int {
+			t.Helper()
+			var purged int
+			err := api.RunInTx(ctx, func(tx Tx) error {
+				var err error
+				purged, err = api.GetMessageStorage().PurgeDeletedMessages(ctx, tx, before)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("PurgeDeletedMessages: %+v", err)
+			}
+			return purged
+		}
+		// сообщения, удаленные позже срока, не стираются
+		if purged := purge(time.Now().Add(-time.Hour)); purged != 0 {
+			t.Errorf("Purged %d messages deleted after retention", purged)
+		}
+		if purged := purge(time.Now().Add(time.Second)); purged != 1 {
+			t.Errorf("Purged %d messages, expected 1", purged)
+		}
+		if purged := purge(time.Now().Add(time.Second)); purged != 0 {
+			t.Errorf("Repeated purge erased %d messages", purged)
+		}
+
+		revisions, err := api.GetMessageStorage().GetMessageRevisions(ctx, ids[0])
+		if err != nil {
+			t.Fatalf("GetMessageRevisions: %+v", err)
+		}
+		if len(revisions) != 0 {
+			t.Errorf("Revisions of purged message are kept: %v", revisions)
+		}
+		kept, err := api.GetMessageStorage().GetMessage(ctx, ids[1])
+		if err != nil {
+			t.Fatalf("GetMessage: %+v", err)
+		}
+		if kept.Text != "kept" || kept.DeletedAt != 0 {
+			t.Errorf("Not deleted message is changed: %s", kept)
+		}
+	})
+}
+
+func TestSearchMessagesRanking(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, api StorageAPI) {
+		ctx := context.Background()
+		alice, err := createTestUser(ctx, api, "alice")
+		if err != nil {
+			t.Fatalf("CreateUser: %+v", err)
+		}
+		bob, err := createTestUser(ctx, api, "bob")
+		if err != nil {
+			t.Fatalf("CreateUser: %+v", err)
+		}
+		chat := createTestChat(t, api, "general", alice, bob)
+		other := createTestChat(t, api, "other", bob)
+		createTestMessages(t, api, chat, bob, "one cat", "three cat cat cat", "two cat cat", "dog", "catalog")
+		// сообщения чужого чата не находятся
+		createTestMessages(t, api, other, bob, "cat cat cat cat cat")
+
+		search := func(params SearchParams) SearchPage {
+			t.Helper()
+			page, err := api.GetMessageStorage().SearchMessages(ctx, alice, params)
+			if err != nil {
+				t.Fatalf("SearchMessages: %+v", err)
+			}
+			return page
+		}
+		texts := func(results []dto.SearchResult) []string {
+			result := make([]string, 0, len(results))
+			for _, found := range results {
+				result = append(result, found.Message.Text)
+			}
+			return result
+		}
+		cat := []SearchTerm{{Words: []string{"cat"}}}
+
+		// в SQLite и в памяти релевантность - число совпадений в сообщении, без нее - от новых к старым
+		page := search(SearchParams{Terms: cat, ByRelevance: true, Limit: 10})
+		checkTexts(t, texts(page.Results), "three cat cat cat", "two cat cat", "one cat")
+		for i := 1; i < len(page.Results); i++ {
+			if page.Results[i-1].Rank <= page.Results[i].Rank {
+				t.Errorf("Rank %f of %s is not greater than %f", page.Results[i-1].Rank, page.Results[i-1].Message.Text, page.Results[i].Rank)
+			}
+		}
+		checkTexts(t, texts(search(SearchParams{Terms: cat, Limit: 10}).Results), "two cat cat", "three cat cat cat", "one cat")
+		checkTexts(t, texts(search(SearchParams{Terms: []SearchTerm{{Words: []string{"cat"}, Prefix: true}}, Limit: 10}).Results),
+			"catalog", "two cat cat", "three cat cat cat", "one cat")
+
+		// курсор не пропускает и не повторяет результаты, даже если между страницами появилось
+		// более релевантное сообщение
+		first := search(SearchParams{Terms: cat, ByRelevance: true, Limit: 2})
+		checkTexts(t, texts(first.Results), "three cat cat cat", "two cat cat")
+		if !first.HasMore {
+			t.Errorf("First page has no more results")
+		}
+		createTestMessages(t, api, chat, bob, "four cat cat cat cat")
+		second := search(SearchParams{Terms: cat, ByRelevance: true, Cursor: &first.Last, Limit: 2})
+		checkTexts(t, texts(second.Results), "one cat")
+		if second.HasMore {
+			t.Errorf("Last page has more results")
+		}
+	})
+}
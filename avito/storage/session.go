@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"avito/db"
+	"context"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/xerrors"
+	"time"
+)
+
+// Session - сессия входа по паролю. Refresh token сессии меняется при каждом обновлении access-токена
+type Session struct {
+	ID               uuid.UUID
+	UserID           uuid.UUID
+	RefreshTokenHash string
+	CreatedAt        time.Time
+	ExpiresAt        time.Time
+	RevokedAt        *time.Time
+}
+
+type SessionStorageAPI interface {
+	CreateSession(ctx context.Context, tx Tx, session Session) error
+	// GetSessionByRefreshToken возвращает сессию с ID uuid.Nil, если токен не найден
+	GetSessionByRefreshToken(ctx context.Context, refreshTokenHash string) (Session, error)
+	// RotateRefreshToken заменяет refresh token сессии, только если он не изменился с момента чтения,
+	// поэтому один refresh token нельзя использовать дважды
+	RotateRefreshToken(ctx context.Context, tx Tx, sessionID uuid.UUID, oldHash string, newHash string, expiresAt time.Time) (bool, error)
+	// GetUserSessions возвращает действующие на момент now сессии пользователя, начиная с последней
+	GetUserSessions(ctx context.Context, userID uuid.UUID, now time.Time) ([]Session, error)
+	// RevokeSession отзывает сессию пользователя и удаляет выданные в ней access-токены
+	RevokeSession(ctx context.Context, tx Tx, userID uuid.UUID, sessionID uuid.UUID, now time.Time) (bool, error)
+}
+
+type sessionStorage struct {
+	db db.ConnDB
+}
+
+func NewSessionStorageAPI(connDB db.ConnDB) SessionStorageAPI {
+	return &sessionStorage{
+		db: connDB,
+	}
+}
+
+func (s *sessionStorage) CreateSession(ctx context.Context, tx Tx, session Session) error {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = ptx.Exec(ctx, `insert into sessions (id, user_id, refresh_token_hash, created_at, expires_at) 
+values ($1, $2, $3, $4::timestamp, $5::timestamp)`,
+		session.ID, session.UserID, session.RefreshTokenHash, pgTimestamp(session.CreatedAt), pgTimestamp(session.ExpiresAt))
+	return err
+}
+
+func (s *sessionStorage) GetSessionByRefreshToken(ctx context.Context, refreshTokenHash string) (Session, error) {
+	var session Session
+	err := s.db.DB.QueryRow(ctx, `select id, user_id, refresh_token_hash, created_at, expires_at, revoked_at 
+from sessions where refresh_token_hash=$1`, refreshTokenHash).
+		Scan(&session.ID, &session.UserID, &session.RefreshTokenHash, &session.CreatedAt, &session.ExpiresAt, &session.RevokedAt)
+	if xerrors.Is(err, pgx.ErrNoRows) {
+		return Session{}, nil
+	}
+	if err != nil {
+		return Session{}, err
+	}
+
+	return session, nil
+}
+
+func (s *sessionStorage) RotateRefreshToken(ctx context.Context, tx Tx, sessionID uuid.UUID, oldHash string, newHash string, expiresAt time.Time) (bool, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := ptx.Exec(ctx, `update sessions set refresh_token_hash=$1, expires_at=$2::timestamp 
+where id=$3 and refresh_token_hash=$4 and revoked_at is null`, newHash, pgTimestamp(expiresAt), sessionID, oldHash)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (s *sessionStorage) GetUserSessions(ctx context.Context, userID uuid.UUID, now time.Time) ([]Session, error) {
+	rows, err := s.db.DB.Query(ctx, `select id, user_id, refresh_token_hash, created_at, expires_at, revoked_at from sessions 
+where user_id=$1 and revoked_at is null and expires_at > $2::timestamp order by created_at desc, id desc`, userID, pgTimestamp(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.RefreshTokenHash, &session.CreatedAt, &session.ExpiresAt, &session.RevokedAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (s *sessionStorage) RevokeSession(ctx context.Context, tx Tx, userID uuid.UUID, sessionID uuid.UUID, now time.Time) (bool, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := ptx.Exec(ctx, `update sessions set revoked_at=$1::timestamp where id=$2 and user_id=$3 and revoked_at is null`,
+		pgTimestamp(now), sessionID, userID)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() != 1 {
+		return false, nil
+	}
+
+	if _, err := ptx.Exec(ctx, `delete from tokens where session_id=$1`, sessionID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
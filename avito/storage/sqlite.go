@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"golang.org/x/xerrors"
+	"time"
+)
+
+type sqliteTx struct {
+	txHooks
+	tx *sql.Tx
+}
+
+func (t *sqliteTx) storageTx() {}
+
+func asSQLiteTx(tx Tx) (*sql.Tx, error) {
+	stx, ok := tx.(*sqliteTx)
+	if !ok {
+		return nil, xerrors.Errorf("Transaction is not created by sqlite storage")
+	}
+	return stx.tx, nil
+}
+
+// время в SQLite хранится целым числом микросекунд с начала эпохи (UTC),
+// это сохраняет точность и порядок timestamp в postgres
+func sqliteTime(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Microsecond)
+}
+
+func fromSQLiteTime(micro int64) time.Time {
+	return time.Unix(0, micro*int64(time.Microsecond)).UTC()
+}
+
+func sqliteNullTime(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	result := sqliteTime(*t)
+	return &result
+}
+
+func fromSQLiteNullTime(micro *int64) *time.Time {
+	if micro == nil {
+		return nil
+	}
+	result := fromSQLiteTime(*micro)
+	return &result
+}
+
+type sqliteStorageAPI struct {
+	db             *sql.DB
+	userStorage    UserStorageAPI
+	chatStorage    ChatStorageAPI
+	messageStorage MessageStorageAPI
+	tokenStorage   TokenStorageAPI
+	sessionStorage SessionStorageAPI
+}
+
+// NewSQLiteStorageAPI ожидает, что миграции уже применены. Соединение с базой одно,
+// поэтому внутри RunInTx нельзя обращаться к методам чтения без транзакции
+func NewSQLiteStorageAPI(db *sql.DB) StorageAPI {
+	return &sqliteStorageAPI{
+		db:             db,
+		userStorage:    &sqliteUserStorage{db: db},
+		chatStorage:    &sqliteChatStorage{db: db},
+		messageStorage: &sqliteMessageStorage{db: db},
+		tokenStorage:   &sqliteTokenStorage{db: db},
+		sessionStorage: &sqliteSessionStorage{db: db},
+	}
+}
+
+func (s *sqliteStorageAPI) RunInTx(ctx context.Context, f TxFunc) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return xerrors.Errorf("Cannot begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	stx := &sqliteTx{tx: tx}
+	if err := f(stx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return xerrors.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return xerrors.Errorf("Cannot commit transaction: %w", err)
+	}
+	stx.runHooks()
+
+	return nil
+}
+
+func (s *sqliteStorageAPI) GetUserStorage() UserStorageAPI {
+	return s.userStorage
+}
+
+func (s *sqliteStorageAPI) GetChatStorage() ChatStorageAPI {
+	return s.chatStorage
+}
+
+func (s *sqliteStorageAPI) GetMessageStorage() MessageStorageAPI {
+	return s.messageStorage
+}
+
+func (s *sqliteStorageAPI) GetTokenStorage() TokenStorageAPI {
+	return s.tokenStorage
+}
+
+func (s *sqliteStorageAPI) GetSessionStorage() SessionStorageAPI {
+	return s.sessionStorage
+}
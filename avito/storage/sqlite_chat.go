@@ -0,0 +1,587 @@
+package storage
+
+import (
+	"avito/dto"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"strings"
+	"time"
+)
+
+type sqliteChatStorage struct {
+	db *sql.DB
+}
+
+func (c *sqliteChatStorage) CreateChat(ctx context.Context, tx Tx, chatname string) (dto.Chat, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return dto.Chat{}, err
+	}
+
+	createdAt := time.Now()
+	chat := dto.Chat{ID: uuid.Must(uuid.NewUUID()), Name: chatname, Type: dto.ChatGroup}
+	_, err = stx.ExecContext(ctx, `insert into chats (id, name, type, created_at) values (?, ?, ?, ?)`,
+		chat.ID, chatname, chat.Type, sqliteTime(createdAt))
+	if err != nil {
+		return dto.Chat{}, sqliteChatNameError(err)
+	}
+	chat.CreatedAt = epoch(fromSQLiteTime(sqliteTime(createdAt)))
+
+	return chat, nil
+}
+
+func (c *sqliteChatStorage) CreateDirectChat(ctx context.Context, tx Tx, first uuid.UUID, second uuid.UUID) (dto.Chat, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return dto.Chat{}, err
+	}
+
+	createdAt := time.Now()
+	chat := dto.Chat{ID: uuid.Must(uuid.NewUUID()), Type: dto.ChatDirect}
+	result, err := stx.ExecContext(ctx, `insert into chats (id, name, type, direct_key, created_at) values (?, '', ?, ?, ?)
+on conflict (direct_key) do nothing`, chat.ID, chat.Type, directChatKey(first, second), sqliteTime(createdAt))
+	if err != nil {
+		return dto.Chat{}, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return dto.Chat{}, err
+	}
+	if affected == 0 {
+		return dto.Chat{}, nil
+	}
+	chat.CreatedAt = epoch(fromSQLiteTime(sqliteTime(createdAt)))
+
+	return chat, nil
+}
+
+func (c *sqliteChatStorage) GetDirectChat(ctx context.Context, first uuid.UUID, second uuid.UUID) (uuid.UUID, error) {
+	var chatID uuid.UUID
+	err := c.db.QueryRowContext(ctx, `select id from chats where direct_key=?`, directChatKey(first, second)).Scan(&chatID)
+	if xerrors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return chatID, nil
+}
+
+func (c *sqliteChatStorage) GetChatType(ctx context.Context, chat uuid.UUID) (string, error) {
+	var chatType string
+	err := c.db.QueryRowContext(ctx, `select type from chats where id=?`, chat).Scan(&chatType)
+	if xerrors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return chatType, nil
+}
+
+func (c *sqliteChatStorage) IsChatNameTaken(ctx context.Context, name string, except uuid.UUID) (bool, error) {
+	var result int
+	err := c.db.QueryRowContext(ctx, `select count(*) from chats where type='group' and lower(name)=lower(?) and id<>?`, name, except).Scan(&result)
+	if err != nil {
+		return false, err
+	}
+
+	return result != 0, nil
+}
+
+func (c *sqliteChatStorage) RenameChat(ctx context.Context, tx Tx, chatID uuid.UUID, name string, renamedBy uuid.UUID) (dto.ChatRename, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return dto.ChatRename{}, err
+	}
+
+	rename := dto.ChatRename{Chat: chatID, NewName: name, RenamedBy: renamedBy}
+	err = stx.QueryRowContext(ctx, `select name from chats where id=?`, chatID).Scan(&rename.OldName)
+	if xerrors.Is(err, sql.ErrNoRows) {
+		return dto.ChatRename{}, nil
+	}
+	if err != nil {
+		return dto.ChatRename{}, err
+	}
+	if rename.OldName == name {
+		return rename, nil
+	}
+
+	_, err = stx.ExecContext(ctx, `update chats set name=? where id=?`, name, chatID)
+	if err != nil {
+		return dto.ChatRename{}, sqliteChatNameError(err)
+	}
+
+	createdAt := sqliteTime(time.Now())
+	_, err = stx.ExecContext(ctx, `insert into chat_renames (id, chat_id, old_name, new_name, renamed_by, created_at) values (?, ?, ?, ?, ?, ?)`,
+		uuid.Must(uuid.NewUUID()), chatID, rename.OldName, name, renamedBy, createdAt)
+	if err != nil {
+		return dto.ChatRename{}, err
+	}
+	rename.CreatedAt = epoch(fromSQLiteTime(createdAt))
+
+	return rename, nil
+}
+
+func (c *sqliteChatStorage) GetChatRenames(ctx context.Context, chatID uuid.UUID) ([]dto.ChatRename, error) {
+	rows, err := c.db.QueryContext(ctx, `select old_name, new_name, renamed_by, created_at from chat_renames
+where chat_id=? order by created_at, id`, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	renames := make([]dto.ChatRename, 0)
+	for rows.Next() {
+		rename := dto.ChatRename{Chat: chatID}
+		var createdAt int64
+		if err := rows.Scan(&rename.OldName, &rename.NewName, &rename.RenamedBy, &createdAt); err != nil {
+			return nil, err
+		}
+		rename.CreatedAt = epoch(fromSQLiteTime(createdAt))
+		renames = append(renames, rename)
+	}
+
+	return renames, rows.Err()
+}
+
+func (c *sqliteChatStorage) CreateRecordChatsUsers(ctx context.Context, tx Tx, chatID uuid.UUID, role string, users ...uuid.UUID) error {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return err
+	}
+
+	valueString := make([]string, 0, len(users))
+	valueArgs := make([]interface{}, 0, len(users)*4)
+	for _, user := range users {
+		valueString = append(valueString, "(?, ?, ?, ?)")
+		valueArgs = append(valueArgs, uuid.Must(uuid.NewUUID()), user, chatID, role)
+	}
+
+	_, err = stx.ExecContext(ctx, fmt.Sprintf(`insert into chats_users (id, user_id, chat_id, role) values %s`, strings.Join(valueString, ",")), valueArgs...)
+	return err
+}
+
+func (c *sqliteChatStorage) AddChatUsers(ctx context.Context, tx Tx, chatID uuid.UUID, role string, users ...uuid.UUID) ([]uuid.UUID, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	added := make([]uuid.UUID, 0, len(users))
+	for _, user := range users {
+		// указатель прочтения новых участников - последнее сообщение чата
+		result, err := stx.ExecContext(ctx, `insert into chats_users (id, user_id, chat_id, role, last_read_message_id, last_read_message_at, read_at)
+select ?1, ?2, ?3, ?4, last_message_id, last_message_at, last_message_at from chats where id=?3
+on conflict (chat_id, user_id) do nothing`, uuid.Must(uuid.NewUUID()), user, chatID, role)
+		if err != nil {
+			return nil, err
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if count == 1 {
+			added = append(added, user)
+		}
+	}
+
+	return added, nil
+}
+
+func (c *sqliteChatStorage) RemoveChatUser(ctx context.Context, tx Tx, chatID uuid.UUID, user uuid.UUID) (bool, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := stx.ExecContext(ctx, `delete from chats_users where chat_id=? and user_id=?`, chatID, user)
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return count == 1, nil
+}
+
+func (c *sqliteChatStorage) GetChatUserRole(ctx context.Context, chatID uuid.UUID, user uuid.UUID) (string, error) {
+	var role string
+	err := c.db.QueryRowContext(ctx, `select role from chats_users where chat_id=? and user_id=?`, chatID, user).Scan(&role)
+	if xerrors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return role, nil
+}
+
+func (c *sqliteChatStorage) SetChatUserRole(ctx context.Context, tx Tx, chatID uuid.UUID, user uuid.UUID, role string) (bool, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := stx.ExecContext(ctx, `update chats_users set role=? where chat_id=? and user_id=?`, role, chatID, user)
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return count == 1, nil
+}
+
+func (c *sqliteChatStorage) GetChatList(ctx context.Context, userId uuid.UUID, params ChatListParams) (ChatPage, error) {
+	args := []interface{}{userId}
+	conditions := make([]string, 0, 2)
+	if len(params.NamePrefix) != 0 {
+		args = append(args, escapeLike(strings.ToLower(params.NamePrefix))+"%")
+		conditions = append(conditions, `lower(name) like ? escape '\'`)
+	}
+	if params.Page.Cursor != nil {
+		args = append(args, sqliteTime(params.Page.Cursor.Time), params.Page.Cursor.ID)
+		conditions = append(conditions, "(activity, chat_id) < (?, ?)")
+	}
+	where := ""
+	if len(conditions) != 0 {
+		where = "where " + strings.Join(conditions, " and ")
+	}
+	args = append(args, params.Page.Limit+1)
+
+	rows, err := c.db.QueryContext(ctx, fmt.Sprintf(`select chat_id, name, type, created_at, activity,
+	last_message_id, last_message_author, last_message_text, last_message_type, last_message_target, last_message_at,
+	last_message_edited_at, last_message_deleted_at, last_message_deleted_by,
+	last_message_parent, last_message_reply_count, last_message_last_reply_at from (
+	select c.id as chat_id, c.name, c.type, c.created_at, coalesce(c.last_message_at, c.created_at) as activity,
+		m.id as last_message_id, m.author as last_message_author,
+		case when m.deleted_at is null then m.text else '' end as last_message_text,
+		m.type as last_message_type, m.target as last_message_target, c.last_message_at,
+		m.edited_at as last_message_edited_at, m.deleted_at as last_message_deleted_at,
+		m.deleted_by as last_message_deleted_by, m.parent as last_message_parent, m.reply_count as last_message_reply_count,
+		m.last_reply_at as last_message_last_reply_at
+	from chats_users u join chats c on u.chat_id = c.id
+	left join messages m on m.id = c.last_message_id
+	where u.user_id=?) t
+%s
+order by activity desc, chat_id desc limit ?`, where), args...)
+	if err != nil {
+		return ChatPage{}, err
+	}
+	defer rows.Close()
+
+	chats := make([]dto.Chat, 0, params.Page.Limit+1)
+	cursors := make([]Cursor, 0, params.Page.Limit+1)
+	for rows.Next() {
+		var chat dto.Chat
+		var createdAt, activity int64
+		var lastMessageID, lastMessageAuthor *uuid.UUID
+		var lastMessageText, lastMessageType *string
+		var lastMessageTarget, lastMessageDeletedBy, lastMessageParent *uuid.UUID
+		var lastMessageReplyCount *int
+		var lastMessageAt, lastMessageEditedAt, lastMessageDeletedAt, lastMessageLastReplyAt *int64
+		err := rows.Scan(&chat.ID, &chat.Name, &chat.Type, &createdAt, &activity,
+			&lastMessageID, &lastMessageAuthor, &lastMessageText, &lastMessageType, &lastMessageTarget, &lastMessageAt,
+			&lastMessageEditedAt, &lastMessageDeletedAt, &lastMessageDeletedBy, &lastMessageParent, &lastMessageReplyCount, &lastMessageLastReplyAt)
+		if err != nil {
+			return ChatPage{}, err
+		}
+		chat.CreatedAt = epoch(fromSQLiteTime(createdAt))
+		if lastMessageID != nil && lastMessageAt != nil {
+			chat.LastMessage = &dto.Message{
+				ID:          *lastMessageID,
+				Chat:        chat.ID,
+				Author:      *lastMessageAuthor,
+				Text:        *lastMessageText,
+				Type:        *lastMessageType,
+				Target:      lastMessageTarget,
+				CreatedAt:   epoch(fromSQLiteTime(*lastMessageAt)),
+				EditedAt:    nullEpoch(fromSQLiteNullTime(lastMessageEditedAt)),
+				DeletedAt:   nullEpoch(fromSQLiteNullTime(lastMessageDeletedAt)),
+				DeletedBy:   lastMessageDeletedBy,
+				Parent:      lastMessageParent,
+				LastReplyAt: nullEpoch(fromSQLiteNullTime(lastMessageLastReplyAt)),
+			}
+			if lastMessageReplyCount != nil {
+				chat.LastMessage.ReplyCount = *lastMessageReplyCount
+			}
+			chat.LastMessageAt = chat.LastMessage.CreatedAt
+		}
+
+		chats = append(chats, chat)
+		cursors = append(cursors, Cursor{Time: fromSQLiteTime(activity), ID: chat.ID})
+	}
+	if err := rows.Err(); err != nil {
+		return ChatPage{}, err
+	}
+
+	page := ChatPage{Chats: chats}
+	if len(chats) > params.Page.Limit {
+		page.Chats = chats[:params.Page.Limit]
+		page.Last = cursors[params.Page.Limit-1]
+		page.HasMore = true
+	}
+
+	if err := c.fillChatUsers(ctx, page.Chats, params.UsersLimit); err != nil {
+		return ChatPage{}, err
+	}
+	if err := c.fillReadState(ctx, page.Chats, userId); err != nil {
+		return ChatPage{}, err
+	}
+
+	return page, nil
+}
+
+// fillReadState повторяет chatStorage.fillReadState
+func (c *sqliteChatStorage) fillReadState(ctx context.Context, chats []dto.Chat, user uuid.UUID) error {
+	if len(chats) == 0 {
+		return nil
+	}
+
+	chatIDs := make([]uuid.UUID, 0, len(chats))
+	for _, chat := range chats {
+		chatIDs = append(chatIDs, chat.ID)
+	}
+
+	params, args := makeSQLiteParamsFromUUID(chatIDs)
+	rows, err := c.db.QueryContext(ctx, fmt.Sprintf(`select cu.chat_id, cu.last_read_message_id, (select count(*) from (select 1 from messages m
+	where m.chat = cu.chat_id and (m.created_at, m.id) > (coalesce(cu.last_read_message_at, -1), coalesce(cu.last_read_message_id, ''))
+		and not exists (select 1 from hidden_messages h where h.user_id = cu.user_id and h.message_id = m.id) limit %d))
+from chats_users cu where cu.user_id=? and cu.chat_id in (%s)`, maxUnreadCount, params), append([]interface{}{user}, args...)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	unreadByChatID := make(map[uuid.UUID]int)
+	lastReadByChatID := make(map[uuid.UUID]*uuid.UUID)
+	for rows.Next() {
+		var chatID uuid.UUID
+		var lastRead *uuid.UUID
+		var unread int
+		if err := rows.Scan(&chatID, &lastRead, &unread); err != nil {
+			return err
+		}
+		unreadByChatID[chatID] = unread
+		lastReadByChatID[chatID] = lastRead
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range chats {
+		chats[i].UnreadCount = unreadByChatID[chats[i].ID]
+		chats[i].LastReadMessageID = lastReadByChatID[chats[i].ID]
+	}
+
+	return nil
+}
+
+func (c *sqliteChatStorage) MarkChatRead(ctx context.Context, tx Tx, chatID uuid.UUID, user uuid.UUID, message uuid.UUID) (bool, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := stx.ExecContext(ctx, `update chats_users set last_read_message_id=?3,
+	last_read_message_at=(select created_at from messages where id=?3), read_at=?4
+where chat_id=?1 and user_id=?2 and exists (select 1 from messages m where m.id=?3 and m.chat=?1
+	and (chats_users.last_read_message_at is null
+		or (chats_users.last_read_message_at, chats_users.last_read_message_id) < (m.created_at, m.id)))`,
+		chatID, user, message, sqliteTime(time.Now()))
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return count == 1, nil
+}
+
+func (c *sqliteChatStorage) GetMessageReaders(ctx context.Context, message uuid.UUID) ([]dto.ReadReceipt, error) {
+	rows, err := c.db.QueryContext(ctx, `select cu.user_id, cu.read_at from chats_users cu join messages m on m.chat = cu.chat_id
+where m.id=? and cu.user_id <> m.author and (cu.last_read_message_at, cu.last_read_message_id) >= (m.created_at, m.id)
+order by cu.read_at, cu.user_id`, message)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	receipts := make([]dto.ReadReceipt, 0)
+	for rows.Next() {
+		var receipt dto.ReadReceipt
+		var readAt int64
+		if err := rows.Scan(&receipt.User, &readAt); err != nil {
+			return nil, err
+		}
+		receipt.ReadAt = epoch(fromSQLiteTime(readAt))
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, rows.Err()
+}
+
+// fillChatUsers повторяет chatStorage.fillChatUsers
+func (c *sqliteChatStorage) fillChatUsers(ctx context.Context, chats []dto.Chat, usersLimit int) error {
+	if len(chats) == 0 {
+		return nil
+	}
+
+	chatIDs := make([]uuid.UUID, 0, len(chats))
+	for _, chat := range chats {
+		chatIDs = append(chatIDs, chat.ID)
+	}
+
+	params, args := makeSQLiteParamsFromUUID(chatIDs)
+	rows, err := c.db.QueryContext(ctx, fmt.Sprintf(`select chat_id, user_id, total, rn from (
+	select chat_id, user_id, count(*) over (partition by chat_id) as total,
+		row_number() over (partition by chat_id order by rowid) as rn
+	from chats_users where chat_id in (%s)) t
+where ? = 0 or rn <= max(?, 1)`, params), append(args, usersLimit, usersLimit)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	usersByChatID := make(map[uuid.UUID][]uuid.UUID)
+	countByChatID := make(map[uuid.UUID]int)
+	for rows.Next() {
+		var chatID, userID uuid.UUID
+		var total, rn int
+		err := rows.Scan(&chatID, &userID, &total, &rn)
+		if err != nil {
+			return err
+		}
+		countByChatID[chatID] = total
+		if usersLimit == 0 || rn <= usersLimit {
+			usersByChatID[chatID] = append(usersByChatID[chatID], userID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range chats {
+		chats[i].Users = usersByChatID[chats[i].ID]
+		chats[i].UsersCount = countByChatID[chats[i].ID]
+	}
+
+	return nil
+}
+
+func (c *sqliteChatStorage) GetChat(ctx context.Context, chatID uuid.UUID) (dto.Chat, error) {
+	var chat dto.Chat
+	var createdAt int64
+	var lastMessageID, lastMessageAuthor *uuid.UUID
+	var lastMessageText, lastMessageType *string
+	var lastMessageTarget, lastMessageDeletedBy, lastMessageParent *uuid.UUID
+	var lastMessageReplyCount *int
+	var lastMessageAt, lastMessageEditedAt, lastMessageDeletedAt, lastMessageLastReplyAt *int64
+	err := c.db.QueryRowContext(ctx, `select c.id, c.name, c.type, c.created_at,
+	m.id, m.author, case when m.deleted_at is null then m.text else '' end, m.type, m.target,
+	c.last_message_at, m.edited_at, m.deleted_at, m.deleted_by, m.parent, m.reply_count, m.last_reply_at
+from chats c left join messages m on m.id = c.last_message_id
+where c.id=?`, chatID).Scan(&chat.ID, &chat.Name, &chat.Type, &createdAt,
+		&lastMessageID, &lastMessageAuthor, &lastMessageText, &lastMessageType, &lastMessageTarget, &lastMessageAt,
+		&lastMessageEditedAt, &lastMessageDeletedAt, &lastMessageDeletedBy, &lastMessageParent, &lastMessageReplyCount, &lastMessageLastReplyAt)
+	if xerrors.Is(err, sql.ErrNoRows) {
+		return dto.Chat{}, nil
+	}
+	if err != nil {
+		return dto.Chat{}, err
+	}
+	chat.CreatedAt = epoch(fromSQLiteTime(createdAt))
+	if lastMessageID != nil && lastMessageAt != nil {
+		chat.LastMessage = &dto.Message{
+			ID:          *lastMessageID,
+			Chat:        chat.ID,
+			Author:      *lastMessageAuthor,
+			Text:        *lastMessageText,
+			Type:        *lastMessageType,
+			Target:      lastMessageTarget,
+			CreatedAt:   epoch(fromSQLiteTime(*lastMessageAt)),
+			EditedAt:    nullEpoch(fromSQLiteNullTime(lastMessageEditedAt)),
+			DeletedAt:   nullEpoch(fromSQLiteNullTime(lastMessageDeletedAt)),
+			DeletedBy:   lastMessageDeletedBy,
+			Parent:      lastMessageParent,
+			LastReplyAt: nullEpoch(fromSQLiteNullTime(lastMessageLastReplyAt)),
+		}
+		if lastMessageReplyCount != nil {
+			chat.LastMessage.ReplyCount = *lastMessageReplyCount
+		}
+		chat.LastMessageAt = chat.LastMessage.CreatedAt
+	}
+
+	rows, err := c.db.QueryContext(ctx, `select user_id, role from chats_users where chat_id=? order by rowid`, chat.ID)
+	if err != nil {
+		return dto.Chat{}, err
+	}
+	defer rows.Close()
+
+	chat.Users = make([]uuid.UUID, 0)
+	chat.Members = make([]dto.ChatMember, 0)
+	for rows.Next() {
+		var member dto.ChatMember
+		if err := rows.Scan(&member.User, &member.Role); err != nil {
+			return dto.Chat{}, err
+		}
+		chat.Users = append(chat.Users, member.User)
+		chat.Members = append(chat.Members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return dto.Chat{}, err
+	}
+	chat.UsersCount = len(chat.Users)
+
+	return chat, nil
+}
+
+func (c *sqliteChatStorage) GetChatUsers(ctx context.Context, chat uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := c.db.QueryContext(ctx, `select user_id from chats_users where chat_id=? order by rowid`, chat)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		users = append(users, userID)
+	}
+
+	return users, rows.Err()
+}
+
+func (c *sqliteChatStorage) CheckExistChat(ctx context.Context, chat uuid.UUID) (bool, error) {
+	var result int
+	err := c.db.QueryRowContext(ctx, `select count(*) from chats where id=?`, chat).Scan(&result)
+	if err != nil {
+		return false, err
+	}
+
+	return result == 1, nil
+}
+
+// sqliteChatNameError заменяет нарушение уникальности имени чата на ErrChatNameTaken
+func sqliteChatNameError(err error) error {
+	if strings.Contains(err.Error(), "UNIQUE constraint failed: index '"+chatNameIndex+"'") {
+		return ErrChatNameTaken
+	}
+	return err
+}
@@ -0,0 +1,462 @@
+package storage
+
+import (
+	"avito/dto"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"strings"
+	"time"
+)
+
+type sqliteMessageStorage struct {
+	db *sql.DB
+}
+
+func (m *sqliteMessageStorage) GetMessageList(ctx context.Context, chat uuid.UUID, viewer uuid.UUID, params MessageListParams) (MessagePage, error) {
+	compare, order := ">", "asc"
+	if params.Page.Older {
+		compare, order = "<", "desc"
+	}
+
+	args := []interface{}{chat}
+	conditions := make([]string, 0, 2)
+	if params.Parent != uuid.Nil {
+		conditions = append(conditions, "and parent=?")
+		args = append(args, params.Parent)
+	} else if params.RootsOnly {
+		conditions = append(conditions, "and parent is null")
+	}
+	if params.Page.Cursor != nil {
+		conditions = append(conditions, fmt.Sprintf("and (created_at, id) %s (?, ?)", compare))
+		args = append(args, sqliteTime(params.Page.Cursor.Time), params.Page.Cursor.ID)
+	}
+	args = append(args, viewer, params.Page.Limit+1)
+
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf(`select %s from messages
+where chat=? %s and not exists (select 1 from hidden_messages h where h.message_id = messages.id and h.user_id = ?)
+order by created_at %s, id %s limit ?`, messageColumns, strings.Join(conditions, " "), order, order), args...)
+	if err != nil {
+		return MessagePage{}, err
+	}
+	defer rows.Close()
+
+	messages := make([]dto.Message, 0, params.Page.Limit+1)
+	cursors := make([]Cursor, 0, params.Page.Limit+1)
+	for rows.Next() {
+		message, createdAt, err := scanSQLiteMessage(rows)
+		if err != nil {
+			return MessagePage{}, err
+		}
+		messages = append(messages, message)
+		cursors = append(cursors, Cursor{Time: fromSQLiteTime(createdAt), ID: message.ID})
+	}
+	if err := rows.Err(); err != nil {
+		return MessagePage{}, err
+	}
+
+	page := makeMessagePage(messages, cursors, params.Page)
+	if err := fillMessageReactions(ctx, m, page.Messages, viewer); err != nil {
+		return MessagePage{}, err
+	}
+
+	return page, nil
+}
+
+func (m *sqliteMessageStorage) GetMessage(ctx context.Context, messageID uuid.UUID) (dto.Message, error) {
+	return m.getMessage(m.db.QueryRowContext(ctx, fmt.Sprintf(`select %s from messages where id=?`, messageColumns), messageID))
+}
+
+// getMessage возвращает сообщение с ID uuid.Nil, если строки нет
+func (m *sqliteMessageStorage) getMessage(row *sql.Row) (dto.Message, error) {
+	message, _, err := scanSQLiteMessage(row)
+	if xerrors.Is(err, sql.ErrNoRows) {
+		return dto.Message{}, nil
+	}
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	return message, nil
+}
+
+func scanSQLiteMessage(row rowScanner) (dto.Message, int64, error) {
+	var message dto.Message
+	var createdAt int64
+	var editedAt, deletedAt, lastReplyAt *int64
+	err := row.Scan(&message.ID, &message.Chat, &message.Author, &message.Text, &message.Type, &message.Target,
+		&createdAt, &editedAt, &deletedAt, &message.DeletedBy, &message.Parent, &message.ReplyCount, &lastReplyAt)
+	if err != nil {
+		return dto.Message{}, 0, err
+	}
+	message.CreatedAt = epoch(fromSQLiteTime(createdAt))
+	message.EditedAt = nullEpoch(fromSQLiteNullTime(editedAt))
+	message.DeletedAt = nullEpoch(fromSQLiteNullTime(deletedAt))
+	message.LastReplyAt = nullEpoch(fromSQLiteNullTime(lastReplyAt))
+
+	return message, createdAt, nil
+}
+
+func (m *sqliteMessageStorage) EditMessage(ctx context.Context, tx Tx, messageID uuid.UUID, text string) (dto.Message, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	message, err := m.getMessage(stx.QueryRowContext(ctx, fmt.Sprintf(`select %s from messages where id=? and deleted_at is null`,
+		messageColumns), messageID))
+	if err != nil || message.ID == uuid.Nil {
+		return message, err
+	}
+	if message.Text == text {
+		return message, nil
+	}
+
+	editedAt := sqliteTime(time.Now())
+	_, err = stx.ExecContext(ctx, `insert into message_revisions (id, message_id, text, edited_at) values (?, ?, ?, ?)`,
+		uuid.Must(uuid.NewUUID()), messageID, message.Text, editedAt)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	_, err = stx.ExecContext(ctx, `update messages set text=?, edited_at=? where id=?`, text, editedAt, messageID)
+	if err != nil {
+		return dto.Message{}, err
+	}
+	message.Text = text
+	message.EditedAt = epoch(fromSQLiteTime(editedAt))
+
+	return message, nil
+}
+
+func (m *sqliteMessageStorage) GetMessageRevisions(ctx context.Context, messageID uuid.UUID) ([]dto.MessageRevision, error) {
+	rows, err := m.db.QueryContext(ctx, `select text, edited_at from message_revisions where message_id=? order by edited_at, rowid`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make([]dto.MessageRevision, 0)
+	for rows.Next() {
+		revision := dto.MessageRevision{Message: messageID}
+		var editedAt int64
+		if err := rows.Scan(&revision.Text, &editedAt); err != nil {
+			return nil, err
+		}
+		revision.EditedAt = epoch(fromSQLiteTime(editedAt))
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (m *sqliteMessageStorage) DeleteMessage(ctx context.Context, tx Tx, messageID uuid.UUID, deletedBy uuid.UUID) (dto.Message, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	_, err = stx.ExecContext(ctx, `update messages set deleted_at=?, deleted_by=? where id=? and deleted_at is null`,
+		sqliteTime(time.Now()), deletedBy, messageID)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	return m.getMessage(stx.QueryRowContext(ctx, fmt.Sprintf(`select %s from messages where id=?`, messageColumns), messageID))
+}
+
+func (m *sqliteMessageStorage) HideMessage(ctx context.Context, tx Tx, user uuid.UUID, messageID uuid.UUID) error {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = stx.ExecContext(ctx, `insert into hidden_messages (user_id, message_id, created_at) values (?, ?, ?) on conflict do nothing`,
+		user, messageID, sqliteTime(time.Now()))
+	return err
+}
+
+func (m *sqliteMessageStorage) PurgeDeletedMessages(ctx context.Context, tx Tx, before time.Time) (int, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = stx.ExecContext(ctx, `delete from message_revisions
+where message_id in (select id from messages where deleted_at < ?)`, sqliteTime(before))
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := stx.ExecContext(ctx, `update messages set text='' where deleted_at < ? and text <> ''`, sqliteTime(before))
+	if err != nil {
+		return 0, err
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(purged), nil
+}
+
+func (m *sqliteMessageStorage) AddReaction(ctx context.Context, tx Tx, messageID uuid.UUID, user uuid.UUID, emoji string) (bool, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := stx.ExecContext(ctx, `insert into message_reactions (message_id, user_id, emoji, created_at) values (?, ?, ?, ?)
+on conflict do nothing`, messageID, user, emoji, sqliteTime(time.Now()))
+	if err != nil {
+		return false, err
+	}
+	added, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return added != 0, nil
+}
+
+func (m *sqliteMessageStorage) RemoveReaction(ctx context.Context, tx Tx, messageID uuid.UUID, user uuid.UUID, emoji string) (bool, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := stx.ExecContext(ctx, `delete from message_reactions where message_id=? and user_id=? and emoji=?`, messageID, user, emoji)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return removed != 0, nil
+}
+
+func (m *sqliteMessageStorage) PinMessage(ctx context.Context, tx Tx, chat uuid.UUID, messageID uuid.UUID, pinnedBy uuid.UUID) (bool, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := stx.ExecContext(ctx, `insert into pinned_messages (message_id, chat_id, pinned_by, pinned_at) values (?, ?, ?, ?)
+on conflict do nothing`, messageID, chat, pinnedBy, sqliteTime(time.Now()))
+	if err != nil {
+		return false, err
+	}
+	pinned, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return pinned != 0, nil
+}
+
+func (m *sqliteMessageStorage) UnpinMessage(ctx context.Context, tx Tx, messageID uuid.UUID) (bool, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := stx.ExecContext(ctx, `delete from pinned_messages where message_id=?`, messageID)
+	if err != nil {
+		return false, err
+	}
+	unpinned, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return unpinned != 0, nil
+}
+
+func (m *sqliteMessageStorage) GetPinnedMessages(ctx context.Context, chat uuid.UUID, viewer uuid.UUID) ([]dto.PinnedMessage, error) {
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf(`select %s, p.pinned_by, p.pinned_at from pinned_messages p 
+join messages on messages.id = p.message_id 
+where p.chat_id=? and deleted_at is null 
+and not exists (select 1 from hidden_messages h where h.message_id = messages.id and h.user_id = ?) 
+order by p.pinned_at desc, p.message_id desc`, messageColumns), chat, viewer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pins := make([]dto.PinnedMessage, 0)
+	for rows.Next() {
+		var pin dto.PinnedMessage
+		var pinnedAt int64
+		pin.Message, _, err = scanSQLiteMessage(extraScanner{row: rows, extra: []interface{}{&pin.PinnedBy, &pinnedAt}})
+		if err != nil {
+			return nil, err
+		}
+		pin.PinnedAt = epoch(fromSQLiteTime(pinnedAt))
+		pins = append(pins, pin)
+	}
+
+	return pins, rows.Err()
+}
+
+func (m *sqliteMessageStorage) GetReactions(ctx context.Context, messageIDs []uuid.UUID, viewer uuid.UUID) (map[uuid.UUID][]dto.Reaction, error) {
+	result := make(map[uuid.UUID][]dto.Reaction)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	params, args := makeSQLiteParamsFromUUID(messageIDs)
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf(`select message_id, emoji, count(*), max(user_id = ?) from message_reactions
+where message_id in (%s) group by message_id, emoji order by min(created_at), emoji`, params), append([]interface{}{viewer}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID uuid.UUID
+		var reaction dto.Reaction
+		if err := rows.Scan(&messageID, &reaction.Emoji, &reaction.Count, &reaction.Me); err != nil {
+			return nil, err
+		}
+		result[messageID] = append(result[messageID], reaction)
+	}
+
+	return result, rows.Err()
+}
+
+func (m *sqliteMessageStorage) SearchMessages(ctx context.Context, viewer uuid.UUID, params SearchParams) (SearchPage, error) {
+	args := []interface{}{searchHighlightStart, searchHighlightStop, searchSnippetWords, sqliteMatchQuery(params.Terms), viewer, viewer}
+	conditions := make([]string, 0, 5)
+	if params.Chat != uuid.Nil {
+		conditions = append(conditions, "and chat=?")
+		args = append(args, params.Chat)
+	}
+	if params.Author != uuid.Nil {
+		conditions = append(conditions, "and author=?")
+		args = append(args, params.Author)
+	}
+	if !params.From.IsZero() {
+		conditions = append(conditions, "and created_at >= ?")
+		args = append(args, sqliteTime(params.From))
+	}
+	if !params.To.IsZero() {
+		conditions = append(conditions, "and created_at < ?")
+		args = append(args, sqliteTime(params.To))
+	}
+	order := "created_at desc, id desc"
+	if params.ByRelevance {
+		order = "f.search_rank desc, " + order
+	}
+	if params.Cursor != nil {
+		if params.ByRelevance {
+			conditions = append(conditions, "and (f.search_rank, created_at, id) < (?, ?, ?)")
+			args = append(args, params.Cursor.Rank)
+		} else {
+			conditions = append(conditions, "and (created_at, id) < (?, ?)")
+		}
+		args = append(args, sqliteTime(params.Cursor.Time), params.Cursor.ID)
+	}
+	args = append(args, params.Limit+1)
+
+	// bm25 зависит от статистики всей таблицы и меняется при любой записи, из-за чего курсор по нему пропускает
+	// или повторяет результаты. Релевантность - число совпадений в сообщении, как в хранилище в памяти:
+	// highlight вставляет перед каждым совпадением один символ, поэтому их число - разница длин
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf(`select %s, f.search_rank, f.search_snippet from messages join (
+select message_id, cast(length(highlight(messages_fts, 0, char(1), '')) - length("text") as real) as search_rank, 
+snippet(messages_fts, 0, ?, ?, '…', ?) as search_snippet 
+from messages_fts where messages_fts match ?) f on f.message_id = messages.id 
+where deleted_at is null and type = '%s' and chat in (select chat_id from chats_users where user_id = ?) 
+and not exists (select 1 from hidden_messages h where h.message_id = messages.id and h.user_id = ?) %s 
+order by %s limit ?`, messageColumns, dto.MessageText, strings.Join(conditions, " "), order), args...)
+	if err != nil {
+		return SearchPage{}, err
+	}
+	defer rows.Close()
+
+	results := make([]dto.SearchResult, 0, params.Limit+1)
+	cursors := make([]SearchCursor, 0, params.Limit+1)
+	for rows.Next() {
+		var result dto.SearchResult
+		message, createdAt, err := scanSQLiteMessage(extraScanner{row: rows, extra: []interface{}{&result.Rank, &result.Snippet}})
+		if err != nil {
+			return SearchPage{}, err
+		}
+		result.Message = message
+		results = append(results, result)
+		cursors = append(cursors, SearchCursor{Rank: result.Rank, Cursor: Cursor{Time: fromSQLiteTime(createdAt), ID: message.ID}})
+	}
+	if err := rows.Err(); err != nil {
+		return SearchPage{}, err
+	}
+
+	return makeSearchPage(results, cursors, params), nil
+}
+
+// sqliteMatchQuery собирает запрос FTS5: каждый терм - фраза в кавычках, у префиксного терма со звездочкой.
+// Слова терма состоят только из букв и цифр, поэтому экранировать их не нужно
+func sqliteMatchQuery(terms []SearchTerm) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		part := `"` + strings.Join(term.Words, " ") + `"`
+		if term.Prefix {
+			part += "*"
+		}
+		parts = append(parts, part)
+	}
+
+	return strings.Join(parts, " AND ")
+}
+
+func (m *sqliteMessageStorage) CreateMessage(ctx context.Context, tx Tx, author uuid.UUID, chat uuid.UUID, parent uuid.UUID, text string) (dto.Message, error) {
+	message := dto.Message{ID: uuid.Must(uuid.NewUUID()), Chat: chat, Author: author, Text: text, Type: dto.MessageText, Parent: nullUUID(parent)}
+	return m.insertMessage(ctx, tx, message)
+}
+
+func (m *sqliteMessageStorage) CreateSystemMessage(ctx context.Context, tx Tx, author uuid.UUID, chat uuid.UUID, messageType string, target uuid.UUID, text string) (dto.Message, error) {
+	message := dto.Message{ID: uuid.Must(uuid.NewUUID()), Chat: chat, Author: author, Text: text, Type: messageType, Target: nullUUID(target)}
+	return m.insertMessage(ctx, tx, message)
+}
+
+func (m *sqliteMessageStorage) insertMessage(ctx context.Context, tx Tx, message dto.Message) (dto.Message, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	chat := message.Chat
+	createdAt := sqliteTime(time.Now())
+	message.CreatedAt = epoch(fromSQLiteTime(createdAt))
+	_, err = stx.ExecContext(ctx, `insert into messages (id, chat, author, text, type, target, parent, created_at) values (?, ?, ?, ?, ?, ?, ?, ?)`,
+		message.ID, chat, message.Author, message.Text, message.Type, message.Target, message.Parent, createdAt)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	if message.Parent != nil {
+		_, err = stx.ExecContext(ctx, `update messages set reply_count=reply_count+1, last_reply_at=max(coalesce(last_reply_at, 0), ?2)
+where id=?1`, *message.Parent, createdAt)
+		if err != nil {
+			return dto.Message{}, err
+		}
+	}
+
+	_, err = stx.ExecContext(ctx, `update chats set last_message_id=?1, last_message_at=?2
+where id=?3 and (last_message_at is null or last_message_at <= ?2)`, message.ID, createdAt, chat)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	// свое сообщение автор уже прочитал
+	_, err = stx.ExecContext(ctx, `update chats_users set last_read_message_id=?1, last_read_message_at=?2, read_at=?2
+where chat_id=?3 and user_id=?4 and (last_read_message_at is null or (last_read_message_at, last_read_message_id) < (?2, ?1))`,
+		message.ID, createdAt, chat, message.Author)
+	if err != nil {
+		return dto.Message{}, err
+	}
+
+	return message, nil
+}
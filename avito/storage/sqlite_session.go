@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"time"
+)
+
+type sqliteSessionStorage struct {
+	db *sql.DB
+}
+
+func (s *sqliteSessionStorage) CreateSession(ctx context.Context, tx Tx, session Session) error {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = stx.ExecContext(ctx, `insert into sessions (id, user_id, refresh_token_hash, created_at, expires_at) values (?, ?, ?, ?, ?)`,
+		session.ID, session.UserID, session.RefreshTokenHash, sqliteTime(session.CreatedAt), sqliteTime(session.ExpiresAt))
+	return err
+}
+
+type sqliteScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSQLiteSession(row sqliteScanner) (Session, error) {
+	var session Session
+	var createdAt, expiresAt int64
+	var revokedAt *int64
+	err := row.Scan(&session.ID, &session.UserID, &session.RefreshTokenHash, &createdAt, &expiresAt, &revokedAt)
+	if err != nil {
+		return Session{}, err
+	}
+	session.CreatedAt = fromSQLiteTime(createdAt)
+	session.ExpiresAt = fromSQLiteTime(expiresAt)
+	session.RevokedAt = fromSQLiteNullTime(revokedAt)
+
+	return session, nil
+}
+
+func (s *sqliteSessionStorage) GetSessionByRefreshToken(ctx context.Context, refreshTokenHash string) (Session, error) {
+	session, err := scanSQLiteSession(s.db.QueryRowContext(ctx, `select id, user_id, refresh_token_hash, created_at, expires_at, revoked_at 
+from sessions where refresh_token_hash=?`, refreshTokenHash))
+	if xerrors.Is(err, sql.ErrNoRows) {
+		return Session{}, nil
+	}
+	if err != nil {
+		return Session{}, err
+	}
+
+	return session, nil
+}
+
+func (s *sqliteSessionStorage) RotateRefreshToken(ctx context.Context, tx Tx, sessionID uuid.UUID, oldHash string, newHash string, expiresAt time.Time) (bool, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := stx.ExecContext(ctx, `update sessions set refresh_token_hash=?, expires_at=? 
+where id=? and refresh_token_hash=? and revoked_at is null`, newHash, sqliteTime(expiresAt), sessionID, oldHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+func (s *sqliteSessionStorage) GetUserSessions(ctx context.Context, userID uuid.UUID, now time.Time) ([]Session, error) {
+	rows, err := s.db.QueryContext(ctx, `select id, user_id, refresh_token_hash, created_at, expires_at, revoked_at from sessions 
+where user_id=? and revoked_at is null and expires_at > ? order by created_at desc, id desc`, userID, sqliteTime(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		session, err := scanSQLiteSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (s *sqliteSessionStorage) RevokeSession(ctx context.Context, tx Tx, userID uuid.UUID, sessionID uuid.UUID, now time.Time) (bool, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := stx.ExecContext(ctx, `update sessions set revoked_at=? where id=? and user_id=? and revoked_at is null`,
+		sqliteTime(now), sessionID, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected != 1 {
+		return false, err
+	}
+
+	if _, err := stx.ExecContext(ctx, `delete from tokens where session_id=?`, sessionID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
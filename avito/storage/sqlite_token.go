@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"time"
+)
+
+type sqliteTokenStorage struct {
+	db *sql.DB
+}
+
+func (t *sqliteTokenStorage) CreateToken(ctx context.Context, tx Tx, token Token) error {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = stx.ExecContext(ctx, `insert into tokens (id, user_id, token_hash, session_id, expires_at, created_at) values (?, ?, ?, ?, ?, ?)`,
+		uuid.Must(uuid.NewUUID()), token.UserID, token.Hash, nullUUID(token.SessionID), sqliteNullTime(token.ExpiresAt), sqliteTime(time.Now()))
+	return err
+}
+
+func (t *sqliteTokenStorage) GetToken(ctx context.Context, tokenHash string) (Token, error) {
+	token := Token{Hash: tokenHash}
+	var sessionID *uuid.UUID
+	var expiresAt *int64
+	err := t.db.QueryRowContext(ctx, `select user_id, session_id, expires_at from tokens where token_hash=?`, tokenHash).
+		Scan(&token.UserID, &sessionID, &expiresAt)
+	if xerrors.Is(err, sql.ErrNoRows) {
+		return Token{}, nil
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	if sessionID != nil {
+		token.SessionID = *sessionID
+	}
+	token.ExpiresAt = fromSQLiteNullTime(expiresAt)
+
+	return token, nil
+}
+
+func (t *sqliteTokenStorage) DeleteExpiredTokens(ctx context.Context, tx Tx, sessionID uuid.UUID, now time.Time) error {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = stx.ExecContext(ctx, `delete from tokens where session_id=? and expires_at <= ?`, sessionID, sqliteTime(now))
+	return err
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"avito/dto"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+	"strings"
+	"time"
+)
+
+type sqliteUserStorage struct {
+	db *sql.DB
+}
+
+func (u *sqliteUserStorage) IsUserExist(ctx context.Context, username string) (bool, error) {
+	var result int
+	err := u.db.QueryRowContext(ctx, `select count(*) from users where username=?`, username).Scan(&result)
+	if err != nil {
+		return false, err
+	}
+
+	return result == 1, nil
+}
+
+func (u *sqliteUserStorage) CreateUser(ctx context.Context, tx Tx, username string, passwordHash string) (uuid.UUID, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	userID := uuid.Must(uuid.NewUUID())
+	_, err = stx.ExecContext(ctx, `insert into users (id, username, password_hash, created_at) values (?, ?, ?, ?)`,
+		userID, username, nullString(passwordHash), sqliteTime(time.Now()))
+	if err != nil {
+		// у драйвера нет отдельного типа для нарушения ограничения, различаем по тексту ошибки SQLite
+		if strings.Contains(err.Error(), "UNIQUE constraint failed: users.username") {
+			return uuid.Nil, ErrUsernameTaken
+		}
+		return uuid.Nil, err
+	}
+
+	return userID, nil
+}
+
+func (u *sqliteUserStorage) GetUserCredentials(ctx context.Context, username string) (uuid.UUID, string, error) {
+	var userID uuid.UUID
+	var passwordHash *string
+	err := u.db.QueryRowContext(ctx, `select id, password_hash from users where username=?`, username).Scan(&userID, &passwordHash)
+	if xerrors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, "", nil
+	}
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	if passwordHash == nil {
+		return userID, "", nil
+	}
+
+	return userID, *passwordHash, nil
+}
+
+func (u *sqliteUserStorage) CheckExistUsers(ctx context.Context, ids ...uuid.UUID) (bool, error) {
+	var result int
+	params, args := makeSQLiteParamsFromUUID(ids)
+	err := u.db.QueryRowContext(ctx, fmt.Sprintf(`select count(*) from users where id in (%s)`, params), args...).Scan(&result)
+	if err != nil {
+		return false, err
+	}
+
+	return result == len(ids), nil
+}
+
+func (u *sqliteUserStorage) GetUsers(ctx context.Context, ids []uuid.UUID) ([]dto.User, error) {
+	users := make([]dto.User, 0, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	params, args := makeSQLiteParamsFromUUID(ids)
+	rows, err := u.db.QueryContext(ctx, fmt.Sprintf(`select %s from users where id in (%s)`, userColumns, params), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanSQLiteUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func (u *sqliteUserStorage) GetUserByUsername(ctx context.Context, username string) (dto.User, error) {
+	user, err := scanSQLiteUser(u.db.QueryRowContext(ctx, fmt.Sprintf(`select %s from users where username=?`, userColumns), username))
+	if xerrors.Is(err, sql.ErrNoRows) {
+		return dto.User{}, nil
+	}
+	if err != nil {
+		return dto.User{}, err
+	}
+
+	return user, nil
+}
+
+func (u *sqliteUserStorage) SearchUsers(ctx context.Context, params UserSearchParams) (UserPage, error) {
+	args := []interface{}{escapeLike(strings.ToLower(params.Prefix)) + "%"}
+	after := ""
+	if len(params.After) != 0 {
+		args = append(args, strings.ToLower(params.After), params.After)
+		after = "and (lower(username), username) > (?, ?)"
+	}
+	args = append(args, params.Limit+1)
+
+	rows, err := u.db.QueryContext(ctx, fmt.Sprintf(`select %s from users where lower(username) like ? escape '\' %s 
+order by lower(username), username limit ?`, userColumns, after), args...)
+	if err != nil {
+		return UserPage{}, err
+	}
+	defer rows.Close()
+
+	users := make([]dto.User, 0, params.Limit+1)
+	for rows.Next() {
+		user, err := scanSQLiteUser(rows)
+		if err != nil {
+			return UserPage{}, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return UserPage{}, err
+	}
+
+	return makeUserPage(users, params.Limit), nil
+}
+
+func (u *sqliteUserStorage) UpdateProfile(ctx context.Context, tx Tx, userID uuid.UUID, displayName *string, avatarURL *string) (dto.User, error) {
+	stx, err := asSQLiteTx(tx)
+	if err != nil {
+		return dto.User{}, err
+	}
+
+	_, err = stx.ExecContext(ctx, `update users 
+set display_name = nullif(coalesce(?2, display_name), ''), avatar_url = nullif(coalesce(?3, avatar_url), '') where id=?1`,
+		userID, displayName, avatarURL)
+	if err != nil {
+		return dto.User{}, err
+	}
+
+	user, err := scanSQLiteUser(stx.QueryRowContext(ctx, fmt.Sprintf(`select %s from users where id=?`, userColumns), userID))
+	if xerrors.Is(err, sql.ErrNoRows) {
+		return dto.User{}, nil
+	}
+	if err != nil {
+		return dto.User{}, err
+	}
+
+	return user, nil
+}
+
+func scanSQLiteUser(row rowScanner) (dto.User, error) {
+	var user dto.User
+	var displayName, avatarURL *string
+	var createdAt int64
+	if err := row.Scan(&user.ID, &user.Username, &displayName, &avatarURL, &createdAt); err != nil {
+		return dto.User{}, err
+	}
+	user.DisplayName = fromNullString(displayName)
+	user.AvatarURL = fromNullString(avatarURL)
+	user.CreatedAt = epoch(fromSQLiteTime(createdAt))
+
+	return user, nil
+}
+
+func makeSQLiteParamsFromUUID(ids []uuid.UUID) (string, []interface{}) {
+	params := make([]string, 0, len(ids))
+	args := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		params = append(params, "?")
+		args = append(args, id)
+	}
+
+	return strings.Join(params, ","), args
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"avito/db"
+	"avito/dto"
+	"avito/migrations"
+	"context"
+	"github.com/google/uuid"
+	"path/filepath"
+	"testing"
+)
+
+// newTestSQLiteStorage открывает пустую базу SQLite во временном каталоге и применяет все миграции
+func newTestSQLiteStorage(t *testing.T) StorageAPI {
+	t.Helper()
+	sqliteDB := db.NewConnectToSQLite(filepath.Join(t.TempDir(), "test.db"))
+	t.Cleanup(func() { sqliteDB.Close() })
+
+	migrator, err := migrations.NewSQLiteMigrator(sqliteDB)
+	if err != nil {
+		t.Fatalf("NewSQLiteMigrator: %+v", err)
+	}
+	if err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Cannot apply migrations: %+v", err)
+	}
+
+	return NewSQLiteStorageAPI(sqliteDB)
+}
+
+// forEachStorage выполняет тест над хранилищем в памяти и над SQLite
+func forEachStorage(t *testing.T, test func(t *testing.T, api StorageAPI)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryStorageAPI())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newTestSQLiteStorage(t))
+	})
+}
+
+func createTestUser(ctx context.Context, api StorageAPI, username string) (uuid.UUID, error) {
+	var user uuid.UUID
+	err := api.RunInTx(ctx, func(tx Tx) error {
+		var err error
+		user, err = api.GetUserStorage().CreateUser(ctx, tx, username, "")
+		return err
+	})
+	return user, err
+}
+
+// createTestChat создает групповой чат, первый из users становится владельцем
+func createTestChat(t *testing.T, api StorageAPI, name string, users ...uuid.UUID) uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+	var chat dto.Chat
+	err := api.RunInTx(ctx, func(tx Tx) error {
+		var err error
+		chat, err = api.GetChatStorage().CreateChat(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		if err := api.GetChatStorage().CreateRecordChatsUsers(ctx, tx, chat.ID, dto.RoleOwner, users[0]); err != nil || len(users) == 1 {
+			return err
+		}
+		return api.GetChatStorage().CreateRecordChatsUsers(ctx, tx, chat.ID, dto.RoleMember, users[1:]...)
+	})
+	if err != nil {
+		t.Fatalf("Cannot create chat %s: %+v", name, err)
+	}
+	return chat.ID
+}
+
+// createTestMessages отправляет сообщения по одному в отдельных транзакциях
+func createTestMessages(t *testing.T, api StorageAPI, chat uuid.UUID, author uuid.UUID, texts ...string) []uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+	ids := make([]uuid.UUID, 0, len(texts))
+	for _, text := range texts {
+		err := api.RunInTx(ctx, func(tx Tx) error {
+			message, err := api.GetMessageStorage().CreateMessage(ctx, tx, author, chat, uuid.Nil, text)
+			ids = append(ids, message.ID)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Cannot create message %s: %+v", text, err)
+		}
+	}
+	return ids
+}
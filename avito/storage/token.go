@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"avito/db"
+	"context"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/xerrors"
+	"time"
+)
+
+// Token - выданный токен доступа. Сам токен знает лишь клиент, хранится только его хэш
+type Token struct {
+	UserID uuid.UUID
+	// SessionID - сессия, в рамках которой выдан токен, uuid.Nil для бессрочных API-токенов
+	SessionID uuid.UUID
+	Hash      string
+	ExpiresAt *time.Time
+}
+
+type TokenStorageAPI interface {
+	CreateToken(ctx context.Context, tx Tx, token Token) error
+	// GetToken возвращает токен с UserID uuid.Nil, если токен не найден
+	GetToken(ctx context.Context, tokenHash string) (Token, error)
+	// DeleteExpiredTokens удаляет истекшие access-токены сессии, каждое обновление выдает новый
+	DeleteExpiredTokens(ctx context.Context, tx Tx, sessionID uuid.UUID, now time.Time) error
+}
+
+type tokenStorage struct {
+	db db.ConnDB
+}
+
+func NewTokenStorageAPI(connDB db.ConnDB) TokenStorageAPI {
+	return &tokenStorage{
+		db: connDB,
+	}
+}
+
+func (t *tokenStorage) CreateToken(ctx context.Context, tx Tx, token Token) error {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = ptx.Exec(ctx, `insert into tokens (id, user_id, token_hash, session_id, expires_at) values ($1, $2, $3, $4, $5::timestamp)`,
+		uuid.Must(uuid.NewUUID()), token.UserID, token.Hash, nullUUID(token.SessionID), pgNullTime(token.ExpiresAt))
+	return err
+}
+
+func (t *tokenStorage) GetToken(ctx context.Context, tokenHash string) (Token, error) {
+	token := Token{Hash: tokenHash}
+	var sessionID *uuid.UUID
+	err := t.db.DB.QueryRow(ctx, `select user_id, session_id, expires_at from tokens where token_hash=$1`, tokenHash).
+		Scan(&token.UserID, &sessionID, &token.ExpiresAt)
+	if xerrors.Is(err, pgx.ErrNoRows) {
+		return Token{}, nil
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	if sessionID != nil {
+		token.SessionID = *sessionID
+	}
+
+	return token, nil
+}
+
+func (t *tokenStorage) DeleteExpiredTokens(ctx context.Context, tx Tx, sessionID uuid.UUID, now time.Time) error {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = ptx.Exec(ctx, `delete from tokens where session_id=$1 and expires_at <= $2::timestamp`, sessionID, pgTimestamp(now))
+	return err
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/xerrors"
+)
+
+// Tx - транзакция хранилища. Конкретный тип определяется реализацией StorageAPI,
+// методы записи принимают только транзакции, созданные RunInTx той же реализации
+type Tx interface {
+	storageTx()
+	afterCommit(f func())
+}
+
+// TxFunc выполняется внутри транзакции: ошибка или panic откатывают транзакцию, иначе она коммитится
+type TxFunc func(tx Tx) error
+
+// AfterCommit откладывает вызов f до успешного коммита tx, при откате f не вызывается
+func AfterCommit(tx Tx, f func()) {
+	tx.afterCommit(f)
+}
+
+// txHooks - функции, отложенные до коммита, встраивается в транзакции всех реализаций
+type txHooks struct {
+	hooks []func()
+}
+
+func (h *txHooks) afterCommit(f func()) {
+	h.hooks = append(h.hooks, f)
+}
+
+func (h *txHooks) runHooks() {
+	for _, f := range h.hooks {
+		f()
+	}
+}
+
+type pgTx struct {
+	txHooks
+	tx pgx.Tx
+}
+
+func (t *pgTx) storageTx() {}
+
+func asPgTx(tx Tx) (pgx.Tx, error) {
+	ptx, ok := tx.(*pgTx)
+	if !ok {
+		return nil, xerrors.Errorf("Transaction is not created by postgres storage")
+	}
+	return ptx.tx, nil
+}
+
+// PgTx возвращает транзакцию postgres для запросов вне хранилища, например записи событий шины
+func PgTx(tx Tx) (pgx.Tx, error) {
+	return asPgTx(tx)
+}
+
+func runInPgTx(ctx context.Context, begin func(ctx context.Context) (pgx.Tx, error), f TxFunc) (err error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return xerrors.Errorf("Cannot begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback(ctx)
+			panic(p)
+		}
+	}()
+
+	ptx := &pgTx{tx: tx}
+	if err := f(ptx); err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
+			return xerrors.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return xerrors.Errorf("Cannot commit transaction: %w", err)
+	}
+	ptx.runHooks()
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"golang.org/x/xerrors"
+	"testing"
+)
+
+func TestRunInTxRollsBackOnError(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, api StorageAPI) {
+		ctx := context.Background()
+		failure := xerrors.New("failure")
+		hookCalled := false
+
+		err := api.RunInTx(ctx, func(tx Tx) error {
+			if _, err := api.GetUserStorage().CreateUser(ctx, tx, "alice", ""); err != nil {
+				return err
+			}
+			AfterCommit(tx, func() { hookCalled = true })
+			return failure
+		})
+		if !xerrors.Is(err, failure) {
+			t.Errorf("RunInTx returned %v, expected %v", err, failure)
+		}
+		if hookCalled {
+			t.Errorf("Hook is called after rollback")
+		}
+		exists, err := api.GetUserStorage().IsUserExist(ctx, "alice")
+		if err != nil {
+			t.Fatalf("IsUserExist: %+v", err)
+		}
+		if exists {
+			t.Errorf("User is created by rolled back transaction")
+		}
+	})
+}
+
+func TestRunInTxRunsHooksAfterCommit(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, api StorageAPI) {
+		ctx := context.Background()
+		existsInHook := false
+
+		err := api.RunInTx(ctx, func(tx Tx) error {
+			if _, err := api.GetUserStorage().CreateUser(ctx, tx, "alice", ""); err != nil {
+				return err
+			}
+			// хук видит закоммиченные изменения
+			AfterCommit(tx, func() {
+				existsInHook, _ = api.GetUserStorage().IsUserExist(ctx, "alice")
+			})
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("RunInTx: %+v", err)
+		}
+		if !existsInHook {
+			t.Errorf("Hook doesn't see committed user")
+		}
+	})
+}
+
+func TestTxOfAnotherStorageIsRejected(t *testing.T) {
+	ctx := context.Background()
+	memoryAPI, sqliteAPI := NewMemoryStorageAPI(), newTestSQLiteStorage(t)
+
+	err := memoryAPI.RunInTx(ctx, func(tx Tx) error {
+		_, err := sqliteAPI.GetUserStorage().CreateUser(ctx, tx, "alice", "")
+		return err
+	})
+	if err == nil {
+		t.Errorf("SQLite storage accepted memory transaction")
+	}
+	err = sqliteAPI.RunInTx(ctx, func(tx Tx) error {
+		_, err := memoryAPI.GetUserStorage().CreateUser(ctx, tx, "alice", "")
+		return err
+	})
+	if err == nil {
+		t.Errorf("Memory storage accepted SQLite transaction")
+	}
+}
@@ -1,53 +1,119 @@
 package storage
 
 import (
-	"../db"
+	"avito/db"
+	"avito/dto"
 	"context"
 	"fmt"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/xerrors"
+	"strings"
+	"time"
 )
 
+// pgUniqueViolation - код ошибки postgres при нарушении уникального индекса
+const pgUniqueViolation = "23505"
+
+// ErrUsernameTaken возвращается при создании пользователя с занятым именем,
+// в том числе когда имя заняла параллельная регистрация
+var ErrUsernameTaken = xerrors.New("Username is already taken")
+
 type UserStorageAPI interface {
-	CreateUser(tx pgx.Tx, username string) (uuid.UUID, error)
-	IsUserExist(username string) (bool, error)
-	CheckExistUsers(ids ...uuid.UUID) (bool, error)
+	// CreateUser создает пользователя, пустой passwordHash - пользователь без пароля.
+	// Занятое имя - ErrUsernameTaken
+	CreateUser(ctx context.Context, tx Tx, username string, passwordHash string) (uuid.UUID, error)
+	// GetUserCredentials возвращает uuid.Nil, если пользователя нет, и пустой хэш, если у него нет пароля
+	GetUserCredentials(ctx context.Context, username string) (uuid.UUID, string, error)
+	IsUserExist(ctx context.Context, username string) (bool, error)
+	CheckExistUsers(ctx context.Context, ids ...uuid.UUID) (bool, error)
+	// GetUsers возвращает найденных пользователей в произвольном порядке, несуществующие id пропускаются
+	GetUsers(ctx context.Context, ids []uuid.UUID) ([]dto.User, error)
+	// GetUserByUsername возвращает пользователя с ID uuid.Nil, если его нет
+	GetUserByUsername(ctx context.Context, username string) (dto.User, error)
+	SearchUsers(ctx context.Context, params UserSearchParams) (UserPage, error)
+	// UpdateProfile меняет поля профиля: nil - поле не меняется, пустая строка очищает его.
+	// ID в ответе равен uuid.Nil, если пользователя нет
+	UpdateProfile(ctx context.Context, tx Tx, user uuid.UUID, displayName *string, avatarURL *string) (dto.User, error)
+}
+
+// userColumns - публичные поля пользователя в порядке сканирования
+const userColumns = `id, username, display_name, avatar_url, created_at`
+
+// UserSearchParams - поиск по префиксу имени без учета регистра, пользователи упорядочены по имени
+// в нижнем регистре, затем по самому имени. After - имя последнего пользователя предыдущей страницы
+type UserSearchParams struct {
+	Prefix string
+	After  string
+	Limit  int
+}
+
+// UserPage - страница пользователей, HasMore показывает, есть ли следующая
+type UserPage struct {
+	Users   []dto.User
+	HasMore bool
 }
 
 type userStorage struct {
 	db db.ConnDB
-	ctx context.Context
 }
 
-func NewUserStorageAPI(connDB db.ConnDB, ctx context.Context) UserStorageAPI {
+func NewUserStorageAPI(connDB db.ConnDB) UserStorageAPI {
 	return &userStorage{
 		db: connDB,
-		ctx: ctx,
 	}
 }
 
-func (u *userStorage) IsUserExist(username string) (bool, error) {
+func (u *userStorage) IsUserExist(ctx context.Context, username string) (bool, error) {
 	var result int
-	err := u.db.DB.QueryRow(u.ctx, `select count(*) from users where username=$1`, username).Scan(&result)
-	if result == 1 {
-		return true, err
+	err := u.db.DB.QueryRow(ctx, `select count(*) from users where username=$1`, username).Scan(&result)
+	if err != nil {
+		return false, err
 	}
-	return false, nil
+
+	return result == 1, nil
 }
 
-func (u *userStorage) CreateUser(tx pgx.Tx, username string) (uuid.UUID, error) {
+func (u *userStorage) CreateUser(ctx context.Context, tx Tx, username string, passwordHash string) (uuid.UUID, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
 	userID := uuid.Must(uuid.NewUUID())
-	if _, err := tx.Exec(u.ctx, `insert into users (id, username) values ($1,$2)`, userID, username); err != nil {
+	if _, err := ptx.Exec(ctx, `insert into users (id, username, password_hash) values ($1,$2,$3)`, userID, username, nullString(passwordHash)); err != nil {
+		var pgErr *pgconn.PgError
+		if xerrors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			return uuid.Nil, ErrUsernameTaken
+		}
 		return uuid.Nil, err
 	}
 
 	return userID, nil
 }
 
-func (u *userStorage) CheckExistUsers(ids ...uuid.UUID) (bool, error) {
+func (u *userStorage) GetUserCredentials(ctx context.Context, username string) (uuid.UUID, string, error) {
+	var userID uuid.UUID
+	var passwordHash *string
+	err := u.db.DB.QueryRow(ctx, `select id, password_hash from users where username=$1`, username).Scan(&userID, &passwordHash)
+	if xerrors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, "", nil
+	}
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	if passwordHash == nil {
+		return userID, "", nil
+	}
+
+	return userID, *passwordHash, nil
+}
+
+func (u *userStorage) CheckExistUsers(ctx context.Context, ids ...uuid.UUID) (bool, error) {
 	var result int
 	paramsString, userIds := makeParamsFromUUID(ids)
-	err := u.db.DB.QueryRow(u.ctx, fmt.Sprintf(`select count(*) from users where id in (%s)`, paramsString), userIds...).Scan(&result)
+	err := u.db.DB.QueryRow(ctx, fmt.Sprintf(`select count(*) from users where id in (%s)`, paramsString), userIds...).Scan(&result)
 	if err != nil {
 		return false, err
 	}
@@ -58,3 +124,110 @@ func (u *userStorage) CheckExistUsers(ids ...uuid.UUID) (bool, error) {
 
 	return true, nil
 }
+
+func (u *userStorage) GetUsers(ctx context.Context, ids []uuid.UUID) ([]dto.User, error) {
+	users := make([]dto.User, 0, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	paramsString, args := makeParamsFromUUID(ids)
+	rows, err := u.db.DB.Query(ctx, fmt.Sprintf(`select %s from users where id in (%s)`, userColumns, paramsString), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanPgUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func (u *userStorage) GetUserByUsername(ctx context.Context, username string) (dto.User, error) {
+	user, err := scanPgUser(u.db.DB.QueryRow(ctx, fmt.Sprintf(`select %s from users where username=$1`, userColumns), username))
+	if xerrors.Is(err, pgx.ErrNoRows) {
+		return dto.User{}, nil
+	}
+	if err != nil {
+		return dto.User{}, err
+	}
+
+	return user, nil
+}
+
+func (u *userStorage) SearchUsers(ctx context.Context, params UserSearchParams) (UserPage, error) {
+	// выражение lower(username) collate "C" совпадает с индексом users_lower_username_idx
+	args := []interface{}{escapeLike(strings.ToLower(params.Prefix)) + "%", params.Limit + 1}
+	after := ""
+	if len(params.After) != 0 {
+		args = append(args, strings.ToLower(params.After), params.After)
+		after = `and (lower(username) collate "C", username collate "C") > ($3, $4)`
+	}
+
+	rows, err := u.db.DB.Query(ctx, fmt.Sprintf(`select %s from users where lower(username) collate "C" like $1 %s 
+order by lower(username) collate "C", username collate "C" limit $2`, userColumns, after), args...)
+	if err != nil {
+		return UserPage{}, err
+	}
+	defer rows.Close()
+
+	users := make([]dto.User, 0, params.Limit+1)
+	for rows.Next() {
+		user, err := scanPgUser(rows)
+		if err != nil {
+			return UserPage{}, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return UserPage{}, err
+	}
+
+	return makeUserPage(users, params.Limit), nil
+}
+
+func (u *userStorage) UpdateProfile(ctx context.Context, tx Tx, userID uuid.UUID, displayName *string, avatarURL *string) (dto.User, error) {
+	ptx, err := asPgTx(tx)
+	if err != nil {
+		return dto.User{}, err
+	}
+
+	user, err := scanPgUser(ptx.QueryRow(ctx, fmt.Sprintf(`update users 
+set display_name = nullif(coalesce($2, display_name), ''), avatar_url = nullif(coalesce($3, avatar_url), '') 
+where id=$1 returning %s`, userColumns), userID, displayName, avatarURL))
+	if xerrors.Is(err, pgx.ErrNoRows) {
+		return dto.User{}, nil
+	}
+	if err != nil {
+		return dto.User{}, err
+	}
+
+	return user, nil
+}
+
+func scanPgUser(row rowScanner) (dto.User, error) {
+	var user dto.User
+	var displayName, avatarURL *string
+	var createdAt time.Time
+	if err := row.Scan(&user.ID, &user.Username, &displayName, &avatarURL, &createdAt); err != nil {
+		return dto.User{}, err
+	}
+	user.DisplayName = fromNullString(displayName)
+	user.AvatarURL = fromNullString(avatarURL)
+	user.CreatedAt = epoch(createdAt)
+
+	return user, nil
+}
+
+func makeUserPage(users []dto.User, limit int) UserPage {
+	if len(users) > limit {
+		return UserPage{Users: users[:limit], HasMore: true}
+	}
+	return UserPage{Users: users}
+}